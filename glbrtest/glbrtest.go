@@ -0,0 +1,54 @@
+// Package glbrtest glbrを使うhandlerのテスト用のユーティリティ
+package glbrtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"cloud.google.com/go/logging"
+	"github.com/KawanoTakayuki/glbr"
+)
+
+const (
+	// LogID Requestで子エントリを記録するlogID
+	LogID = "glbrtest"
+	// ParentLogID Requestで親エントリを記録するlogID
+	ParentLogID = "glbrtest_request"
+)
+
+// Group 1リクエストで出力されたエントリ
+type Group struct {
+	Parent   logging.Entry
+	Children []logging.Entry
+}
+
+// Request handlerをGroupedByの内側で実行し、レスポンスとグループのエントリを返す
+// エントリはCloud Loggingに送信されずに記録される。configureでserviceの設定を変更できる
+// handlerのpanicは回復され、500のレスポンスになる
+//
+//	res, group := glbrtest.Request(handler, httptest.NewRequest("GET", "/", nil))
+//	if group.Parent.Severity != logging.Error { ... }
+func Request(handler http.Handler, req *http.Request, configure ...func(glbr.Service) glbr.Service) (*http.Response, Group) {
+	log, rec, err := glbr.NewRecorder(LogID)
+	if err != nil {
+		panic(err)
+	}
+	for _, fn := range configure {
+		log = fn(log)
+	}
+	h := glbr.Chain(log.Recover(), log.GroupedBy(ParentLogID))(handler)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	log.Close()
+
+	var group Group
+	if parents := rec.Entries(ParentLogID); 0 < len(parents) {
+		group.Parent = parents[len(parents)-1]
+	}
+	for _, entry := range rec.Entries(LogID) {
+		if entry.Trace == group.Parent.Trace {
+			group.Children = append(group.Children, entry)
+		}
+	}
+	return w.Result(), group
+}
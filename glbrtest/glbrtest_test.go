@@ -0,0 +1,172 @@
+package glbrtest_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/logging"
+	"github.com/KawanoTakayuki/glbr"
+	"github.com/KawanoTakayuki/glbr/glbrtest"
+)
+
+func newRequest() *http.Request {
+	return httptest.NewRequest("GET", "/stress", nil)
+}
+
+// 子エントリのgoroutineがraiseする間に、handlerがWriteHeader, Write, Flushを行う
+func TestStressResponse(t *testing.T) {
+	const concurrency, iterations, children = 8, 50, 6
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := r.Context()
+		glbr.Go(c, func(c context.Context) {
+			for i := 0; i < children-1; i++ {
+				glbr.Infof(c, "child %d", i)
+			}
+			glbr.Errorf(c, "failed")
+		})
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("body"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("more"))
+	})
+	groups := glbrtest.Stress(handler, newRequest, concurrency, iterations)
+	if len(groups) != concurrency*iterations {
+		t.Fatalf("groups = %d, want %d", len(groups), concurrency*iterations)
+	}
+	for _, g := range groups {
+		if len(g.Children) != children {
+			t.Fatalf("children = %d, want %d", len(g.Children), children)
+		}
+		if g.Parent.Severity != logging.Error {
+			t.Errorf("parent severity = %v, want Error", g.Parent.Severity)
+		}
+		if g.Parent.HTTPRequest.Status != http.StatusCreated {
+			t.Errorf("status = %d, want 201", g.Parent.HTTPRequest.Status)
+		}
+		if g.Parent.HTTPRequest.ResponseSize != 8 {
+			t.Errorf("response size = %d, want 8", g.Parent.HTTPRequest.ResponseSize)
+		}
+	}
+}
+
+// 親エントリの出力(close)と、Detachしたgoroutineのraiseが競合する
+func TestStressGroupClose(t *testing.T) {
+	const concurrency, iterations = 8, 50
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := glbr.Detach(r.Context())
+		go glbr.Warningf(c, "detached")
+		glbr.Infof(r.Context(), "handler")
+	})
+	groups := glbrtest.Stress(handler, newRequest, concurrency, iterations)
+	if len(groups) != concurrency*iterations {
+		t.Fatalf("groups = %d, want %d", len(groups), concurrency*iterations)
+	}
+	for _, g := range groups {
+		if len(g.Children) < 1 || 2 < len(g.Children) {
+			t.Fatalf("children = %d, want 1 or 2", len(g.Children))
+		}
+		for _, child := range g.Children {
+			if child.Severity != logging.Warning {
+				continue
+			}
+			// 親エントリの出力前であれば集計され、出力後であればlateになる
+			late := child.Labels["late"] == "true"
+			if late && child.Labels["parent_insert_id"] != g.Parent.InsertID {
+				t.Errorf("parent_insert_id = %q, want %q", child.Labels["parent_insert_id"], g.Parent.InsertID)
+			}
+			if !late && g.Parent.Severity != logging.Warning {
+				t.Errorf("parent severity = %v, want Warning", g.Parent.Severity)
+			}
+			if late && g.Parent.Severity != logging.Info {
+				t.Errorf("parent severity = %v, want Info", g.Parent.Severity)
+			}
+		}
+	}
+}
+
+func TestRequestGolden(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		glbr.Infof(r.Context(), "start")
+		glbr.Warningf(r.Context(), "slow dependency")
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	res, group := glbrtest.Request(handler, httptest.NewRequest("GET", "/golden", nil))
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d", res.StatusCode)
+	}
+	glbrtest.AssertGolden(t, "testdata/request.golden", group.Entries())
+}
+
+func TestServer(t *testing.T) {
+	srv, err := glbrtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	log, err := glbr.NewLogging("project-id", "LogID", srv.ClientOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := log.Context()
+	for i := 0; i < 3; i++ {
+		glbr.Infof(c, "entry %d", i)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(srv.Entries()); got != 3 {
+		t.Errorf("entries = %d, want 3", got)
+	}
+}
+
+// ボディのないレスポンスはContent-Lengthに満たなくても打ち切られていない
+func TestResponseNotTruncated(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		status int
+	}{
+		{"HEAD", http.StatusOK},
+		{"GET", http.StatusNoContent},
+		{"GET", http.StatusNotModified},
+	} {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "42")
+			w.WriteHeader(tc.status)
+		})
+		_, group := glbrtest.Request(handler, httptest.NewRequest(tc.method, "/", nil))
+		if group.Parent.Labels["response_truncated"] != "" {
+			t.Errorf("%s %d: response_truncated = %q", tc.method, tc.status, group.Parent.Labels["response_truncated"])
+		}
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "42")
+		w.Write([]byte("short"))
+	})
+	_, group := glbrtest.Request(handler, httptest.NewRequest("GET", "/", nil))
+	if group.Parent.Labels["response_truncated"] != "true" {
+		t.Error("short GET response is not truncated")
+	}
+}
+
+// 接続に失敗した外部呼び出しもWarningで出力される
+func TestClientTraceConnectError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", "http://"+addr+"/", nil)
+		if res, err := http.DefaultClient.Do(glbr.WithClientTrace(req)); err == nil {
+			res.Body.Close()
+		}
+	})
+	_, group := glbrtest.Request(handler, httptest.NewRequest("GET", "/", nil))
+	if len(group.Children) != 1 || group.Children[0].Severity != logging.Warning {
+		t.Fatalf("children = %+v, want 1 Warning", group.Children)
+	}
+}
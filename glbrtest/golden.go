@@ -0,0 +1,140 @@
+package glbrtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+// UpdateEnv 設定されている場合、AssertGoldenはgolden fileを更新する
+//
+//	GLBRTEST_UPDATE=1 go test ./...
+const UpdateEnv = "GLBRTEST_UPDATE"
+
+// canonicalEntry golden fileに書き込むエントリ
+// timestamp, trace, spanId, insertId, latency等の実行毎に変わる値は含めない
+type canonicalEntry struct {
+	Severity    string            `json:"severity"`
+	Payload     interface{}       `json:"payload,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	HTTPRequest *canonicalRequest `json:"httpRequest,omitempty"`
+}
+
+type canonicalRequest struct {
+	Method       string `json:"method,omitempty"`
+	URL          string `json:"url,omitempty"`
+	Status       int    `json:"status"`
+	RequestSize  int64  `json:"requestSize,omitempty"`
+	ResponseSize int64  `json:"responseSize,omitempty"`
+	CacheHit     bool   `json:"cacheHit,omitempty"`
+}
+
+// Entries 親エントリ、子エントリの順に並べたエントリ
+func (g Group) Entries() []logging.Entry {
+	return append([]logging.Entry{g.Parent}, g.Children...)
+}
+
+// Canonical entriesを比較用のJSONにする
+// 実行毎に変わる値(parent_insert_idラベルを含む)を除き、キーを並べて整形する。volatileLabelsで指定したラベルも除く
+func Canonical(entries []logging.Entry, volatileLabels ...string) ([]byte, error) {
+	out := make([]canonicalEntry, 0, len(entries))
+	for _, entry := range entries {
+		ce := canonicalEntry{Severity: entry.Severity.String(), Payload: entry.Payload}
+		for k, v := range entry.Labels {
+			if k == "parent_insert_id" || contains(volatileLabels, k) {
+				continue
+			}
+			if ce.Labels == nil {
+				ce.Labels = map[string]string{}
+			}
+			ce.Labels[k] = v
+		}
+		if hr := entry.HTTPRequest; hr != nil {
+			cr := &canonicalRequest{
+				Status:       hr.Status,
+				RequestSize:  hr.RequestSize,
+				ResponseSize: hr.ResponseSize,
+				CacheHit:     hr.CacheHit,
+			}
+			if hr.Request != nil {
+				cr.Method = hr.Request.Method
+				cr.URL = hr.Request.URL.String()
+			}
+			ce.HTTPRequest = cr
+		}
+		out = append(out, ce)
+	}
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// AssertGolden entriesのCanonicalがgolden fileと一致することを確認する
+// 一致しない場合は差分を出力してテストを失敗させる。UpdateEnvが設定されている場合はgolden fileを書き換える
+//
+//	_, group := glbrtest.Request(handler, req)
+//	glbrtest.AssertGolden(t, "testdata/handler.golden", group.Entries())
+func AssertGolden(t testing.TB, path string, entries []logging.Entry, volatileLabels ...string) {
+	t.Helper()
+	got, err := Canonical(entries, volatileLabels...)
+	if err != nil {
+		t.Fatalf("glbrtest: %v", err)
+	}
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("glbrtest: %v", err)
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("glbrtest: %v", err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("glbrtest: %v (run with %s=1 to create)", err, UpdateEnv)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("glbrtest: entries differ from %s (-want +got):\n%s", path, Diff(string(want), string(got)))
+	}
+}
+
+// Diff wantとgotの行単位の差分
+// 共通の先頭と末尾を除き、異なる行を-と+で示す
+func Diff(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	head := 0
+	for head < len(w) && head < len(g) && w[head] == g[head] {
+		head++
+	}
+	tail := 0
+	for tail < len(w)-head && tail < len(g)-head && w[len(w)-1-tail] == g[len(g)-1-tail] {
+		tail++
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "@@ line %d @@\n", head+1)
+	for _, line := range w[head : len(w)-tail] {
+		fmt.Fprintf(&b, "-%s\n", line)
+	}
+	for _, line := range g[head : len(g)-tail] {
+		fmt.Fprintf(&b, "+%s\n", line)
+	}
+	return b.String()
+}
@@ -0,0 +1,155 @@
+package glbrtest
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/api/option"
+	logpb "google.golang.org/genproto/googleapis/logging/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server Cloud LoggingのLoggingServiceV2の偽物
+// WriteLogEntriesのリクエストを記録する。エラーやレート制限を発生させて、
+// クライアントのバンドル、リトライ、OnErrorを含めた経路をネットワークなしでテストする
+//
+//	srv, err := glbrtest.NewServer()
+//	defer srv.Close()
+//	log, err := glbr.NewLogging("project-id", "LogID", srv.ClientOptions()...)
+type Server struct {
+	addr string
+	gsrv *grpc.Server
+
+	mu        sync.Mutex
+	requests  []*logpb.WriteLogEntriesRequest
+	failures  []error
+	limit     int // 1秒あたりのWriteLogEntriesの上限。0で無制限
+	window    time.Time
+	windowCnt int
+}
+
+// NewServer ローカルのポートで偽物のサーバーを起動する
+func NewServer() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{addr: l.Addr().String(), gsrv: grpc.NewServer()}
+	logpb.RegisterLoggingServiceV2Server(s.gsrv, (*loggingServer)(s))
+	go s.gsrv.Serve(l)
+	return s, nil
+}
+
+// Addr サーバーのアドレス
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// ClientOptions サーバーに接続するためのNewLoggingのオプション
+func (s *Server) ClientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(s.addr),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithInsecure()),
+	}
+}
+
+// Close サーバーを停止する
+func (s *Server) Close() {
+	s.gsrv.Stop()
+}
+
+// Requests 成功したWriteLogEntriesのリクエスト
+func (s *Server) Requests() []*logpb.WriteLogEntriesRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*logpb.WriteLogEntriesRequest(nil), s.requests...)
+}
+
+// Entries 成功したリクエストに含まれるエントリ
+func (s *Server) Entries() []*logpb.LogEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []*logpb.LogEntry
+	for _, req := range s.requests {
+		for _, e := range req.Entries {
+			if e.LogName == "" {
+				e.LogName = req.LogName
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Fail 以降のWriteLogEntriesを順にerrsで失敗させる
+// status.Errorで作成したエラーはそのコードでクライアントに返される
+//
+//	srv.Fail(status.Error(codes.Unavailable, "unavailable"), status.Error(codes.PermissionDenied, "denied"))
+func (s *Server) Fail(errs ...error) {
+	s.mu.Lock()
+	s.failures = append(s.failures, errs...)
+	s.mu.Unlock()
+}
+
+// RateLimit 1秒あたりのWriteLogEntriesをperSecond回に制限する
+// 超過したリクエストはResourceExhaustedで失敗する。0以下で無制限
+func (s *Server) RateLimit(perSecond int) {
+	s.mu.Lock()
+	s.limit = perSecond
+	s.mu.Unlock()
+}
+
+// Reset 記録したリクエストと設定したエラー、レート制限を破棄する
+func (s *Server) Reset() {
+	s.mu.Lock()
+	s.requests, s.failures, s.limit = nil, nil, 0
+	s.mu.Unlock()
+}
+
+// loggingServer logpb.LoggingServiceV2Serverの実装
+type loggingServer Server
+
+func (ls *loggingServer) WriteLogEntries(_ context.Context, req *logpb.WriteLogEntriesRequest) (*logpb.WriteLogEntriesResponse, error) {
+	s := (*Server)(ls)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if 0 < len(s.failures) {
+		err := s.failures[0]
+		s.failures = s.failures[1:]
+		return nil, err
+	}
+	if 0 < s.limit {
+		now := time.Now()
+		if now.Sub(s.window) >= time.Second {
+			s.window, s.windowCnt = now, 0
+		}
+		if s.limit <= s.windowCnt {
+			return nil, status.Error(codes.ResourceExhausted, "glbrtest: rate limit exceeded")
+		}
+		s.windowCnt++
+	}
+	s.requests = append(s.requests, req)
+	return &logpb.WriteLogEntriesResponse{}, nil
+}
+
+func (ls *loggingServer) DeleteLog(context.Context, *logpb.DeleteLogRequest) (*empty.Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "glbrtest: DeleteLog")
+}
+
+func (ls *loggingServer) ListLogEntries(context.Context, *logpb.ListLogEntriesRequest) (*logpb.ListLogEntriesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "glbrtest: ListLogEntries")
+}
+
+func (ls *loggingServer) ListMonitoredResourceDescriptors(context.Context, *logpb.ListMonitoredResourceDescriptorsRequest) (*logpb.ListMonitoredResourceDescriptorsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "glbrtest: ListMonitoredResourceDescriptors")
+}
+
+func (ls *loggingServer) ListLogs(context.Context, *logpb.ListLogsRequest) (*logpb.ListLogsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "glbrtest: ListLogs")
+}
@@ -0,0 +1,54 @@
+package glbrtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/KawanoTakayuki/glbr"
+)
+
+// Stress handlerをGroupedByの内側でconcurrency個のgoroutineからそれぞれiterations回実行し、リクエスト毎のグループを返す
+// go test -raceで実行し、handlerや設定したミドルウェアのデータ競合を検出する。親エントリはWithAsyncParentで非同期に出力される
+//
+//	groups := glbrtest.Stress(handler, func() *http.Request { return httptest.NewRequest("GET", "/", nil) }, 16, 100)
+//	if len(groups) != 1600 { ... }
+func Stress(handler http.Handler, newRequest func() *http.Request, concurrency, iterations int, configure ...func(glbr.Service) glbr.Service) []Group {
+	log, rec, err := glbr.NewRecorder(LogID)
+	if err != nil {
+		panic(err)
+	}
+	log = log.WithAsyncParent(concurrency, concurrency)
+	for _, fn := range configure {
+		log = fn(log)
+	}
+	h := glbr.Chain(log.Recover(), log.GroupedBy(ParentLogID))(handler)
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				h.ServeHTTP(httptest.NewRecorder(), newRequest())
+			}
+		}()
+	}
+	wg.Wait()
+	log.Close()
+
+	children := map[string][]glbr.RecordedEntry{}
+	for _, e := range rec.All() {
+		if e.LogID == LogID {
+			children[e.Entry.Trace] = append(children[e.Entry.Trace], e)
+		}
+	}
+	var groups []Group
+	for _, parent := range rec.Entries(ParentLogID) {
+		g := Group{Parent: parent}
+		for _, e := range children[parent.Trace] {
+			g.Children = append(g.Children, e.Entry)
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
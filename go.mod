@@ -2,6 +2,9 @@ module github.com/KawanoTakayuki/glbr
 
 require (
 	cloud.google.com/go v0.39.0
+	github.com/golang/protobuf v1.3.1
+	golang.org/x/sys v0.0.0-20190507160741-ecd444e8653b
 	google.golang.org/api v0.7.0
 	google.golang.org/genproto v0.0.0-20190605220351-eb0b1bdb6ae6
+	google.golang.org/grpc v1.20.1
 )
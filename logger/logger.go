@@ -0,0 +1,60 @@
+// Package logger ライブラリ向けの最小限のlogger
+// 標準ライブラリ以外に依存しないため、ライブラリはglbrやCloud Loggingのクライアントに依存せずにログを出力できる
+// アプリケーションがglbrをimportすると、glbrのserviceに出力する実装が登録される
+//
+//	func (c *Client) Do(ctx context.Context) {
+//		log := logger.FromContextOrNop(ctx)
+//		log.Debugf("request %s", c.url)
+//	}
+package logger
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Logger ライブラリ向けの最小限のlogger
+type Logger interface {
+	Debugf(format string, value ...interface{})
+	Infof(format string, value ...interface{})
+	Warningf(format string, value ...interface{})
+	Errorf(format string, value ...interface{})
+}
+
+// nop 何も出力しないLogger
+type nop struct{}
+
+func (nop) Debugf(string, ...interface{})   {}
+func (nop) Infof(string, ...interface{})    {}
+func (nop) Warningf(string, ...interface{}) {}
+func (nop) Errorf(string, ...interface{})   {}
+
+// Nop 何も出力しないLogger
+func Nop() Logger {
+	return nop{}
+}
+
+// provider Registerで登録された実装
+var provider atomic.Value // func(c context.Context) Logger
+
+// Register cに設定されたloggerを返す実装を登録する
+// 実装はcにloggerが設定されていない場合はnilを返す。glbrはimport時に登録する
+func Register(fromContext func(c context.Context) Logger) {
+	provider.Store(fromContext)
+}
+
+// FromContextOrNop cに設定されたloggerを返す
+// 実装が登録されていない場合や、cにloggerが設定されていない場合、cがnilの場合は何も出力しないLoggerを返す
+func FromContextOrNop(c context.Context) Logger {
+	if c == nil {
+		return nop{}
+	}
+	fromContext, _ := provider.Load().(func(c context.Context) Logger)
+	if fromContext == nil {
+		return nop{}
+	}
+	if l := fromContext(c); l != nil {
+		return l
+	}
+	return nop{}
+}
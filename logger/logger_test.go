@@ -0,0 +1,37 @@
+package logger_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KawanoTakayuki/glbr/logger"
+)
+
+type recorder struct {
+	logger.Logger
+	messages []string
+}
+
+func (r *recorder) Infof(format string, value ...interface{}) {
+	r.messages = append(r.messages, format)
+}
+
+type key struct{}
+
+func TestFromContextOrNop(t *testing.T) {
+	logger.FromContextOrNop(nil).Infof("nil context")
+	logger.FromContextOrNop(context.Background()).Infof("not registered")
+
+	r := &recorder{Logger: logger.Nop()}
+	logger.Register(func(c context.Context) logger.Logger {
+		if c.Value(key{}) == nil {
+			return nil
+		}
+		return r
+	})
+	logger.FromContextOrNop(context.Background()).Infof("no logger")
+	logger.FromContextOrNop(context.WithValue(context.Background(), key{}, true)).Infof("logged")
+	if len(r.messages) != 1 || r.messages[0] != "logged" {
+		t.Errorf("messages = %v", r.messages)
+	}
+}
@@ -1,37 +1,90 @@
 package glbr
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
+	"log"
 	"math/rand"
+	"net"
 	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/logging"
 	"google.golang.org/api/option"
+	"google.golang.org/genproto/googleapis/api/monitoredres"
 )
 
 // Service loggingService
 type Service struct {
-	ctx    context.Context
-	client *logging.Client
-	option []logging.LoggerOption
-	logID  string
+	ctx                context.Context
+	client             *logging.Client
+	option             []logging.LoggerOption
+	logID              string
+	resource           *monitoredres.MonitoredResource
+	proto              *protoClient
+	loggers            *loggerCache
+	emitter            *emitter
+	closer             *closer
+	usage              *usage
+	accessLog          AccessLogFormat
+	userAgent          bool
+	geo                GeoResolver
+	trustedProxies     []*net.IPNet
+	cacheHeaders       []string
+	parentHooks        []ParentEntryHook
+	emptyURL           string
+	connInfo           bool
+	streamInterval     time.Duration
+	idempotencyHeaders []string
+	recorder           *Recorder
+	traceHeaders       *UnsampledPolicy
+	baggageKeys        []string
+	projects           *projectPool
+	projectSelector    func(r *http.Request) string
+	cmek               *cmekExpectation
+	tenants            *tenants
+	slow               *slowWatch
+	inflight           bool
+	debugBuffer        *debugBuffering
+	escalation         *escalation
+	snapshotLimit      int
+	replay             *replayer
+	canonical          bool
+	fieldPolicy        *fieldPolicy
+	noop               bool
+	debugHeader        *debugHeader
+	sampler            *sampler
 }
 
 // NewLogging 新しいLoggingServiceを取得する
+// projectIDの代わりにFolder, Organization, BillingAccountで書き込み先を指定できる
 func NewLogging(projectID, logID string, opts ...option.ClientOption) (service Service, err error) {
+	if noOpBuild {
+		return NewNoOp(), nil
+	}
 	c := context.Background()
-	if logID == "" || 512 <= len(logID) {
-		return Service{}, fmt.Errorf("logID empty or more than 512 char")
+	if err := validateLogID(logID); err != nil {
+		return Service{}, err
 	}
 	client, err := logging.NewClient(c, projectID, opts...)
+	if err != nil {
+		return Service{}, err
+	}
 	service = Service{
-		ctx:    c,
-		client: client,
-		option: make([]logging.LoggerOption, 0),
-		logID:  logID,
+		ctx:      c,
+		client:   client,
+		option:   make([]logging.LoggerOption, 0),
+		logID:    logID,
+		proto:    newProtoClient(projectID, opts),
+		loggers:  newLoggerCache(),
+		projects: newProjectPool(projectID, opts),
+		closer:   &closer{done: make(chan struct{})},
+		usage:    newUsage(),
 	}
 	return
 }
@@ -39,66 +92,541 @@ func NewLogging(projectID, logID string, opts ...option.ClientOption) (service S
 // WithContext 他のcontextを受け入れる
 func (s Service) WithContext(c context.Context) Service {
 	if c == nil {
-		panic("nil context")
-	}
-	if logger, ok := getLogger(s.ctx); ok {
-		c = setLogger(c, logger)
-	}
-	if severity, ok := getSeverity(s.ctx); ok {
-		c = setSeverity(c, severity)
-	}
-	if trace, ok := getTraceID(s.ctx); ok {
-		c = setTraceID(c, trace)
-	}
-	if iowrite, ok := getIOWriter(s.ctx); ok {
-		c = setIOWriter(c, iowrite)
-	}
-	if group, ok := getGroup(s.ctx); ok {
-		c = setGroup(c, group)
+		panic(ErrNilContext)
 	}
+	c = mergeState(c, s.ctx)
 	s.ctx = c
 	return s
 }
 
 // WithIOWriter write buffer after log output
+// AddIOWriterで追加した出力先は置き換えられる
 func (s Service) WithIOWriter(w io.Writer) Service {
 	s.ctx = setIOWriter(s.ctx, w)
 	return s
 }
 
+// mirror エントリの出力先
+type mirror struct {
+	w       io.Writer
+	minimum logging.Severity
+	format  Formatter
+	grouped bool // グループの子エントリを親エントリの下にまとめて書き込む
+}
+
+// write formatがnilの場合はfallback、fallbackもnilの場合はTextFormatで書き込む
+func (m mirror) write(entry logging.Entry, fallback Formatter) {
+	format := m.format
+	if format == nil {
+		format = fallback
+	}
+	if format == nil {
+		format = TextFormat
+	}
+	format(m.w, entry)
+}
+
+// AddIOWriter minimum以上のエントリをformatで書き込む出力先を追加する
+// formatがnilの場合はWithIOFormatの形式で書き込む
+//
+//	log = log.AddIOWriter(os.Stderr, logging.Warning, glbr.ConsoleFormat).AddIOWriter(debugFile, logging.Default, glbr.JSONFormat)
+func (s Service) AddIOWriter(w io.Writer, minimum logging.Severity, format Formatter) Service {
+	s.ctx = addIOWriter(s.ctx, mirror{w: w, minimum: minimum, format: format})
+	return s
+}
+
+// WithMinSeverity severity未満のエントリを出力しない
+// 出力されないエントリはフォーマットもされない Default: logging.Default(全て出力する)
+func (s Service) WithMinSeverity(severity logging.Severity) Service {
+	s.ctx = setMinSeverity(s.ctx, severity)
+	return s
+}
+
+// WithStreamInterval ストリーミング中(Flush済み)のレスポンスに対して、指定間隔で途中経過のエントリを親logIDへ出力する
+// 0以下で無効 Default: 0
+func (s Service) WithStreamInterval(interval time.Duration) Service {
+	s.streamInterval = interval
+	return s
+}
+
 // Context log service context
 func (s Service) Context() context.Context {
-	return setLogger(s.ctx, s.client.Logger(s.logID, s.option...))
+	proto := s.protoLogger(s.logID)
+	return updateState(s.ctx, func(st *state) {
+		st.logger = s.logger(s.logID)
+		st.usage = &usageMeter{usage: s.usage, logID: s.logID}
+		st.proto = &proto
+		st.projects = func(projectID string) entryLogger { return s.projectLogger(projectID, s.logID) }
+	})
+}
+
+// protoLogger ProtoPayloadを書き込むlogger
+func (s Service) protoLogger(logID string) protoLogger {
+	return protoLogger{client: s.proto, logID: logID, resource: s.resource}
+}
+
+// Ping Cloud Loggingへの接続と書き込み権限(logging.logEntries.create)を確認する
+// 起動時のprobeで使う。"ping"ログにエントリを1件書き込む
+func (s Service) Ping(c context.Context) error {
+	if s.client == nil {
+		return nil
+	}
+	if err := s.client.Ping(c); err != nil {
+		return fmt.Errorf("logging ping failed: %w", err)
+	}
+	return nil
+}
+
+// closer serviceを一度だけ閉じる
+type closer struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+
+	mu      sync.Mutex
+	closing bool           // Shutdownの開始後
+	pending sync.WaitGroup // Goで起動されたgoroutineを待つ親エントリの出力
+}
+
+// background fnをgoroutineで実行し、Shutdownで終了を待つ
+// Shutdownの開始後はfnを実行せずfalseを返す
+func (cl *closer) background(fn func()) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.closing {
+		return false
+	}
+	cl.pending.Add(1)
+	go func() {
+		defer cl.pending.Done()
+		fn()
+	}()
+	return true
+}
+
+// drain backgroundで実行中のfnの終了を待つ
+func (cl *closer) drain() {
+	cl.mu.Lock()
+	cl.closing = true
+	cl.mu.Unlock()
+	cl.pending.Wait()
+}
+
+// Shutdown serviceを閉じる
+// バッファに残ったエントリを送信してから閉じる。cが先に終了した場合は、送信できなかった可能性のあるエントリのlogIDを
+// 標準のloggerに出力してcのエラーを返す。送信は継続される。複数回呼び出しても安全
+func (s Service) Shutdown(c context.Context) error {
+	s.closer.once.Do(func() {
+		go func() {
+			defer close(s.closer.done)
+			s.closer.drain()
+			s.emitter.close()
+			st, _ := getState(s.ctx)
+			if st.tracer != nil {
+				st.tracer.close()
+			}
+			if st.live != nil {
+				st.live.close()
+			}
+			if st.notifier != nil {
+				st.notifier.close()
+			}
+			s.loggers.mu.Lock()
+			for key, logger := range s.loggers.loggers {
+				if logger.Flush() == nil {
+					s.usage.flushed(key.logID)
+				}
+			}
+			s.loggers.mu.Unlock()
+			err := s.proto.close()
+			if s.client != nil {
+				if cerr := s.client.Close(); err == nil {
+					err = cerr
+				}
+			}
+			if cerr := s.projects.close(); err == nil {
+				err = cerr
+			}
+			if cerr := closeSinks(st.sinks); err == nil {
+				err = cerr
+			}
+			if s.replay != nil {
+				if cerr := s.replay.sink.Close(); err == nil {
+					err = cerr
+				}
+			}
+			s.closer.err = err
+		}()
+	})
+	select {
+	case <-s.closer.done:
+		return s.closer.err
+	case <-c.Done():
+		log.Printf("glbr: shutdown %v, entries of %v may be abandoned", c.Err(), s.usage.pendingLogIDs())
+		return c.Err()
+	}
 }
 
 // Close serviceを閉じる
+// バッファに残ったエントリの送信が終わるまで待つ。複数回呼び出しても安全
 func (s Service) Close() (err error) {
-	return s.client.Close()
+	return s.Shutdown(context.Background())
+}
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
 }
 
 // NewTraceID 新しいTraceIDを返す
 func newTraceID() string {
-	rand.Seed(time.Now().UnixNano())
-	return fmt.Sprintf("%d", rand.Uint64())
+	return strconv.FormatUint(rand.Uint64(), 10)
+}
+
+// loggerCache プロジェクトとlogID毎のlogger
+// logging.Loggerはlogger毎にバッファを持つため、同じlogIDとオプションのloggerを使い回す
+type loggerCache struct {
+	mu      sync.Mutex
+	loggers map[loggerKey]entryLogger
+}
+
+// loggerKey projectIDが空の場合はNewLoggingのプロジェクト
+type loggerKey struct {
+	projectID string
+	logID     string
+}
+
+func newLoggerCache() *loggerCache {
+	return &loggerCache{loggers: map[loggerKey]entryLogger{}}
+}
+
+// logger logIDのloggerを返す
+func (s Service) logger(logID string) entryLogger {
+	return s.projectLogger("", logID)
+}
+
+// projectLogger projectIDのプロジェクトのlogIDのloggerを返す
+// projectIDが空の場合はNewLoggingのプロジェクト。NewLocalで作成したserviceはエントリを送信せず、
+// NewRecorderで作成したserviceはRecorderに記録する
+func (s Service) projectLogger(projectID, logID string) entryLogger {
+	if s.projects == nil || projectID == "" || logParent(projectID) == logParent(s.projects.defaultID) {
+		projectID = ""
+	}
+	key := loggerKey{projectID: projectID, logID: logID}
+	s.loggers.mu.Lock()
+	defer s.loggers.mu.Unlock()
+	logger, ok := s.loggers.loggers[key]
+	if !ok {
+		switch {
+		case s.recorder != nil:
+			logger = recordLogger{recorder: s.recorder, logID: logID}
+		case s.client == nil:
+			logger = discardLogger{}
+		case projectID == "":
+			logger = s.client.Logger(logID, s.option...)
+		default:
+			client, err := s.projects.client(projectID)
+			if err != nil {
+				log.Printf("glbr: project %s: %v, entries are discarded", projectID, err)
+				logger = discardLogger{}
+				break
+			}
+			logger = client.Logger(logID, s.option...)
+		}
+		s.loggers.loggers[key] = logger
+	}
+	return logger
 }
 
 // http.ResponseWriter interface
+// handlerから起動された複数のgoroutineから書き込まれても安全なように、originへの書き込みはwmuで直列化する
 type logResponse struct {
-	body   []byte
-	code   int
-	origin http.ResponseWriter
+	wmu      sync.Mutex // originへの書き込み
+	mu       sync.Mutex
+	size     int64
+	code     int   // 送信したステータスコード。未送信の場合は0
+	implicit bool  // WriteHeaderを呼ばずにWriteしたため200を送信した
+	started  bool  // WriteHeaderまたはWriteが呼ばれた
+	writeErr error // Writeで発生した最初のエラー
+	flushed  bool
+	hijacked bool
+	caller   string          // 最初にWriteHeaderまたはWriteを呼び出した箇所
+	ctx      context.Context // 誤った使い方を出力するグループ
+	origin   http.ResponseWriter
 }
 
 func (lr *logResponse) Header() http.Header {
 	return lr.origin.Header()
 }
 func (lr *logResponse) Write(body []byte) (int, error) {
-	lr.body = body
-	return lr.origin.Write(body)
+	lr.mu.Lock()
+	if lr.hijacked {
+		lr.mu.Unlock()
+		lr.misuse("write_after_hijack", "http: response.Write on hijacked connection", 0)
+		return 0, http.ErrHijacked
+	}
+	if !lr.started {
+		lr.code, lr.implicit = http.StatusOK, true // net/httpと同じく最初のWriteで200を送信する
+		lr.caller = callerLocation(2)
+	}
+	lr.started = true
+	lr.mu.Unlock()
+	lr.wmu.Lock()
+	n, err := lr.origin.Write(body)
+	lr.wmu.Unlock()
+	lr.mu.Lock()
+	lr.size += int64(n)
+	if err != nil && lr.writeErr == nil {
+		lr.writeErr = err
+	}
+	lr.mu.Unlock()
+	return n, err
 }
+
+// 1xx(101を除く)は最終的なステータスではないため記録しない。2回目以降の呼び出しはnet/httpと同じく無視される
+// 2回目の呼び出しとHijack後の呼び出しは呼び出し箇所と共にWarningで出力する
 func (lr *logResponse) WriteHeader(statusCode int) {
-	lr.code = statusCode
+	lr.mu.Lock()
+	switch {
+	case lr.hijacked:
+		lr.mu.Unlock()
+		lr.misuse("write_header_after_hijack", "http: response.WriteHeader on hijacked connection", statusCode)
+		return
+	case lr.started && !informational(statusCode):
+		lr.mu.Unlock()
+		lr.misuse("superfluous_write_header", "http: superfluous response.WriteHeader call", statusCode)
+		return
+	case !informational(statusCode):
+		lr.code = statusCode
+		lr.started = true
+		lr.caller = callerLocation(2)
+	}
+	lr.mu.Unlock()
+	lr.wmu.Lock()
 	lr.origin.WriteHeader(statusCode)
+	lr.wmu.Unlock()
+}
+
+// Flush http.Flusher interface
+func (lr *logResponse) Flush() {
+	if f, ok := lr.origin.(http.Flusher); ok {
+		lr.mu.Lock()
+		if !lr.started {
+			lr.code, lr.implicit = http.StatusOK, true
+		}
+		lr.started = true
+		lr.flushed = true
+		lr.mu.Unlock()
+		lr.wmu.Lock()
+		f.Flush()
+		lr.wmu.Unlock()
+	}
+}
+
+// status 現在のステータスコードと書き込み済みサイズ、ストリーミング中かどうか
+func (lr *logResponse) status() (code int, size int64, flushed bool) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.code, lr.size, lr.flushed
+}
+
+// Hijack http.Hijacker interface
+// 以降のWrite, WriteHeaderはhttp.ErrHijackedを返し、Warningで出力する
+func (lr *logResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := lr.origin.(http.Hijacker)
+	if !ok {
+		return nil, nil, ErrNotHijacker
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		lr.mu.Lock()
+		lr.hijacked = true
+		lr.mu.Unlock()
+	}
+	return conn, rw, err
+}
+
+// responseMisuse ResponseWriterの誤った使い方のペイロード
+type responseMisuse struct {
+	Kind        string `json:"kind"`
+	Status      int    `json:"status,omitempty"`       // 無視されたステータスコード
+	FirstStatus int    `json:"first_status,omitempty"` // 送信済みのステータスコード
+	Caller      string `json:"caller"`
+	FirstCaller string `json:"first_caller,omitempty"` // 最初にレスポンスを書き込んだ箇所
+}
+
+// misuse ResponseWriterの誤った使い方を呼び出し箇所と共にWarningで出力する
+func (lr *logResponse) misuse(kind, message string, status int) {
+	if lr.ctx == nil {
+		return
+	}
+	lr.mu.Lock()
+	record := responseMisuse{Kind: kind, Status: status, FirstStatus: lr.code, Caller: callerLocation(3), FirstCaller: lr.caller}
+	lr.mu.Unlock()
+	sendPayload(lr.ctx, logging.Warning, versioned(map[string]interface{}{
+		"message":         message + " from " + record.Caller,
+		"response_misuse": record,
+	}), nil)
+}
+
+// callerLocation skip段上の呼び出し元の "関数名 (ファイル:行)"
+func callerLocation(skip int) string {
+	pc, file, line, ok := runtime.Caller(skip)
+	if !ok {
+		return "unknown"
+	}
+	name := "unknown"
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		name = fn.Name()
+	}
+	return fmt.Sprintf("%s (%s:%d)", name, file, line)
+}
+
+// informational 1xxの中間レスポンス(101 Switching Protocolsを除く)
+func informational(code int) bool {
+	return 100 <= code && code < 200 && code != http.StatusSwitchingProtocols
+}
+
+// written レスポンスの送信方法
+// explicit: WriteHeaderで送信した, implicit: WriteHeaderを呼ばずにWriteした, none: 何も送信していない
+func (lr *logResponse) written() string {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	switch {
+	case !lr.started:
+		return "none"
+	case lr.implicit:
+		return "implicit"
+	default:
+		return "explicit"
+	}
+}
+
+// StatusClientClosedRequest レスポンスを送信する前にクライアントが切断したリクエストのステータス(nginxの499)
+const StatusClientClosedRequest = 499
+
+// wroteHeader レスポンスの送信を開始したかどうか
+func (lr *logResponse) wroteHeader() bool {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.started
+}
+
+// truncated レスポンスが途中で打ち切られたかどうか
+// Writeのエラー、またはContent-Lengthに満たないボディを検出する
+// HEADリクエストと、1xx, 204, 304のレスポンスはボディがないためContent-Lengthと比較しない
+func (lr *logResponse) truncated(method string) bool {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if lr.writeErr != nil {
+		return true
+	}
+	if method == http.MethodHead || !bodyAllowed(lr.code) {
+		return false
+	}
+	if cl, err := strconv.ParseInt(lr.origin.Header().Get("Content-Length"), 10, 64); err == nil && lr.size < cl {
+		return true
+	}
+	return false
+}
+
+// bodyAllowed ステータスコードのレスポンスがボディを持てるかどうか
+func bodyAllowed(code int) bool {
+	switch {
+	case 100 <= code && code < 200:
+		return false
+	case code == http.StatusNoContent, code == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// watchStream ストリーミング中のレスポンスの途中経過を出力する
+func (s Service) watchStream(parentLogID string, parent entryLogger, r *http.Request, res *logResponse, traceID string, st time.Time) (stop func()) {
+	if s.streamInterval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	clock := clockFrom(s.ctx)
+	ticker := time.NewTicker(s.streamInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				now := clock.Now()
+				code, size, flushed := res.status()
+				if !flushed {
+					continue
+				}
+				entry := logging.Entry{
+					Payload: "still streaming",
+					HTTPRequest: &logging.HTTPRequest{
+						Status:       code,
+						ResponseSize: size,
+						Request:      r,
+						Latency:      now.Sub(st),
+					},
+					Timestamp: now,
+					Trace:     traceID,
+					Severity:  logging.Default,
+				}
+				s.usage.add(parentLogID, entry)
+				parent.Log(entry)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// cancelWatcher リクエストのキャンセルを監視する
+type cancelWatcher struct {
+	done chan struct{}
+	mu   sync.Mutex
+	err  error
+	at   time.Time
+}
+
+func watchCancel(c context.Context, clock Clock) *cancelWatcher {
+	w := &cancelWatcher{done: make(chan struct{})}
+	go func() {
+		select {
+		case <-c.Done():
+			w.mu.Lock()
+			w.err = c.Err()
+			w.at = clock.Now()
+			w.mu.Unlock()
+		case <-w.done:
+		}
+	}()
+	return w
+}
+
+// stop 監視を終了し、処理中にキャンセルされた場合はその理由と時刻を返す
+func (w *cancelWatcher) stop() (time.Time, error) {
+	close(w.done)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.at, w.err
+}
+
+// cancelLabels キャンセル理由を親エントリのラベルにする
+// client_disconnect: クライアントの切断, server_timeout: サーバー側のタイムアウト
+func cancelLabels(err error, at, st time.Time) map[string]string {
+	labels := map[string]string{}
+	switch err {
+	case nil:
+		return labels
+	case context.Canceled:
+		labels["cancel"] = "client_disconnect"
+	case context.DeadlineExceeded:
+		labels["cancel"] = "server_timeout"
+	default:
+		labels["cancel"] = err.Error()
+	}
+	labels["cancel_elapsed"] = at.Sub(st).String()
+	return labels
 }
 
 // GroupingHandler グループ化される処理
@@ -107,47 +635,226 @@ type GroupingHandler func(http.Handler) http.Handler
 // GroupedBy ログをリクエストでグループ化する
 func (s Service) GroupedBy(parentLogID string) GroupingHandler {
 	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if _, ok := getGroup(r.Context()); ok {
-				next.ServeHTTP(w, r) // already in the group
-				return
-			}
+		if _, ok := next.(*groupHandler); ok {
+			panic(ErrAlreadyGrouped)
+		}
+		if parentLogID == "" {
+			panic(ErrEmptyParentLogID)
+		}
+		if s.logID == parentLogID {
+			panic(ErrSameLogID)
+		}
+		if s.noop {
+			return next
+		}
+		return &groupHandler{s: s, parentLogID: parentLogID, parent: s.logger(parentLogID), next: next}
+	}
+}
 
-			if r == nil {
-				panic("http.Request is nil")
-			}
-			if parentLogID == "" {
-				panic("empty to parentLogID")
+// groupHandler GroupedByで作成されるhandler
+type groupHandler struct {
+	active      int64 // 処理中のリクエスト数。atomicで操作するため先頭に置く
+	s           Service
+	parentLogID string
+	parent      entryLogger // middlewareの作成時に一度だけ作成する
+	next        http.Handler
+}
+
+// serve handlerのpanicを回復して返す
+func serve(next http.Handler, w http.ResponseWriter, r *http.Request) (recovered interface{}) {
+	defer func() {
+		recovered = recover()
+	}()
+	next.ServeHTTP(w, r)
+	return nil
+}
+
+func (h *groupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s, parentLogID, parent, next := h.s, h.parentLogID, h.parent, h.next
+	if r == nil {
+		panic(ErrNilRequest)
+	}
+	if _, ok := getGroup(r.Context()); ok {
+		next.ServeHTTP(w, r) // already in the group
+		return
+	}
+
+	inflight, leave := h.enter()
+	res := &logResponse{origin: w}
+	debug := s.debugHeader.verify(r, clockFrom(s.ctx).Now())
+	g, tr := s.newRequestGroup(r)
+	g.response = res
+	g.insertID = s.parentInsertID(parentLogID, r)
+	if debug == debugAccepted {
+		g.debug = nil // 詳細なログを出力するため、Debugのエントリを保持しない
+	}
+	traceID := g.id
+	dropped := false
+	ctx := updateState(s.Context(), func(st *state) {
+		st.traceID = &traceID
+		st.span = nil
+		st.group = g
+		st.baggage = parseBaggage(r.Header, s.baggageKeys)
+		s.applySampling(st, g)
+		dropped = s.sampler.apply(st, g)
+		if debug == debugAccepted {
+			st.minimum, st.debugging = s.debugHeader.opts.MinSeverity, true
+		}
+	})
+	if s.projectSelector != nil {
+		if projectID := s.projectSelector(r); projectID != "" {
+			ctx = ForProject(ctx, projectID)
+			parent = s.projectLogger(projectID, parentLogID)
+		}
+	}
+	res.ctx = ctx
+
+	clock := clockFrom(ctx)
+	st := clock.Now()
+	stop := s.watchStream(parentLogID, parent, r, res, traceID, st)
+	stopSlow := s.watchSlow(ctx, st)
+	cw := watchCancel(r.Context(), clock)
+	bodyLimit := s.replay.bodyLimit()
+	if debug == debugAccepted {
+		bodyLimit = s.debugHeader.bodyLimit(bodyLimit)
+	}
+	nr, body := wrapBody(r.WithContext(ctx), bodyLimit)
+	recovered := serve(next, res, nr)
+	if recovered != nil && recovered != http.ErrAbortHandler {
+		logPanic(ctx, recovered)
+	}
+	stopSlow()
+	leave()
+	canceledAt, cancelErr := cw.stop()
+	stop()
+	et := clock.Now()
+	code, size, _ := res.status()
+	written := res.written()
+	if code == 0 {
+		code = http.StatusOK // handlerが何も書き込まずに終了した場合はnet/httpが200を送信する
+		if cancelErr == context.Canceled || r.Context().Err() == context.Canceled {
+			code = StatusClientClosedRequest
+		}
+	}
+	truncated := res.truncated(r.Method)
+	header := w.Header().Clone()
+
+	emit := func() {
+		g.wait()
+		discarded := 0
+		if s.debugBuffer != nil {
+			discarded = g.releaseDebug(recovered != nil || truncated || s.debugBuffer.keep(g.maxSeverity(), code, et.Sub(st)))
+		}
+		g.close()
+		severity := g.maxSeverity()
+		labels := g.annotations()
+		if 0 < discarded {
+			labels["debug_discarded"] = strconv.Itoa(discarded)
+		}
+		for k, v := range cancelLabels(cancelErr, canceledAt, st) {
+			labels[k] = v
+		}
+		if budget, ok := g.timedOut(); ok {
+			if severity < logging.Warning {
+				severity = logging.Warning
 			}
-			if s.logID == parentLogID {
-				panic("do not make parentLogID and the argument logID of 'NewLogging' functin identical")
+			labels["timeout"] = "true"
+			labels["timeout_budget"] = budget.String()
+		}
+		if g.lateError() || truncated {
+			if severity < logging.Error {
+				severity = logging.Error
 			}
-
-			severity := logging.Default
-			traceID := newTraceID()
-			ctx := s.Context()
-			ctx = setSeverity(ctx, &severity)
-			ctx = setTraceID(ctx, &traceID)
-			ctx = setGroup(ctx, traceID)
-
-			res := &logResponse{code: http.StatusOK, origin: w}
-			st := time.Now()
-			next.ServeHTTP(res, r.WithContext(ctx))
-			et := time.Now()
-			if r.URL.String() == "" {
-				r.URL.Path = "Empty_RequestUrl"
+			labels["response_truncated"] = "true"
+		}
+		if recovered != nil {
+			labels["panic"] = "true"
+			if code == http.StatusOK {
+				code = http.StatusInternalServerError
 			}
-			s.client.Logger(parentLogID, s.option...).Log(logging.Entry{
-				HTTPRequest: &logging.HTTPRequest{
-					Status:       res.code,
-					ResponseSize: int64(len(res.body)),
-					Request:      r,
-					Latency:      et.Sub(st),
-				},
-				Timestamp: et,
-				Trace:     traceID,
-				Severity:  severity,
+		}
+		labels = baggageLabels(labels, parseBaggage(r.Header, s.baggageKeys))
+		contentTypeLabels(labels, r, header)
+		protocolLabels(labels, r)
+		s.connLabels(labels, r)
+		inflightLabels(labels, inflight)
+		g.violationLabel(labels)
+		if written != "explicit" {
+			labels["response_written"] = written
+		}
+		if debug != debugAbsent {
+			labels["debug_request"] = debug.String()
+		}
+		if dropped && debug != debugAccepted {
+			labels["sampled"] = "false"
+		}
+		rst, _ := getState(ctx)
+		lr := rst.redactor.request(s.loggedRequest(r, labels))
+		severity, escalated := g.escalate(severity, code, et.Sub(st))
+		escalatedLabel(labels, escalated)
+		if override, ok := g.overrideSeverity(); ok {
+			severity = override
+		}
+		entry := logging.Entry{
+			Payload: g.payload(),
+			HTTPRequest: &logging.HTTPRequest{
+				Status:       code,
+				RequestSize:  requestSize(lr, body),
+				ResponseSize: size,
+				Request:      lr,
+				Latency:      et.Sub(st),
+				RemoteIP:     s.clientIP(r),
+				LocalIP:      serverIP(r),
+			},
+			Labels:    labels,
+			InsertID:  g.insertID,
+			Timestamp: et,
+			Trace:     traceID,
+			SpanID:    g.spanID,
+			Severity:  severity,
+		}
+		if debug == debugAccepted {
+			keys := append(append([]string{}, DefaultReplayRedactedQuery...), rst.redactor.current().Fields...)
+			entry.Payload = s.debugHeader.debugBody(entry.Payload, r.Header.Get("Content-Type"), body, keys)
+		}
+		s.enrich(&entry)
+		s.recordCache(&entry, header)
+		s.recordIdempotency(&entry, parentLogID, r)
+		for _, hook := range s.parentHooks {
+			hook(&entry)
+		}
+		if s.accessLog != nil {
+			entry.Payload = accessLogPayload(entry.Payload, s.accessLog(entry.HTTPRequest, et))
+		}
+		entry.Payload = normalizePayload(ctx, rst.redactor.payload(entry.Payload))
+		if g.traced {
+			labels["trace_sampled"] = strconv.FormatBool(g.sampled)
+		}
+		if tr != nil && g.spanID != "" {
+			tr.record(traceID, g.spanID, g.remoteSpanID, r.Method+" "+r.URL.Path, st, et, map[string]string{
+				"/http/method":      r.Method,
+				"/http/url":         r.URL.String(),
+				"/http/status_code": strconv.Itoa(code),
 			})
-		})
+		}
+		if st, _ := getState(ctx); st.tenant != nil && !st.tenant.apply(&entry) {
+			return
+		}
+		s.usage.add(parentLogID, entry)
+		parent.Log(entry)
+		forwardEntry(ctx, parentLogID, entry)
+		s.replay.send(parentLogID, entry, r, body)
+		mirrorGroup(ctx, entry, g.heldEntries())
+	}
+	// Goで起動されたgoroutineが残っている場合は、handlerの応答を待たせないようにリクエストのgoroutineの外で待つ
+	if !g.startWait() || !s.closer.background(func() { s.emitter.emit(emit) }) {
+		s.emitter.emit(emit)
+	}
+	if recovered != nil {
+		if recovered == http.ErrAbortHandler {
+			panic(recovered)
+		}
+		markPanicLogged(r.Context())
+		panic(recovered)
 	}
 }
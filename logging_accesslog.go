@@ -0,0 +1,104 @@
+package glbr
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"text/template"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// AccessLogFormat 親エントリに出力するアクセスログの形式
+type AccessLogFormat func(req *logging.HTTPRequest, t time.Time) string
+
+// WithAccessLogFormat 親エントリにHTTPRequestと共にアクセスログをテキストペイロードとして出力する
+// Outcomeが指定されている場合は、ペイロードのmessageとして出力する
+func (s Service) WithAccessLogFormat(format AccessLogFormat) Service {
+	s.accessLog = format
+	return s
+}
+
+// orHyphen 空の場合は"-"
+func orHyphen(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// remoteHost HTTPRequest.RemoteIPが設定されていない場合はRemoteAddrのホスト部分
+func remoteHost(req *logging.HTTPRequest) string {
+	if req.RemoteIP != "" {
+		return req.RemoteIP
+	}
+	host, _, err := net.SplitHostPort(req.Request.RemoteAddr)
+	if err != nil {
+		return req.Request.RemoteAddr
+	}
+	return host
+}
+
+// CombinedLogFormat Apache combined log format
+// %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+func CombinedLogFormat(req *logging.HTTPRequest, t time.Time) string {
+	r := req.Request
+	user := "-"
+	if u, _, ok := r.BasicAuth(); ok && u != "" {
+		user = u
+	}
+	size := "-"
+	if 0 < req.ResponseSize {
+		size = fmt.Sprintf("%d", req.ResponseSize)
+	}
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s "%s" "%s"`,
+		remoteHost(req), user, t.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, r.URL.RequestURI(), r.Proto, req.Status, size,
+		orHyphen(r.Referer()), orHyphen(r.UserAgent()))
+}
+
+// EnvoyLogFormat Envoyのデフォルトのアクセスログ形式
+// [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+func EnvoyLogFormat(req *logging.HTTPRequest, t time.Time) string {
+	r := req.Request
+	return fmt.Sprintf(`[%s] "%s %s %s" %d - %d %d %d - "%s" "%s" "%s" "%s" "-"`,
+		t.Add(-req.Latency).UTC().Format("2006-01-02T15:04:05.000Z"),
+		r.Method, r.URL.RequestURI(), r.Proto, req.Status,
+		req.RequestSize, req.ResponseSize, req.Latency/time.Millisecond,
+		orHyphen(r.Header.Get("X-Forwarded-For")), orHyphen(r.UserAgent()),
+		orHyphen(r.Header.Get("X-Request-Id")), orHyphen(r.Host))
+}
+
+// AccessLogData TemplateLogFormatのテンプレートに渡される値
+type AccessLogData struct {
+	*logging.HTTPRequest
+	Time     time.Time
+	RemoteIP string
+}
+
+// TemplateLogFormat text/templateでアクセスログの形式を指定する
+// テンプレートにはAccessLogDataが渡される 例: `{{.RemoteIP}} {{.Request.Method}} {{.Request.URL}} {{.Status}}`
+func TemplateLogFormat(text string) (AccessLogFormat, error) {
+	tmpl, err := template.New("access-log").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return func(req *logging.HTTPRequest, t time.Time) string {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, AccessLogData{HTTPRequest: req, Time: t, RemoteIP: remoteHost(req)}); err != nil {
+			return err.Error()
+		}
+		return strings.TrimRight(buf.String(), "\n")
+	}, nil
+}
+
+// accessLogPayload アクセスログを親エントリのペイロードにする
+func accessLogPayload(payload interface{}, line string) interface{} {
+	if m, ok := payload.(map[string]interface{}); ok {
+		m["message"] = line
+		return m
+	}
+	return line
+}
@@ -0,0 +1,88 @@
+package glbr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestAccessLogPresets(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://api.example.com/items?id=1", nil)
+	r.RemoteAddr = "198.51.100.7:51234"
+	r.Header.Set("Referer", "https://example.com/")
+	r.Header.Set("User-Agent", "curl/8.0")
+	r.Header.Set("X-Request-Id", "req-1")
+	r.SetBasicAuth("alice", "secret")
+	req := &logging.HTTPRequest{Request: r, Status: 200, RequestSize: 10, ResponseSize: 512, Latency: 1500 * time.Millisecond}
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+
+	tests := []struct {
+		name   string
+		format AccessLogFormat
+		req    *logging.HTTPRequest
+		want   string
+	}{
+		{"combined", CombinedLogFormat, req, `198.51.100.7 - alice [01/May/2024:12:00:00 +0900] "GET /items?id=1 HTTP/1.1" 200 512 "https://example.com/" "curl/8.0"`},
+		{"combined empty", CombinedLogFormat, &logging.HTTPRequest{Request: httptest.NewRequest("POST", "/", nil), Status: 204, RemoteIP: "203.0.113.5"}, `203.0.113.5 - - [01/May/2024:12:00:00 +0900] "POST / HTTP/1.1" 204 - "-" "-"`},
+		{"envoy", EnvoyLogFormat, req, `[2024-05-01T02:59:58.500Z] "GET /items?id=1 HTTP/1.1" 200 - 10 512 1500 - "-" "curl/8.0" "req-1" "api.example.com" "-"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.format(tt.req, at); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateLogFormat(t *testing.T) {
+	format, err := TemplateLogFormat("{{.RemoteIP}} {{.Request.Method}} {{.Request.URL.Path}} {{.Status}} {{.Time.Year}}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/items", nil)
+	r.RemoteAddr = "198.51.100.7:51234"
+	if got := format(&logging.HTTPRequest{Request: r, Status: 404}, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)); got != "198.51.100.7 GET /items 404 2024" {
+		t.Errorf("line = %q", got)
+	}
+	if _, err := TemplateLogFormat("{{.Status"); err == nil {
+		t.Error("invalid template is accepted")
+	}
+	format, _ = TemplateLogFormat("{{.Missing}}")
+	if got := format(&logging.HTTPRequest{Request: r}, time.Now()); !strings.Contains(got, "Missing") {
+		t.Errorf("execution error = %q, want the template error", got)
+	}
+}
+
+// 親エントリのペイロードはアクセスログの行になり、Outcomeがある場合はmessageになる
+func TestWithAccessLogFormat(t *testing.T) {
+	s, rec, err := NewRecorder("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	format, _ := TemplateLogFormat("{{.Request.Method}} {{.Request.URL.Path}} {{.Status}}")
+	handler := s.WithAccessLogFormat(format).GroupedBy("parent")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/outcome" {
+			Outcome(r.Context(), "created")
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/plain", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/outcome", nil))
+
+	parents := rec.Entries("parent")
+	if len(parents) != 2 {
+		t.Fatalf("parent entries = %d", len(parents))
+	}
+	if parents[0].Payload != "GET /plain 200" {
+		t.Errorf("payload = %v", parents[0].Payload)
+	}
+	payload, ok := parents[1].Payload.(map[string]interface{})
+	if !ok || payload["message"] != "POST /outcome 201" || payload["outcome"] != "created" {
+		t.Errorf("payload with outcome = %v", parents[1].Payload)
+	}
+}
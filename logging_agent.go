@@ -0,0 +1,166 @@
+package glbr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// agentLine Ops Agent(fluent-bit)、fluentdが解釈する構造化ログの1行
+// https://cloud.google.com/logging/docs/structured-logging
+type agentLine struct {
+	Severity    string            `json:"severity"`
+	Time        string            `json:"time"`
+	Message     interface{}       `json:"message,omitempty"`
+	Trace       string            `json:"logging.googleapis.com/trace,omitempty"`
+	SpanID      string            `json:"logging.googleapis.com/spanId,omitempty"`
+	InsertID    string            `json:"logging.googleapis.com/insertId,omitempty"`
+	Labels      map[string]string `json:"logging.googleapis.com/labels,omitempty"`
+	HTTPRequest *agentHTTPRequest `json:"httpRequest,omitempty"`
+}
+
+// agentHTTPRequest 構造化ログのhttpRequest
+type agentHTTPRequest struct {
+	RequestMethod string `json:"requestMethod"`
+	RequestURL    string `json:"requestUrl"`
+	Status        int    `json:"status"`
+	RequestSize   string `json:"requestSize,omitempty"`
+	ResponseSize  string `json:"responseSize,omitempty"`
+	UserAgent     string `json:"userAgent,omitempty"`
+	RemoteIP      string `json:"remoteIp,omitempty"`
+	ServerIP      string `json:"serverIp,omitempty"`
+	Referer       string `json:"referer,omitempty"`
+	Latency       string `json:"latency"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+// AgentFormat Ops Agent、fluentdが解釈する構造化ログのJSON形式
+// 文字列のペイロードはmessageに、mapのペイロードはフィールドをそのままトップレベルに展開する
+//
+//	{"severity":"INFO","time":"2006-01-02T15:04:05.000000000Z","message":"message","logging.googleapis.com/trace":"projects/p/traces/1234"}
+func AgentFormat(w io.Writer, entry logging.Entry) error {
+	line := agentLine{
+		Severity: agentSeverity(entry.Severity),
+		Time:     entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		Trace:    entry.Trace,
+		SpanID:   entry.SpanID,
+		InsertID: entry.InsertID,
+		Labels:   entry.Labels,
+	}
+	fields, structured := jsonValue(entry.Payload).(map[string]interface{})
+	if !structured && entry.Payload != nil {
+		line.Message = jsonValue(entry.Payload)
+	}
+	if r := entry.HTTPRequest; r != nil && r.Request != nil {
+		line.HTTPRequest = &agentHTTPRequest{
+			RequestMethod: r.Request.Method,
+			RequestURL:    r.Request.URL.String(),
+			Status:        r.Status,
+			UserAgent:     r.Request.UserAgent(),
+			RemoteIP:      r.RemoteIP,
+			ServerIP:      r.LocalIP,
+			Referer:       r.Request.Referer(),
+			Latency:       fmt.Sprintf("%.9fs", r.Latency.Seconds()),
+			Protocol:      r.Request.Proto,
+		}
+		if 0 < r.RequestSize {
+			line.HTTPRequest.RequestSize = strconv.FormatInt(r.RequestSize, 10)
+		}
+		if 0 < r.ResponseSize {
+			line.HTTPRequest.ResponseSize = strconv.FormatInt(r.ResponseSize, 10)
+		}
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	if structured && 0 < len(fields) {
+		var top map[string]interface{}
+		if err := json.Unmarshal(b, &top); err != nil {
+			return err
+		}
+		for k, v := range fields {
+			if _, ok := top[k]; !ok {
+				top[k] = v
+			}
+		}
+		if b, err = json.Marshal(top); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// agentSeverity 構造化ログのseverity
+func agentSeverity(severity logging.Severity) string {
+	return strings.ToUpper(severity.String())
+}
+
+// agentSink グループの親エントリを含む全てのエントリをAgentFormatで書き込むSink
+type agentSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewAgentSink グループの親エントリを含むエントリをAgentFormatでwに書き込むSink
+// logIDは log_id ラベルとして付加する。wがio.Closerであれば、Closeで閉じる
+func NewAgentSink(w io.Writer) Sink {
+	return &agentSink{w: w}
+}
+
+func (s *agentSink) Send(logID string, entry logging.Entry) {
+	labels := make(map[string]string, len(entry.Labels)+1)
+	for k, v := range entry.Labels {
+		labels[k] = v
+	}
+	labels["log_id"] = logID
+	entry.Labels = labels
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := AgentFormat(s.w, entry); err != nil {
+		fmt.Fprintf(os.Stderr, "glbr: agent sink: %v\n", err)
+	}
+}
+
+func (s *agentSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// NewAgentOutput Cloud Loggingに送信せずに、エントリをAgentFormatでpathのファイルに追記するserviceを取得する
+// Ops Agentやfluentdが収集するVM向け。アプリケーションにLogging APIの認証情報が不要になる。pathには名前付きパイプも指定できる
+// エージェントにはJSONとして解析し、time を時刻とする設定を行う
+//
+//	log, err := glbr.NewAgentOutput("LogID", "/var/log/app/glbr.log")
+func NewAgentOutput(logID, path string) (Service, error) {
+	if noOpBuild {
+		return NewNoOp(), nil
+	}
+	if err := validateLogID(logID); err != nil {
+		return Service{}, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return Service{}, err
+	}
+	service := Service{
+		ctx:     context.Background(),
+		option:  make([]logging.LoggerOption, 0),
+		logID:   logID,
+		loggers: newLoggerCache(),
+		closer:  &closer{done: make(chan struct{})},
+		usage:   newUsage(),
+	}
+	return service.AddSink(NewAgentSink(f), SinkFilter{}), nil
+}
@@ -0,0 +1,114 @@
+package glbr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"google.golang.org/genproto/googleapis/cloud/audit"
+)
+
+// auditor 監査ログの出力先
+type auditor struct {
+	logger    entryLogger
+	proto     protoLogger
+	usage     usageMeter
+	hashChain bool
+
+	mu       sync.Mutex
+	sequence uint64
+	prevHash string
+}
+
+// WithAudit 監査ログの出力先logIDを指定する
+// hashChainがtrueの場合、各エントリに直前のエントリのハッシュを含めて改ざんを検知できるようにする
+func (s Service) WithAudit(auditLogID string, hashChain bool) Service {
+	if err := validateLogID(auditLogID); err != nil {
+		panic(err)
+	}
+	if s.logID == auditLogID {
+		panic(ErrSameLogID)
+	}
+	s.ctx = setAuditor(s.ctx, &auditor{
+		logger:    s.logger(auditLogID),
+		proto:     s.protoLogger(auditLogID),
+		usage:     usageMeter{usage: s.usage, logID: auditLogID},
+		hashChain: hashChain,
+	})
+	return s
+}
+
+// auditRecord 監査ログのペイロード
+type auditRecord struct {
+	SchemaVersion int                    `json:"schema_version"`
+	Sequence      uint64                 `json:"sequence"`
+	Action        string                 `json:"action"`
+	Subject       string                 `json:"subject"`
+	Details       map[string]interface{} `json:"details,omitempty"`
+	Timestamp     time.Time              `json:"timestamp"`
+	PrevHash      string                 `json:"prev_hash,omitempty"`
+	Hash          string                 `json:"hash,omitempty"`
+}
+
+// Audit 監査ログを出力する
+// action, subjectは必須。各エントリには単調増加するsequenceが付加される
+func Audit(c context.Context, action, subject string, details map[string]interface{}) error {
+	a, ok := getAuditor(c)
+	if !ok {
+		return ErrAuditorNotFound
+	}
+	if action == "" || subject == "" {
+		return ErrMissingAuditField
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	record := auditRecord{
+		SchemaVersion: SchemaVersion,
+		Sequence:      a.sequence + 1,
+		Action:        action,
+		Subject:       subject,
+		Details:       details,
+		Timestamp:     clockFrom(c).Now(),
+	}
+	if a.hashChain {
+		record.PrevHash = a.prevHash
+		b, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+		record.Hash = hex.EncodeToString(sum[:])
+	}
+	// ハッシュを計算した値のまま出力する。WithBigQueryFieldNamesで正規化するとハッシュを検証できなくなる
+	entry := logging.Entry{
+		Payload:   record,
+		Severity:  logging.Notice,
+		Timestamp: record.Timestamp,
+	}
+	if traceID, ok := getTraceID(c); ok {
+		entry.Trace = *traceID
+	}
+	applySpan(c, &entry)
+	a.logger.Log(entry)
+	a.usage.add(entry)
+	a.sequence = record.Sequence
+	a.prevHash = record.Hash
+	return nil
+}
+
+// AuditLog google.cloud.audit.AuditLogをProtoPayloadとして監査ログに出力する
+// Logs Explorerの監査ログとして表示される。書き込みは同期的に行われる
+func AuditLog(c context.Context, log *audit.AuditLog) error {
+	a, ok := getAuditor(c)
+	if !ok {
+		return ErrAuditorNotFound
+	}
+	if log == nil {
+		return ErrNilPayload
+	}
+	return a.proto.log(c, logging.Notice, log)
+}
@@ -0,0 +1,94 @@
+package glbr
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// WithBaggage リクエストのW3C baggageヘッダーのうちkeysに含まれる値を、グループのエントリに baggage_{key} ラベルとして付加する
+// 値はTransportで呼び出し先へのリクエストにも設定される。keysに含まれない値は出力も伝播もしない
+//
+//	log = log.WithBaggage("tenant", "plan")
+func (s Service) WithBaggage(keys ...string) Service {
+	s.baggageKeys = append(append([]string{}, s.baggageKeys...), keys...)
+	return s
+}
+
+// parseBaggage baggageヘッダーからkeysに含まれる値を取り出す
+//
+//	baggage: key1=value1;property,key2=value2
+func parseBaggage(h http.Header, keys []string) map[string]string {
+	var baggage map[string]string
+	for _, header := range h.Values("baggage") {
+		for _, member := range strings.Split(header, ",") {
+			if i := strings.Index(member, ";"); 0 <= i {
+				member = member[:i]
+			}
+			kv := strings.SplitN(member, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			key := strings.TrimSpace(kv[0])
+			if !contains(keys, key) {
+				continue
+			}
+			value, err := url.PathUnescape(strings.TrimSpace(kv[1]))
+			if err != nil {
+				continue
+			}
+			if baggage == nil {
+				baggage = map[string]string{}
+			}
+			baggage[key] = value
+		}
+	}
+	return baggage
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// baggageLabels baggageをラベルに付加する
+// 既に同じ名前のラベルがある場合は上書きしない
+func baggageLabels(labels map[string]string, baggage map[string]string) map[string]string {
+	if len(baggage) == 0 {
+		return labels
+	}
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for k, v := range baggage {
+		if _, ok := labels["baggage_"+k]; !ok {
+			labels["baggage_"+k] = v
+		}
+	}
+	return labels
+}
+
+// InjectBaggage cのbaggageを呼び出し先へのリクエストヘッダーに設定する
+// WithBaggageで許可された値のみを設定する
+func InjectBaggage(c context.Context, h http.Header) {
+	st, _ := getState(c)
+	if len(st.baggage) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(st.baggage))
+	for k := range st.baggage {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	members := make([]string, 0, len(keys))
+	for _, k := range keys {
+		members = append(members, k+"="+url.PathEscape(st.baggage[k]))
+	}
+	h.Set("baggage", strings.Join(members, ","))
+}
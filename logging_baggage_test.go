@@ -0,0 +1,67 @@
+package glbr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 許可されたkeyのbaggageだけがラベルになり、呼び出し先に伝播する
+func TestBaggageAllowList(t *testing.T) {
+	s, rec, err := NewRecorder("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = s.WithBaggage("tenant", "plan")
+	injected := http.Header{}
+	handler := s.GroupedBy("parent")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Infof(r.Context(), "child")
+		InjectBaggage(r.Context(), injected)
+	}))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Add("baggage", "tenant=acme;ttl=60, secret=token, malformed")
+	r.Header.Add("baggage", "plan=pro%20plus,user=%zz")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	want := map[string]string{"baggage_tenant": "acme", "baggage_plan": "pro plus"}
+	for _, logID := range []string{"app", "parent"} {
+		entries := rec.Entries(logID)
+		if len(entries) != 1 {
+			t.Fatalf("%s entries = %d", logID, len(entries))
+		}
+		for k, v := range want {
+			if got := entries[0].Labels[k]; got != v {
+				t.Errorf("%s label %s = %q, want %q", logID, k, got, v)
+			}
+		}
+		for _, k := range []string{"baggage_secret", "baggage_malformed", "baggage_user"} {
+			if _, ok := entries[0].Labels[k]; ok {
+				t.Errorf("%s has label %s not in the allow list", logID, k)
+			}
+		}
+	}
+	if got := injected.Get("baggage"); got != "plan=pro%20plus,tenant=acme" {
+		t.Errorf("injected baggage = %q", got)
+	}
+
+	// WithBaggageがない場合は出力も伝播もしない
+	s, rec, _ = NewRecorder("app")
+	injected = http.Header{}
+	s.GroupedBy("parent")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Infof(r.Context(), "child")
+		InjectBaggage(r.Context(), injected)
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	if _, ok := rec.Entries("app")[0].Labels["baggage_tenant"]; ok || injected.Get("baggage") != "" {
+		t.Errorf("baggage is used without WithBaggage: %v %q", rec.Entries("app")[0].Labels, injected.Get("baggage"))
+	}
+}
+
+func TestBaggageLabelsKeepExisting(t *testing.T) {
+	labels := baggageLabels(map[string]string{"baggage_tenant": "explicit"}, map[string]string{"tenant": "acme", "plan": "pro"})
+	if labels["baggage_tenant"] != "explicit" || labels["baggage_plan"] != "pro" {
+		t.Errorf("labels = %v", labels)
+	}
+	if got := baggageLabels(nil, nil); got != nil {
+		t.Errorf("labels without baggage = %v, want nil", got)
+	}
+}
@@ -0,0 +1,132 @@
+package glbr
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// batchSinkLimit バッファできるエントリ数のmaxに対する倍率
+const batchSinkLimit = 10
+
+// batchSink エントリをバッファし、interval毎またはmax件毎にまとめて送信するSink
+// flushは1つのgoroutineから順に呼ばれる
+// バッファがmaxのbatchSinkLimit倍に達した場合は、次の送信までエントリを捨てて件数を標準のloggerに出力する
+type batchSink struct {
+	name     string // エラーの出力に使う名前
+	interval time.Duration
+	max      int
+	flush    func(records []SinkRecord) error
+
+	mu      sync.Mutex
+	records []SinkRecord
+	dropped int           // バッファが一杯で捨てたエントリ数
+	closed  bool          // Closeの後。Sendは何もしない
+	kick    chan struct{} // max件に達した
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	err     error
+}
+
+// newBatchSink 送信用のgoroutineを起動する
+// intervalが0以下の場合は1分、maxが0以下の場合は1000件
+func newBatchSink(name string, interval time.Duration, max int, flush func(records []SinkRecord) error) *batchSink {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	if max <= 0 {
+		max = 1000
+	}
+	b := &batchSink{
+		name:     name,
+		interval: interval,
+		max:      max,
+		flush:    flush,
+		kick:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *batchSink) Send(logID string, entry logging.Entry) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	if b.max*batchSinkLimit <= len(b.records) {
+		b.dropped++
+		b.mu.Unlock()
+		return
+	}
+	b.records = append(b.records, NewSinkRecord(logID, entry))
+	full := b.max <= len(b.records)
+	b.mu.Unlock()
+	if full {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *batchSink) run() {
+	defer close(b.stopped)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.kick:
+		case <-b.done:
+			return
+		}
+		if err := b.send(); err != nil {
+			log.Printf("glbr: %s sink: %v", b.name, err)
+		}
+	}
+}
+
+// send バッファしたエントリをmax件ずつ送信する
+// 送信に失敗したバッチがあっても残りのバッチを送信し、全てのエラーをまとめて返す
+func (b *batchSink) send() error {
+	b.mu.Lock()
+	records, dropped := b.records, b.dropped
+	b.records, b.dropped = nil, 0
+	b.mu.Unlock()
+	if 0 < dropped {
+		log.Printf("glbr: %s sink buffer is full, %d entries dropped", b.name, dropped)
+	}
+	var errs []error
+	for 0 < len(records) {
+		n := len(records)
+		if b.max < n {
+			n = b.max
+		}
+		if err := b.flush(records[:n]); err != nil {
+			errs = append(errs, err)
+		}
+		records = records[n:]
+	}
+	return errors.Join(errs...)
+}
+
+// Close 送信用のgoroutineを止め、残ったエントリを送信する
+// 以降のSendは何もしない
+func (b *batchSink) Close() error {
+	b.once.Do(func() {
+		b.mu.Lock()
+		b.closed = true
+		b.mu.Unlock()
+		close(b.done)
+		<-b.stopped
+		b.err = b.send()
+	})
+	return b.err
+}
@@ -0,0 +1,77 @@
+package glbr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+// stoppedBatchSink 送信用のgoroutineを起動しないbatchSink。sendとCloseだけが送信する
+func stoppedBatchSink(max int, flush func(records []SinkRecord) error) *batchSink {
+	b := &batchSink{
+		name:    "test",
+		max:     max,
+		flush:   flush,
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	close(b.stopped)
+	return b
+}
+
+// 送信に失敗したバッチがあっても残りのバッチを送信し、エラーをまとめて返す
+func TestBatchSinkSendAll(t *testing.T) {
+	calls, sent := 0, 0
+	b := stoppedBatchSink(2, func(records []SinkRecord) error {
+		calls++
+		if calls%2 == 1 {
+			return fmt.Errorf("flush %d", calls)
+		}
+		sent += len(records)
+		return nil
+	})
+	for i := 0; i < 5; i++ {
+		b.Send("app", logging.Entry{Payload: i})
+	}
+	err := b.send()
+	if calls != 3 || sent != 2 {
+		t.Errorf("calls = %d, sent = %d, want 3, 2", calls, sent)
+	}
+	if err == nil || !strings.Contains(err.Error(), "flush 1") || !strings.Contains(err.Error(), "flush 3") {
+		t.Errorf("err = %v, want both flush errors", err)
+	}
+}
+
+// バッファが一杯の場合は捨てて数え、Closeの後のSendは何もしない
+func TestBatchSinkBound(t *testing.T) {
+	sent := 0
+	b := stoppedBatchSink(1, func(records []SinkRecord) error {
+		sent += len(records)
+		return nil
+	})
+	for i := 0; i < batchSinkLimit+5; i++ {
+		b.Send("app", logging.Entry{Payload: i})
+	}
+	if len(b.records) != batchSinkLimit || b.dropped != 5 {
+		t.Errorf("buffered = %d, dropped = %d, want %d, 5", len(b.records), b.dropped, batchSinkLimit)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b.Send("app", logging.Entry{Payload: "after close"})
+	if sent != batchSinkLimit || len(b.records) != 0 || b.dropped != 0 {
+		t.Errorf("sent = %d, buffered after close = %d, dropped = %d", sent, len(b.records), b.dropped)
+	}
+}
+
+func TestBatchSinkCloseError(t *testing.T) {
+	b := stoppedBatchSink(1, func([]SinkRecord) error { return errors.New("unavailable") })
+	b.Send("app", logging.Entry{})
+	if err := b.Close(); err == nil || err.Error() != "unavailable" {
+		t.Errorf("Close = %v, want unavailable", err)
+	}
+}
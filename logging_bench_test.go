@@ -0,0 +1,118 @@
+package glbr_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/logging"
+	"github.com/KawanoTakayuki/glbr"
+	"github.com/KawanoTakayuki/glbr/glbrtest"
+)
+
+// newBenchService glbrtestのサーバーに送信するservice
+func newBenchService(b *testing.B) glbr.Service {
+	srv, err := glbrtest.NewServer()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(srv.Close)
+	log, err := glbr.NewLogging("project-id", "LogID", srv.ClientOptions()...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { log.Close() })
+	return log
+}
+
+func BenchmarkInfofOutsideGroup(b *testing.B) {
+	c := newBenchService(b).Context()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		glbr.Infof(c, "entry")
+	}
+}
+
+func BenchmarkInfofInGroup(b *testing.B) {
+	log := newBenchService(b)
+	handler := log.GroupedBy("ParentLogID")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := r.Context()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			glbr.Infof(c, "entry")
+		}
+		b.StopTimer()
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+// Contextは同じlogIDのloggerを再利用する
+func BenchmarkContext(b *testing.B) {
+	log := newBenchService(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		log.Context()
+	}
+}
+
+// リクエスト毎の親エントリのloggerの取得、contextの作成、エントリの構築
+func BenchmarkGroupedBy(b *testing.B) {
+	log := newBenchService(b)
+	handler := log.GroupedBy("ParentLogID")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		glbr.Infof(r.Context(), "entry")
+	}))
+	r := httptest.NewRequest("GET", "/", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
+
+// 出力されないseverityの呼び出しはフォーマットもエントリの構築もしない
+func BenchmarkDebugfDisabled(b *testing.B) {
+	c := newBenchService(b).WithMinSeverity(logging.Info).Context()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		glbr.Debugf(c, "entry %s", "value")
+	}
+}
+
+func BenchmarkDebugfDisabledInGroup(b *testing.B) {
+	log := newBenchService(b).WithMinSeverity(logging.Info)
+	handler := log.GroupedBy("ParentLogID")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := r.Context()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			glbr.Debugf(c, "entry %s", "value")
+		}
+		b.StopTimer()
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func BenchmarkEnabled(b *testing.B) {
+	c := newBenchService(b).WithMinSeverity(logging.Info).Context()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		glbr.Enabled(c, logging.Debug)
+	}
+}
+
+func TestDisabledNoAllocs(t *testing.T) {
+	log, err := glbr.NewLocal("LogID", ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := log.WithMinSeverity(logging.Info).Context()
+	if n := testing.AllocsPerRun(100, func() { glbr.Debugf(c, "entry %s", "value") }); n != 0 {
+		t.Errorf("Debugf allocs = %v, want 0", n)
+	}
+}
@@ -0,0 +1,109 @@
+package glbr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"unicode"
+)
+
+// bigQueryColumnMax BigQueryの列名の最大長
+const bigQueryColumnMax = 300
+
+// fieldNaming BigQueryのシンク向けのフィールド名の正規化
+type fieldNaming struct {
+	maxDepth int
+}
+
+// WithBigQueryFieldNames ペイロードのフィールド名をBigQueryの列名として有効な形式に正規化する
+// フィールド名はlowercase_snakeにし、英数字と_以外の文字(.を含む)は_に置き換える。
+// maxDepthより深い値はJSON文字列として出力し、列の増加を抑える。0以下で深さを制限しない
+// 監査ログのペイロードは、hash_chainのハッシュを出力した値で検証できるように正規化しない
+//
+//	{"userID": 1, "http.status": 200, "a": {"b": {"c": 1}}} -> {"user_id": 1, "http_status": 200, "a": {"b": "{\"c\":1}"}} (maxDepth: 2)
+func (s Service) WithBigQueryFieldNames(maxDepth int) Service {
+	s.ctx = setFieldNaming(s.ctx, &fieldNaming{maxDepth: maxDepth})
+	return s
+}
+
+// normalizePayload WithBigQueryFieldNamesが指定されている場合はペイロードを正規化する
+// 文字列のペイロードはそのまま返す
+func normalizePayload(c context.Context, payload interface{}) interface{} {
+	n, ok := getFieldNaming(c)
+	if !ok || payload == nil {
+		return payload
+	}
+	if _, ok := payload.(string); ok {
+		return payload
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return payload
+	}
+	// 2^53を超える整数の精度を保つため、数値はjson.Numberのまま扱う
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return payload
+	}
+	return n.normalize(v, 1)
+}
+
+// normalize depth階層目の値のフィールド名を正規化する
+func (n *fieldNaming) normalize(v interface{}, depth int) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if 0 < n.maxDepth && n.maxDepth < depth {
+			b, _ := json.Marshal(v)
+			return string(b)
+		}
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[bigQueryFieldName(k)] = n.normalize(child, depth+1)
+		}
+		return m
+	case []interface{}:
+		if 0 < n.maxDepth && n.maxDepth < depth {
+			b, _ := json.Marshal(v)
+			return string(b)
+		}
+		for i, child := range v {
+			v[i] = n.normalize(child, depth)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// bigQueryFieldName nameをBigQueryの列名として有効なlowercase_snakeにする
+//
+//	userID -> user_id, HTTPStatus -> http_status, http.status -> http_status, 1st -> _1st
+func bigQueryFieldName(name string) string {
+	rs := []rune(name)
+	var b strings.Builder
+	for i, r := range rs {
+		switch {
+		case unicode.IsUpper(r):
+			if 0 < i && (unicode.IsLower(rs[i-1]) || unicode.IsDigit(rs[i-1]) ||
+				(unicode.IsUpper(rs[i-1]) && i+1 < len(rs) && unicode.IsLower(rs[i+1]))) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		case r < unicode.MaxASCII && (unicode.IsLower(r) || unicode.IsDigit(r) || r == '_'):
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	s := b.String()
+	if s == "" || ('0' <= s[0] && s[0] <= '9') {
+		s = "_" + s
+	}
+	if bigQueryColumnMax < len(s) {
+		s = s[:bigQueryColumnMax]
+	}
+	return s
+}
@@ -0,0 +1,138 @@
+package glbr
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// BigQuerySchema NewBigQuerySinkで書き込むテーブルのスキーマ
+// payloadにはペイロードの列として保持するフィールドを指定する。列名はWithBigQueryFieldNamesと同じ規則で正規化した名前にする
+// スキーマにないフィールドは payload_json にのみ残る
+//
+//	schema := glbr.BigQuerySchema(bigquery.Schema{{Name: "user_id", Type: bigquery.IntegerFieldType}})
+//	table.Create(c, &bigquery.TableMetadata{Schema: schema, TimePartitioning: &bigquery.TimePartitioning{Field: "timestamp"}})
+func BigQuerySchema(payload bigquery.Schema) bigquery.Schema {
+	schema := bigquery.Schema{
+		{Name: "log_id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "timestamp", Type: bigquery.TimestampFieldType, Required: true},
+		{Name: "severity", Type: bigquery.StringFieldType, Required: true},
+		{Name: "trace", Type: bigquery.StringFieldType},
+		{Name: "span_id", Type: bigquery.StringFieldType},
+		{Name: "insert_id", Type: bigquery.StringFieldType},
+		{Name: "labels", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+			{Name: "key", Type: bigquery.StringFieldType},
+			{Name: "value", Type: bigquery.StringFieldType},
+		}},
+		{Name: "http_request", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "method", Type: bigquery.StringFieldType},
+			{Name: "url", Type: bigquery.StringFieldType},
+			{Name: "status", Type: bigquery.IntegerFieldType},
+			{Name: "request_size", Type: bigquery.IntegerFieldType},
+			{Name: "response_size", Type: bigquery.IntegerFieldType},
+			{Name: "latency_seconds", Type: bigquery.FloatFieldType},
+			{Name: "remote_ip", Type: bigquery.StringFieldType},
+			{Name: "user_agent", Type: bigquery.StringFieldType},
+		}},
+		{Name: "payload_json", Type: bigquery.StringFieldType},
+	}
+	if 0 < len(payload) {
+		schema = append(schema, &bigquery.FieldSchema{Name: "payload", Type: bigquery.RecordFieldType, Schema: payload})
+	}
+	return schema
+}
+
+// NewBigQuerySink エントリをinterval毎にtableへストリーミング挿入するSink
+// 大量のデバッグログをLoggingの取り込みを経由せずにBigQueryで分析する場合に使う。tableのスキーマはBigQuerySchemaで作成する
+// 構造化ペイロードのフィールドは正規化した名前でpayloadの列に対応付け、スキーマにない値は無視される。intervalが0以下の場合は1分
+//
+//	log = log.AddSink(glbr.NewBigQuerySink(client.Dataset("logs").Table("debug"), 10*time.Second), glbr.SinkFilter{LogIDs: []string{"debug"}})
+func NewBigQuerySink(table *bigquery.Table, interval time.Duration) Sink {
+	inserter := table.Inserter()
+	inserter.IgnoreUnknownValues = true
+	return newBatchSink("bigquery", interval, 500, func(records []SinkRecord) error {
+		rows := make([]*bigQueryRow, len(records))
+		for i := range records {
+			rows[i] = &bigQueryRow{record: records[i]}
+		}
+		c, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		return inserter.Put(c, rows)
+	})
+}
+
+// bigQueryRow BigQuerySchemaの1行
+type bigQueryRow struct {
+	record SinkRecord
+}
+
+// Save bigquery.ValueSaver interface
+func (r *bigQueryRow) Save() (map[string]bigquery.Value, string, error) {
+	rec := r.record
+	row := map[string]bigquery.Value{
+		"log_id":    rec.LogID,
+		"timestamp": rec.Timestamp,
+		"severity":  rec.Severity,
+		"trace":     rec.Trace,
+		"span_id":   rec.SpanID,
+		"insert_id": rec.InsertID,
+	}
+	labels := make([]bigquery.Value, 0, len(rec.Labels))
+	for k, v := range rec.Labels {
+		labels = append(labels, map[string]bigquery.Value{"key": k, "value": v})
+	}
+	row["labels"] = labels
+	if h := rec.HTTPRequest; h != nil {
+		row["http_request"] = map[string]bigquery.Value{
+			"method":          h.Method,
+			"url":             h.URL,
+			"status":          h.Status,
+			"request_size":    h.RequestSize,
+			"response_size":   h.ResponseSize,
+			"latency_seconds": h.Latency,
+			"remote_ip":       h.RemoteIP,
+			"user_agent":      h.UserAgent,
+		}
+	}
+	switch p := rec.Payload.(type) {
+	case nil:
+	case string:
+		row["payload_json"] = p
+	default:
+		b, err := json.Marshal(p)
+		if err != nil {
+			return nil, "", err
+		}
+		row["payload_json"] = string(b)
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, "", err
+		}
+		if m, ok := bigQueryValue((&fieldNaming{}).normalize(v, 1)).(map[string]bigquery.Value); ok {
+			row["payload"] = m
+		}
+	}
+	return row, rec.InsertID, nil
+}
+
+// bigQueryValue JSONの値をbigquery.Valueにする
+func bigQueryValue(v interface{}) bigquery.Value {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]bigquery.Value, len(v))
+		for k, child := range v {
+			m[k] = bigQueryValue(child)
+		}
+		return m
+	case []interface{}:
+		s := make([]bigquery.Value, len(v))
+		for i, child := range v {
+			s[i] = bigQueryValue(child)
+		}
+		return s
+	default:
+		return v
+	}
+}
@@ -0,0 +1,95 @@
+package glbr
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	vkit "cloud.google.com/go/logging/apiv2"
+	logpb "google.golang.org/genproto/googleapis/logging/v2"
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LogBucket エントリを保存するログバケット
+// リージョンのバケットを指定して、データの保存場所の要件(EU内のみ等)を満たす
+type LogBucket struct {
+	Location string // europe-west1, eu, global等
+	BucketID string
+}
+
+// destination シンクの宛先
+func (b LogBucket) destination(parent string) string {
+	return "logging.googleapis.com/" + logParent(parent) + "/locations/" + b.Location + "/buckets/" + b.BucketID
+}
+
+// RouteToBucket logIDs(省略した場合はNewLoggingのlogID)のエントリをbucketに保存するシンクをsinkIDで作成する
+// Cloud LoggingのAPIはバケットを指定した書き込みに対応していないため、シンクで振り分ける。既にある場合は宛先とフィルタを更新する
+// excludeDefaultがtrueの場合は同じフィルタの除外(sinkID-exclusion)を作成し、_Defaultバケットに保存されないようにする
+// 起動時に一度だけ呼び出す。logging.sinks.create, logging.exclusions.create権限が必要
+//
+//	err := log.RouteToBucket(c, "glbr-eu", glbr.LogBucket{Location: "europe-west1", BucketID: "eu-logs"}, true, "LogID", "ParentLogID")
+func (s Service) RouteToBucket(c context.Context, sinkID string, bucket LogBucket, excludeDefault bool, logIDs ...string) error {
+	if s.proto == nil {
+		return nil // NewLocal, NewRecorder
+	}
+	if bucket.Location == "" || bucket.BucketID == "" {
+		return ErrInvalidBucket
+	}
+	if len(logIDs) == 0 {
+		logIDs = []string{s.logID}
+	}
+	parent := logParent(s.proto.projectID)
+	filter := logNameFilter(parent, logIDs)
+
+	client, err := vkit.NewConfigClient(c, s.proto.opts...)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	sink := &logpb.LogSink{Name: sinkID, Destination: bucket.destination(s.proto.projectID), Filter: filter}
+	if _, err := client.CreateSink(c, &logpb.CreateSinkRequest{Parent: parent, Sink: sink}); status.Code(err) == codes.AlreadyExists {
+		_, err = client.UpdateSink(c, &logpb.UpdateSinkRequest{
+			SinkName:   parent + "/sinks/" + sinkID,
+			Sink:       sink,
+			UpdateMask: &field_mask.FieldMask{Paths: []string{"destination", "filter"}},
+		})
+		if err != nil {
+			return fmt.Errorf("update sink %s: %w", sinkID, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("create sink %s: %w", sinkID, err)
+	}
+	if !excludeDefault {
+		return nil
+	}
+	exclusion := &logpb.LogExclusion{
+		Name:        sinkID + "-exclusion",
+		Description: "glbr: stored in " + bucket.destination(s.proto.projectID),
+		Filter:      filter,
+	}
+	if _, err := client.CreateExclusion(c, &logpb.CreateExclusionRequest{Parent: parent, Exclusion: exclusion}); status.Code(err) == codes.AlreadyExists {
+		_, err = client.UpdateExclusion(c, &logpb.UpdateExclusionRequest{
+			Name:       parent + "/exclusions/" + exclusion.Name,
+			Exclusion:  exclusion,
+			UpdateMask: &field_mask.FieldMask{Paths: []string{"description", "filter"}},
+		})
+		if err != nil {
+			return fmt.Errorf("update exclusion %s: %w", exclusion.Name, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("create exclusion %s: %w", exclusion.Name, err)
+	}
+	return nil
+}
+
+// logNameFilter logIDsのエントリを選択するフィルタ
+func logNameFilter(parent string, logIDs []string) string {
+	names := make([]string, 0, len(logIDs))
+	for _, logID := range logIDs {
+		names = append(names, fmt.Sprintf("%q", parent+"/logs/"+url.PathEscape(logID)))
+	}
+	return "logName=(" + strings.Join(names, " OR ") + ")"
+}
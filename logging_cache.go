@@ -0,0 +1,49 @@
+package glbr
+
+import (
+	"net/http"
+	"strings"
+
+	"cloud.google.com/go/logging"
+)
+
+// DefaultCacheHeaders WithCacheHeadersで記録するレスポンスヘッダー
+// いずれかのヘッダーがある場合は、キャッシュを参照したものとしてcache_lookup=trueを記録する
+var DefaultCacheHeaders = []string{"X-Cache", "X-Cache-Hits", "Age", "Cache-Control", "Cdn-Cache-Status"}
+
+// WithCacheHeaders 親エントリにキャッシュ関連のレスポンスヘッダーをラベルとして付加する
+// DefaultCacheHeadersとheadersを cache_{ヘッダー名} として記録し、X-CacheまたはCdn-Cache-StatusがHITの場合はCacheHitを設定する
+// Cloud CDNのキャッシュステータスはバックエンドのカスタムレスポンスヘッダー({cdn_cache_status})で付加する
+func (s Service) WithCacheHeaders(headers ...string) Service {
+	s.cacheHeaders = append(append([]string{}, DefaultCacheHeaders...), headers...)
+	return s
+}
+
+// cacheLabel ヘッダー名をラベル名にする
+func cacheLabel(header string) string {
+	return "cache_" + strings.Replace(strings.ToLower(header), "-", "_", -1)
+}
+
+// recordCache 親エントリにキャッシュ関連のヘッダーを記録する
+func (s Service) recordCache(entry *logging.Entry, header http.Header) {
+	if len(s.cacheHeaders) == 0 {
+		return
+	}
+	if entry.Labels == nil {
+		entry.Labels = map[string]string{}
+	}
+	for _, name := range s.cacheHeaders {
+		if v := header.Get(name); v != "" {
+			entry.Labels[cacheLabel(name)] = v
+			entry.Labels["cache_lookup"] = "true"
+		}
+	}
+	for _, name := range []string{"X-Cache", "Cdn-Cache-Status"} {
+		if v := strings.ToLower(header.Get(name)); strings.HasPrefix(v, "hit") {
+			entry.HTTPRequest.CacheHit = true
+		} else if strings.HasPrefix(v, "revalidated") {
+			entry.HTTPRequest.CacheHit = true
+			entry.HTTPRequest.CacheValidatedWithOriginServer = true
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package glbr
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/logging"
+)
+
+// glbrPackage 呼び出し箇所の探索で読み飛ばすパッケージ
+const glbrPackage = "github.com/KawanoTakayuki/glbr."
+
+// CallSiteStat 呼び出し箇所毎の出力の集計
+type CallSiteStat struct {
+	Location    string // 関数名 (ファイル:行)
+	Entries     int64
+	Bytes       int64 // エントリの推定サイズの合計
+	MaxSeverity logging.Severity
+}
+
+// callSites 呼び出し箇所毎の集計
+type callSites struct {
+	mu    sync.Mutex
+	stats map[uintptr]*CallSiteStat // 呼び出し箇所のPC毎
+}
+
+// WithCallSiteStats エントリを出力した呼び出し箇所(glbrの外で最も内側の関数)毎にエントリ数と推定バイト数を集計する
+// 大きなコードベースで出力の多い箇所を探す場合に使う。集計はCallSitesで取得する
+// 出力毎にスタックを辿るため、調査の間だけ有効にする
+func (s Service) WithCallSiteStats() Service {
+	s.ctx = updateState(s.ctx, func(st *state) { st.callSites = &callSites{stats: map[uintptr]*CallSiteStat{}} })
+	return s
+}
+
+// CallSites 推定バイト数の多い順に上位n件の呼び出し箇所を返す
+// nが0以下の場合は全て返す。WithCallSiteStatsの指定がない場合はnil
+func (s Service) CallSites(n int) []CallSiteStat {
+	st, _ := getState(s.ctx)
+	if st.callSites == nil {
+		return nil
+	}
+	return st.callSites.top(n)
+}
+
+// record エントリを出力した呼び出し箇所の集計に加える
+func (cs *callSites) record(entry logging.Entry) {
+	pc := callSitePC()
+	size := entrySize(entry)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	stat, ok := cs.stats[pc]
+	if !ok {
+		stat = &CallSiteStat{}
+		cs.stats[pc] = stat
+	}
+	stat.Entries++
+	stat.Bytes += size
+	if stat.MaxSeverity < entry.Severity {
+		stat.MaxSeverity = entry.Severity
+	}
+}
+
+// top 推定バイト数の多い順に上位n件を返す
+func (cs *callSites) top(n int) []CallSiteStat {
+	cs.mu.Lock()
+	stats := make([]CallSiteStat, 0, len(cs.stats))
+	pcs := make([]uintptr, 0, len(cs.stats))
+	for pc, stat := range cs.stats {
+		stats = append(stats, *stat)
+		pcs = append(pcs, pc)
+	}
+	cs.mu.Unlock()
+	for i, pc := range pcs {
+		stats[i].Location = callSiteLocation(pc)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Bytes != stats[j].Bytes {
+			return stats[i].Bytes > stats[j].Bytes
+		}
+		return stats[i].Location < stats[j].Location
+	})
+	if 0 < n && n < len(stats) {
+		stats = stats[:n]
+	}
+	return stats
+}
+
+// callSitePC glbrの外で最も内側の呼び出し箇所のPC
+func callSitePC() uintptr {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, glbrPackage) {
+			return frame.PC
+		}
+		if !more {
+			return 0
+		}
+	}
+}
+
+// callSiteLocation PCの "関数名 (ファイル:行)"
+func callSiteLocation(pc uintptr) string {
+	if pc == 0 {
+		return "unknown"
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc + 1}).Next()
+	return fmt.Sprintf("%s (%s:%d)", frame.Function, frame.File, frame.Line)
+}
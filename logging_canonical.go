@@ -0,0 +1,72 @@
+package glbr
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// canonicalMessageLimit 正規ログ行に含める子エントリの最大数
+const canonicalMessageLimit = 100
+
+// canonicalLine 正規ログ行に畳み込んだ子エントリ
+type canonicalLine struct {
+	messages []canonicalMessage
+	dropped  int
+}
+
+// canonicalMessage 正規ログ行の子エントリ
+type canonicalMessage struct {
+	Time     string      `json:"time"`
+	Severity string      `json:"severity"`
+	Message  interface{} `json:"message"`
+}
+
+// WithCanonicalLogLine グループの子エントリを個別に出力せずに、親エントリの1行(正規ログ行)に畳み込む
+// 子エントリは親エントリのペイロードの messages に最大100件まで含まれ、Setで設定したフィールドは fields に含まれる。
+// 子エントリのseverityは従来通り親エントリに集計される。QPSの高いサービスでエントリ数を大きく減らす場合に使う
+//
+//	{"schema_version": 1, "fields": {"user_id": 1}, "messages": [{"time": "...", "severity": "Info", "message": "..."}]}
+func (s Service) WithCanonicalLogLine() Service {
+	s.canonical = true
+	return s
+}
+
+// Set グループの親エントリのペイロードの fields にフィールドを設定する
+// WithCanonicalLogLineと組み合わせて、リクエスト中に集めた値を1行にまとめる。グループ外では何もしない
+// WithFieldRegistryの指定があれば定義で検証する
+func Set(c context.Context, key string, value interface{}) {
+	if g, ok := getGroup(c); ok {
+		g.mu.Lock()
+		if !g.fieldPolicy.check(g, key, value) {
+			g.mu.Unlock()
+			return
+		}
+		if g.fields == nil {
+			g.fields = map[string]interface{}{}
+		}
+		g.fields[key] = value
+		g.mu.Unlock()
+	}
+}
+
+// fold WithCanonicalLogLineが指定されていれば子エントリを親エントリに畳み込む
+// 畳み込まなかった場合はfalseを返す
+func (g *group) fold(entry logging.Entry) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.canonical == nil || g.closed {
+		return false
+	}
+	if canonicalMessageLimit <= len(g.canonical.messages) {
+		g.canonical.dropped++
+		return true
+	}
+	g.canonical.messages = append(g.canonical.messages, canonicalMessage{
+		Time:     entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		Severity: entry.Severity.String(),
+		Message:  entry.Payload,
+	})
+	return true
+}
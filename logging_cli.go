@@ -0,0 +1,35 @@
+package glbr
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"google.golang.org/api/option"
+)
+
+// WithSyncWrite エントリをバッファせずに同期的に書き込む
+// 書き込みのエラーは標準エラー出力に出力される
+func (s Service) WithSyncWrite() Service {
+	s.ctx = setSyncWrite(s.ctx)
+	return s
+}
+
+// NewCLI 短時間で終了するCLIやバッチ処理向けのserviceを取得する
+// エントリは同期的に書き込まれ、標準出力にも出力される。Progressは10秒または10%毎に出力される
+// cleanupはバッファの送信を待ってserviceを閉じる
+//
+//	log, cleanup, err := glbr.NewCLI("ProjectID", "LogID")
+//	if err != nil {
+//		panic(err.Error())
+//	}
+//	defer cleanup()
+func NewCLI(projectID, logID string, opts ...option.ClientOption) (service Service, cleanup func(), err error) {
+	service, err = NewLogging(projectID, logID, opts...)
+	if err != nil {
+		return Service{}, func() {}, err
+	}
+	service = service.WithSyncWrite().WithIOWriter(os.Stdout)
+	service = service.WithContext(WithProgress(context.Background(), 10*time.Second, 10))
+	return service, func() { service.Close() }, nil
+}
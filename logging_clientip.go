@@ -0,0 +1,102 @@
+package glbr
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// GoogleLoadBalancerRanges Google Cloud Load BalancingのプロキシのIPアドレス範囲
+// https://cloud.google.com/load-balancing/docs/https#firewall_rules
+var GoogleLoadBalancerRanges = []string{"130.211.0.0/22", "35.191.0.0/16"}
+
+// WithTrustedProxies 信頼するプロキシのIPアドレス範囲(CIDR)を指定する
+// 信頼するプロキシを経由したリクエストは、Forwarded/X-Forwarded-ForヘッダーからクライアントIPを解決する
+func (s Service) WithTrustedProxies(cidrs ...string) Service {
+	proxies := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(fmt.Errorf("%w: %v", ErrInvalidTrustedProxy, err))
+		}
+		proxies = append(proxies, ipnet)
+	}
+	s.trustedProxies = proxies
+	return s
+}
+
+// trusted 信頼するプロキシかどうか
+func (s Service) trusted(ip net.IP) bool {
+	for _, ipnet := range s.trustedProxies {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostIP host:port形式のアドレスからIPを取得する
+func hostIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+// forwardedFor Forwardedヘッダーのfor、なければX-Forwarded-Forを送信元から近い順に返す
+func forwardedFor(h http.Header) []string {
+	var hops []string
+	for _, header := range h["Forwarded"] {
+		for _, element := range strings.Split(header, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					hops = append(hops, strings.Trim(kv[1], `"`))
+				}
+			}
+		}
+	}
+	if len(hops) != 0 {
+		return hops
+	}
+	for _, header := range h["X-Forwarded-For"] {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// clientIP 信頼するプロキシを除いたクライアントIPを解決する
+func (s Service) clientIP(r *http.Request) string {
+	ip := hostIP(r.RemoteAddr)
+	if ip == nil {
+		return ""
+	}
+	if s.trusted(ip) {
+		hops := forwardedFor(r.Header)
+		for i := len(hops) - 1; 0 <= i; i-- {
+			hop := hostIP(hops[i])
+			if hop == nil {
+				break
+			}
+			ip = hop
+			if !s.trusted(hop) {
+				break
+			}
+		}
+	}
+	return ip.String()
+}
+
+// serverIP リクエストを受け付けたサーバーのIP
+func serverIP(r *http.Request) string {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if ip := hostIP(addr.String()); ip != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+package glbr
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxies    []string
+		remoteAddr string
+		header     map[string]string
+		want       string
+	}{
+		{"no proxy", nil, "198.51.100.7:1234", nil, "198.51.100.7"},
+		{"untrusted remote addr", []string{"10.0.0.0/8"}, "203.0.113.5:1234", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "203.0.113.5"},
+		{"spoofed leftmost", []string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.7"}, "198.51.100.7"},
+		{"proxy chain", []string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"multiple cidrs", []string{"10.0.0.0/8", "35.191.0.0/16"}, "35.191.1.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"all hops trusted", []string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.3"}, "10.0.0.3"},
+		{"ipv6", []string{"2001:db8::/32"}, "[2001:db8::1]:443", map[string]string{"X-Forwarded-For": "2400:cb00::1, 2001:db8::2"}, "2400:cb00::1"},
+		{"forwarded ipv6", []string{"2001:db8::/32"}, "[2001:db8::1]:443", map[string]string{"Forwarded": `for="[2400:cb00::1]:4711";proto=https`}, "2400:cb00::1"},
+		{"forwarded before x-forwarded-for", []string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"Forwarded": "for=198.51.100.7", "X-Forwarded-For": "203.0.113.5"}, "198.51.100.7"},
+		{"malformed hop", []string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.7, not-an-ip"}, "10.0.0.1"},
+		{"empty header", []string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": ""}, "10.0.0.1"},
+		{"malformed remote addr", []string{"10.0.0.0/8"}, "unknown", map[string]string{"X-Forwarded-For": "198.51.100.7"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			if got := (Service{}).WithTrustedProxies(tt.proxies...).clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithTrustedProxiesInvalid(t *testing.T) {
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrInvalidTrustedProxy) {
+			t.Errorf("recovered = %v, want ErrInvalidTrustedProxy", err)
+		}
+	}()
+	Service{}.WithTrustedProxies("10.0.0.1")
+}
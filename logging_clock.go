@@ -0,0 +1,35 @@
+package glbr
+
+import (
+	"context"
+	"time"
+)
+
+// Clock 現在時刻の取得元
+// エントリのtimestampとレイテンシの計測に使う
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+}
+
+// systemClock time.Nowを使うClock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                  { return time.Now() }
+func (systemClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+// WithClock エントリのtimestampとレイテンシの計測に使うClockを指定する
+// テストで出力されるエントリを固定する場合に使う Default: time.Now
+func (s Service) WithClock(clock Clock) Service {
+	s.ctx = setClock(s.ctx, clock)
+	return s
+}
+
+// clockFrom cに設定されたClock
+func clockFrom(c context.Context) Clock {
+	st, _ := getState(c)
+	if st.clock == nil {
+		return systemClock{}
+	}
+	return st.clock
+}
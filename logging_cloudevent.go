@@ -0,0 +1,69 @@
+package glbr
+
+import (
+	"context"
+	"net/http"
+
+	"cloud.google.com/go/logging"
+)
+
+// CloudEvent CloudEventsの属性
+// https://github.com/cloudevents/spec/blob/v1.0/spec.md
+type CloudEvent struct {
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	SpecVersion     string      `json:"specversion,omitempty"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            string      `json:"time,omitempty"`
+	DataContentType string      `json:"datacontenttype,omitempty"`
+	Data            interface{} `json:"data,omitempty"`
+}
+
+// LogCloudEvent CloudEventを構造化ログとして出力する
+// ペイロードは{"cloudevent": event}、イベントIDはcloudevent_idラベルとして付加される
+func LogCloudEvent(c context.Context, severity logging.Severity, event CloudEvent) {
+	if event.SpecVersion == "" {
+		event.SpecVersion = "1.0"
+	}
+	sendPayload(c, severity, versioned(map[string]interface{}{"cloudevent": event}), map[string]string{
+		"cloudevent_id":     event.ID,
+		"cloudevent_type":   event.Type,
+		"cloudevent_source": event.Source,
+	})
+}
+
+// CloudEventFromRequest バイナリモードで配信されたCloudEventの属性をヘッダーから取得する
+// Dataは取得しない
+func CloudEventFromRequest(r *http.Request) (CloudEvent, bool) {
+	event := CloudEvent{
+		ID:              r.Header.Get("Ce-Id"),
+		Source:          r.Header.Get("Ce-Source"),
+		SpecVersion:     r.Header.Get("Ce-Specversion"),
+		Type:            r.Header.Get("Ce-Type"),
+		Subject:         r.Header.Get("Ce-Subject"),
+		Time:            r.Header.Get("Ce-Time"),
+		DataContentType: r.Header.Get("Content-Type"),
+	}
+	return event, event.ID != "" && event.Source != "" && event.Type != ""
+}
+
+// CloudEventGroupedBy Eventarcから配信されたCloudEventのリクエストをイベント単位でグループ化する
+// 親エントリにはイベントのid, type, source, subjectがラベルとして付加される
+func (s Service) CloudEventGroupedBy(parentLogID string) GroupingHandler {
+	group := s.GroupedBy(parentLogID)
+	return func(next http.Handler) http.Handler {
+		return group(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if event, ok := CloudEventFromRequest(r); ok {
+				c := r.Context()
+				Annotate(c, "cloudevent_id", event.ID)
+				Annotate(c, "cloudevent_type", event.Type)
+				Annotate(c, "cloudevent_source", event.Source)
+				if event.Subject != "" {
+					Annotate(c, "cloudevent_subject", event.Subject)
+				}
+			}
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
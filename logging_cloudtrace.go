@@ -0,0 +1,213 @@
+package glbr
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	trace "cloud.google.com/go/trace/apiv2"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/api/option"
+	tracepb "google.golang.org/genproto/googleapis/devtools/cloudtrace/v2"
+)
+
+const (
+	traceBatchSize     = 100         // 1回のBatchWriteSpansで送信するspanの最大数
+	traceFlushInterval = time.Second // spanを送信する間隔
+)
+
+// tracer Cloud Traceにspanを送信する
+// spanはキューに追加され、ワーカーがまとめて送信する。キューが一杯の場合は破棄する
+type tracer struct {
+	projectID string
+	opts      []option.ClientOption
+	queue     chan *tracepb.Span
+	done      chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// WithTraceSpans グループ化されたリクエストとStartSpanの区間をCloud Traceのspanとして送信する
+// 別途トレースの設定をしていないサービスでもレイテンシのウォーターフォールを確認できる。
+// エントリのTraceはprojects/{projectID}/traces/{32桁の16進数}の形式になり、Cloud Traceと関連付けられる。10進数のTraceIDは16進数にする
+// NewLocal, NewRecorderで作成したservice、書き込み先がプロジェクト以外のserviceでは何もしない
+func (s Service) WithTraceSpans() Service {
+	if s.proto == nil {
+		return s
+	}
+	projectID, ok := parentProject(s.proto.projectID)
+	if !ok {
+		return s
+	}
+	t := &tracer{
+		projectID: projectID,
+		opts:      s.proto.opts,
+		queue:     make(chan *tracepb.Span, 10*traceBatchSize),
+		done:      make(chan struct{}),
+	}
+	go t.run()
+	s.ctx = updateState(s.ctx, func(st *state) {
+		st.tracer = t
+		if st.traceIDs == nil {
+			st.traceIDs = hexTraceID
+		}
+	})
+	return s
+}
+
+// hexTraceID Cloud Traceの形式のTraceID
+func hexTraceID() string {
+	return fmt.Sprintf("%016x%016x", newSpanIDValue(), newSpanIDValue())
+}
+
+// traceName エントリのTraceに設定するtraceのリソース名
+func (t *tracer) traceName(traceID string) string {
+	return "projects/" + t.projectID + "/traces/" + spanTraceID(traceID)
+}
+
+// spanTraceID エントリのTraceからCloud TraceのTraceIDを取り出す
+// 10進数のTraceIDは32桁の16進数にする
+func spanTraceID(trace string) string {
+	if i := strings.LastIndex(trace, "/"); 0 <= i {
+		trace = trace[i+1:]
+	}
+	if n, err := strconv.ParseUint(trace, 10, 64); err == nil && len(trace) != 32 {
+		return fmt.Sprintf("%032x", n)
+	}
+	return trace
+}
+
+// record spanをキューに追加する
+func (t *tracer) record(trace, spanID, parentSpanID, name string, start, end time.Time, attrs map[string]string) {
+	st, err := ptypes.TimestampProto(start)
+	if err != nil {
+		return
+	}
+	et, err := ptypes.TimestampProto(end)
+	if err != nil {
+		return
+	}
+	attributes := &tracepb.Span_Attributes{AttributeMap: map[string]*tracepb.AttributeValue{}}
+	for k, v := range attrs {
+		attributes.AttributeMap[k] = &tracepb.AttributeValue{
+			Value: &tracepb.AttributeValue_StringValue{StringValue: &tracepb.TruncatableString{Value: v}},
+		}
+	}
+	span := &tracepb.Span{
+		Name:         "projects/" + t.projectID + "/traces/" + spanTraceID(trace) + "/spans/" + spanID,
+		SpanId:       spanID,
+		ParentSpanId: parentSpanID,
+		DisplayName:  &tracepb.TruncatableString{Value: name},
+		StartTime:    st,
+		EndTime:      et,
+		Attributes:   attributes,
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.queue <- span:
+	default:
+		log.Printf("glbr: trace span queue is full, span %s dropped", name)
+	}
+}
+
+// run キューのspanをまとめて送信する
+func (t *tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+	var (
+		client *trace.Client
+		batch  []*tracepb.Span
+	)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		c := context.Background()
+		if client == nil {
+			var err error
+			if client, err = trace.NewClient(c, t.opts...); err != nil {
+				log.Printf("glbr: trace client: %v", err)
+				batch = batch[:0]
+				return
+			}
+		}
+		if err := client.BatchWriteSpans(c, &tracepb.BatchWriteSpansRequest{
+			Name:  "projects/" + t.projectID,
+			Spans: batch,
+		}); err != nil {
+			log.Printf("glbr: %d trace spans dropped: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case span, ok := <-t.queue:
+			if !ok {
+				flush()
+				if client != nil {
+					client.Close()
+				}
+				return
+			}
+			batch = append(batch, span)
+			if traceBatchSize <= len(batch) {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// close キューに残ったspanを送信してから閉じる
+func (t *tracer) close() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+	<-t.done
+}
+
+// StartSpan nameの区間をグループのspanの子spanとして記録する
+// 区間内のエントリには子spanのSpanIDが付く。返された関数で区間を終了する。WithTraceSpansの指定がない場合は何もしない
+//
+//	c, end := glbr.StartSpan(r.Context(), "query")
+//	defer end()
+func StartSpan(c context.Context, name string) (context.Context, func()) {
+	st, _ := getState(c)
+	if st.tracer == nil || st.traceID == nil {
+		return c, func() {}
+	}
+	var parent string
+	switch {
+	case st.span != nil:
+		parent = st.span.id
+	case st.group != nil:
+		parent = st.group.spanID
+	}
+	id := newSpanID()
+	c = updateState(c, func(st *state) { st.span = &span{id: id, sampled: true} })
+	clock := clockFrom(c)
+	start := clock.Now()
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			st.tracer.record(*st.traceID, id, parent, name, start, clock.Now(), nil)
+		})
+	}
+}
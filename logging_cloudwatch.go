@@ -0,0 +1,91 @@
+package glbr
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// CloudWatchEvent CloudWatch Logsのログイベント
+type CloudWatchEvent struct {
+	Timestamp time.Time
+	Message   string
+}
+
+// CloudWatchClient CloudWatch LogsのPutLogEvents
+// AWS SDKのクライアントをこのinterfaceに合わせて渡す。eventsは時刻順に並んでいる
+//
+//	func (c client) PutLogEvents(ctx context.Context, group, stream string, events []glbr.CloudWatchEvent) error {
+//		in := &cloudwatchlogs.PutLogEventsInput{LogGroupName: &group, LogStreamName: &stream}
+//		for _, e := range events {
+//			in.LogEvents = append(in.LogEvents, types.InputLogEvent{Timestamp: aws.Int64(e.Timestamp.UnixMilli()), Message: aws.String(e.Message)})
+//		}
+//		_, err := c.cw.PutLogEvents(ctx, in)
+//		return err
+//	}
+type CloudWatchClient interface {
+	PutLogEvents(c context.Context, group, stream string, events []CloudWatchEvent) error
+}
+
+// CloudWatchOptions NewCloudWatchSinkの設定
+type CloudWatchOptions struct {
+	Stream   func(logID string) string // logIDの書き込み先のログストリーム Default: logID
+	Interval time.Duration             // 送信間隔 Default: 5秒
+}
+
+// PutLogEventsの1回あたりの上限
+const (
+	cloudWatchMaxEvents = 10000
+	cloudWatchMaxBytes  = 1 << 20
+	cloudWatchOverhead  = 26 // イベント毎に加算されるバイト数
+)
+
+// NewCloudWatchSink エントリをSinkRecordのJSONとしてCloudWatch Logsのgroupに書き込むSink
+// GCP以外で動く場合も同じAPIでログを出力するマルチクラウドのサービス向け。ログストリームは事前に作成しておく
+//
+//	log = log.AddSink(glbr.NewCloudWatchSink(client{cw}, "/app/api", glbr.CloudWatchOptions{}), glbr.SinkFilter{})
+func NewCloudWatchSink(client CloudWatchClient, group string, opts CloudWatchOptions) Sink {
+	if opts.Stream == nil {
+		opts.Stream = func(logID string) string { return logID }
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	return newBatchSink("cloudwatch", opts.Interval, cloudWatchMaxEvents, func(records []SinkRecord) error {
+		streams := map[string][]CloudWatchEvent{}
+		var order []string
+		for _, record := range records {
+			message, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			stream := opts.Stream(record.LogID)
+			if _, ok := streams[stream]; !ok {
+				order = append(order, stream)
+			}
+			streams[stream] = append(streams[stream], CloudWatchEvent{Timestamp: record.Timestamp, Message: string(message)})
+		}
+		c, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		for _, stream := range order {
+			events := streams[stream]
+			sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+			for 0 < len(events) {
+				n, size := 0, 0
+				for n < len(events) && size+len(events[n].Message)+cloudWatchOverhead <= cloudWatchMaxBytes {
+					size += len(events[n].Message) + cloudWatchOverhead
+					n++
+				}
+				if n == 0 {
+					n = 1 // 上限を超える1件はそのまま送り、エラーにする
+				}
+				if err := client.PutLogEvents(c, group, stream, events[:n]); err != nil {
+					return err
+				}
+				events = events[n:]
+			}
+		}
+		return nil
+	})
+}
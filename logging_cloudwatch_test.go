@@ -0,0 +1,92 @@
+package glbr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// fakeCloudWatch PutLogEventsの呼び出しを記録するCloudWatchClient
+type fakeCloudWatch struct {
+	calls []fakePut
+	err   error
+}
+
+type fakePut struct {
+	group, stream string
+	events        []CloudWatchEvent
+}
+
+func (f *fakeCloudWatch) PutLogEvents(c context.Context, group, stream string, events []CloudWatchEvent) error {
+	f.calls = append(f.calls, fakePut{group: group, stream: stream, events: append([]CloudWatchEvent(nil), events...)})
+	return f.err
+}
+
+func TestCloudWatchSink(t *testing.T) {
+	client := &fakeCloudWatch{}
+	sink := NewCloudWatchSink(client, "/app/api", CloudWatchOptions{Stream: func(logID string) string { return "stream-" + logID }, Interval: time.Hour})
+	ts := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	sink.Send("app", logging.Entry{Timestamp: ts.Add(time.Second), Severity: logging.Info, Payload: "second"})
+	sink.Send("audit", logging.Entry{Timestamp: ts, Payload: "audit"})
+	sink.Send("app", logging.Entry{Timestamp: ts, Severity: logging.Info, Payload: "first"})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.calls) != 2 {
+		t.Fatalf("calls = %d, want one per stream", len(client.calls))
+	}
+	app := client.calls[0]
+	if app.group != "/app/api" || app.stream != "stream-app" || len(app.events) != 2 {
+		t.Fatalf("first call = %s %s %d events", app.group, app.stream, len(app.events))
+	}
+	if !app.events[0].Timestamp.Equal(ts) {
+		t.Errorf("events are not ordered by time: %v", app.events)
+	}
+	var record SinkRecord
+	if err := json.Unmarshal([]byte(app.events[0].Message), &record); err != nil || record.Payload != "first" || record.LogID != "app" {
+		t.Errorf("message = %s (%v)", app.events[0].Message, err)
+	}
+	if client.calls[1].stream != "stream-audit" {
+		t.Errorf("second stream = %s", client.calls[1].stream)
+	}
+}
+
+// 1回のPutLogEventsのサイズの上限を超える場合は分割する
+func TestCloudWatchSinkSplit(t *testing.T) {
+	client := &fakeCloudWatch{}
+	sink := NewCloudWatchSink(client, "/app/api", CloudWatchOptions{Interval: time.Hour})
+	large := strings.Repeat("x", cloudWatchMaxBytes/2)
+	for i := 0; i < 3; i++ {
+		sink.Send("app", logging.Entry{Timestamp: time.Now(), Payload: large})
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.calls) != 3 {
+		t.Fatalf("calls = %d, want 3", len(client.calls))
+	}
+	for _, call := range client.calls {
+		size := 0
+		for _, e := range call.events {
+			size += len(e.Message) + cloudWatchOverhead
+		}
+		if cloudWatchMaxBytes < size && 1 < len(call.events) {
+			t.Errorf("call of %d events is %d bytes", len(call.events), size)
+		}
+	}
+}
+
+func TestCloudWatchSinkError(t *testing.T) {
+	client := &fakeCloudWatch{err: errors.New("ResourceNotFoundException: stream does not exist")}
+	sink := NewCloudWatchSink(client, "/app/api", CloudWatchOptions{Interval: time.Hour})
+	sink.Send("app", logging.Entry{Timestamp: time.Now(), Payload: "lost"})
+	if err := sink.Close(); err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		t.Errorf("Close = %v, want the client error", err)
+	}
+}
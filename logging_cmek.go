@@ -0,0 +1,80 @@
+package glbr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// loggingEndpoint Cloud LoggingのREST API
+// バケットとCMEKの設定はgRPCのクライアントで取得できないため、REST APIを使う
+const loggingEndpoint = "https://logging.googleapis.com/v2/"
+
+// cmekExpectation WithCMEKで指定された期待するCMEKの設定
+type cmekExpectation struct {
+	bucket     LogBucket
+	kmsKeyName string
+}
+
+// WithCMEK bucketが顧客管理の暗号鍵(CMEK)kmsKeyNameで暗号化されていることを、Validateで確認する
+// 規制のあるワークロードで、鍵が設定されていないバケットに書き込まないよう起動時に確認する。
+// エントリの振り分けはRouteToBucketで設定する
+//
+//	log = log.WithCMEK(bucket, "projects/p/locations/europe-west1/keyRings/r/cryptoKeys/k")
+//	if err := log.Validate(c); err != nil { ... }
+func (s Service) WithCMEK(bucket LogBucket, kmsKeyName string) Service {
+	if bucket.Location == "" || bucket.BucketID == "" {
+		panic(ErrInvalidBucket)
+	}
+	s.cmek = &cmekExpectation{bucket: bucket, kmsKeyName: kmsKeyName}
+	return s
+}
+
+// bucketResource バケットのREST APIのレスポンス
+type bucketResource struct {
+	Name         string `json:"name"`
+	CmekSettings *struct {
+		KmsKeyName string `json:"kmsKeyName"`
+	} `json:"cmekSettings"`
+}
+
+// validateCMEK バケットのCMEKの設定を確認する
+func (s Service) validateCMEK(c context.Context) error {
+	if s.cmek == nil {
+		return nil
+	}
+	client, _, err := htransport.NewClient(c, append(s.proto.opts, option.WithScopes("https://www.googleapis.com/auth/logging.read"))...)
+	if err != nil {
+		return err
+	}
+	name := logParent(s.proto.projectID) + "/locations/" + s.cmek.bucket.Location + "/buckets/" + s.cmek.bucket.BucketID
+	req, err := http.NewRequestWithContext(c, http.MethodGet, loggingEndpoint+name, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("get bucket %s: %w", name, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("get bucket %s: %s", name, res.Status)
+	}
+	var bucket bucketResource
+	if err := json.NewDecoder(res.Body).Decode(&bucket); err != nil {
+		return fmt.Errorf("get bucket %s: %w", name, err)
+	}
+	if bucket.CmekSettings == nil || bucket.CmekSettings.KmsKeyName == "" {
+		return fmt.Errorf("%w: bucket %s is not encrypted with a customer-managed key", ErrCMEKMismatch, name)
+	}
+	// 鍵のバージョン(cryptoKeyVersions/...)が含まれていても同じ鍵とする
+	if got := bucket.CmekSettings.KmsKeyName; got != s.cmek.kmsKeyName && !strings.HasPrefix(got, s.cmek.kmsKeyName+"/") {
+		return fmt.Errorf("%w: bucket %s uses %s, expected %s", ErrCMEKMismatch, name, got, s.cmek.kmsKeyName)
+	}
+	return nil
+}
@@ -0,0 +1,513 @@
+package glbr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"google.golang.org/api/option"
+)
+
+// Config 設定ファイルから読み込むserviceの設定
+// JSONの場合はLoadConfigでそのまま読み込める。YAMLの場合はデコーダー(gopkg.in/yaml.v2等のUnmarshal)をLoadConfigに渡す
+// キーはどちらの形式でもjsonタグの名前で、未知のキーはエラーになる
+//
+//	{
+//	  "project_id": "${GOOGLE_CLOUD_PROJECT}",
+//	  "log_id": "app",
+//	  "parent_log_id": "request",
+//	  "min_severity": "${LOG_LEVEL:-info}",
+//	  "rate_limit": {"debug": 100},
+//	  "sinks": [{"type": "loki", "url": "http://loki:3100", "min_severity": "warning"}]
+//	}
+type Config struct {
+	ProjectID     string              `json:"project_id"`
+	LogID         string              `json:"log_id"`
+	ParentLogID   string              `json:"parent_log_id,omitempty"` // GroupedByに渡すlogID。serviceには設定されない
+	AuditLogID    string              `json:"audit_log_id,omitempty"`
+	AuditChain    bool                `json:"audit_chain,omitempty"`
+	Output        string              `json:"output,omitempty"` // cloud, local, agent, noop Default: cloud
+	Path          string              `json:"path,omitempty"`   // outputがagentの場合に追記するファイル
+	MinSeverity   string              `json:"min_severity,omitempty"`
+	RateLimit     map[string]float64  `json:"rate_limit,omitempty"` // severity毎の1秒あたりのエントリ数
+	TraceHeaders  *TraceHeadersConfig `json:"trace_headers,omitempty"`
+	Deduplication ConfigDuration      `json:"deduplication,omitempty"`
+	SlowRequest   ConfigDuration      `json:"slow_request,omitempty"`
+	DebugBuffer   *DebugBufferConfig  `json:"debug_buffer,omitempty"`
+	InFlight      bool                `json:"in_flight,omitempty"`
+	CanonicalLine bool                `json:"canonical_log_line,omitempty"`
+	SyncWrite     bool                `json:"sync_write,omitempty"`
+	Replay        *ReplayConfig       `json:"replay,omitempty"`
+	Webhook       *WebhookConfig      `json:"webhook,omitempty"`
+	Sinks         []SinkConfig        `json:"sinks,omitempty"`
+	Labels        map[string]string   `json:"labels,omitempty"` // 全てのエントリに付ける共通ラベル
+	Sampling      *SamplingConfig     `json:"sampling,omitempty"`
+	Redaction     *RedactionConfig    `json:"redaction,omitempty"`
+}
+
+// SamplingConfig WithSamplingの設定
+type SamplingConfig struct {
+	Rate                 float64 `json:"rate"` // 0から1
+	UnsampledMinSeverity string  `json:"unsampled_min_severity,omitempty"`
+}
+
+// RedactionConfig WithRedactionの設定
+type RedactionConfig struct {
+	Fields      []string `json:"fields,omitempty"`
+	QueryParams []string `json:"query_params,omitempty"`
+}
+
+// TraceHeadersConfig WithTraceHeadersの設定
+type TraceHeadersConfig struct {
+	UnsampledMinSeverity string `json:"unsampled_min_severity,omitempty"`
+	SkipLinking          bool   `json:"skip_linking,omitempty"`
+}
+
+// DebugBufferConfig WithDebugBufferの設定
+type DebugBufferConfig struct {
+	Size    int            `json:"size"`
+	Latency ConfigDuration `json:"latency,omitempty"`
+}
+
+// ReplayConfig WithReplayBundlesの設定
+type ReplayConfig struct {
+	Sink          SinkConfig `json:"sink"`
+	MinSeverity   string     `json:"min_severity,omitempty"`
+	BodyLimit     int        `json:"body_limit,omitempty"`
+	RedactHeaders []string   `json:"redact_headers,omitempty"`
+	RedactQuery   []string   `json:"redact_query,omitempty"`
+}
+
+// WebhookConfig WithWebhookの設定
+type WebhookConfig struct {
+	URL         string         `json:"url"`
+	Format      string         `json:"format,omitempty"` // slack, pagerduty Default: slack
+	RoutingKey  string         `json:"routing_key,omitempty"`
+	Source      string         `json:"source,omitempty"`
+	MinSeverity string         `json:"min_severity,omitempty"`
+	Interval    ConfigDuration `json:"interval,omitempty"`
+	DedupWindow ConfigDuration `json:"dedup_window,omitempty"`
+	Timeout     ConfigDuration `json:"timeout,omitempty"`
+}
+
+// SinkConfig AddSinkで追加するSinkの設定
+// typeは loki, opensearch, agent, named。namedはNewServiceに渡したSinkをnameで参照する
+type SinkConfig struct {
+	Type         string            `json:"type"`
+	Name         string            `json:"name,omitempty"`
+	URL          string            `json:"url,omitempty"`
+	Path         string            `json:"path,omitempty"` // agent: 追記するファイル。空の場合は標準出力
+	Labels       []string          `json:"labels,omitempty"`
+	StaticLabels map[string]string `json:"static_labels,omitempty"`
+	TenantID     string            `json:"tenant_id,omitempty"`
+	IndexPrefix  string            `json:"index_prefix,omitempty"`
+	Username     string            `json:"username,omitempty"`
+	Password     string            `json:"password,omitempty"`
+	Interval     ConfigDuration    `json:"interval,omitempty"`
+	MinSeverity  string            `json:"min_severity,omitempty"`
+	MatchLabels  map[string]string `json:"match_labels,omitempty"`
+	LogIDs       []string          `json:"log_ids,omitempty"`
+}
+
+// ConfigDuration "1m30s"の形式で記述する期間
+type ConfigDuration time.Duration
+
+// UnmarshalText time.ParseDurationの形式
+func (d *ConfigDuration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = ConfigDuration(v)
+	return nil
+}
+
+// MarshalText time.Duration.Stringの形式
+func (d ConfigDuration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// configEnv ${NAME}, ${NAME:-default}
+var configEnv = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandConfigEnv 文字列の値の環境変数を展開する
+// 設定されておらず、デフォルト値もない環境変数の名前をmissingに追加する。
+// YAMLのデコーダーが返すmap[interface{}]interface{}はmap[string]interface{}にする
+func expandConfigEnv(v interface{}, missing *[]string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return configEnv.ReplaceAllStringFunc(v, func(m string) string {
+			sub := configEnv.FindStringSubmatch(m)
+			hasDefault := strings.Contains(m, ":-")
+			if env, ok := os.LookupEnv(sub[1]); ok && (env != "" || !hasDefault) {
+				return env
+			}
+			if hasDefault {
+				return sub[3]
+			}
+			*missing = append(*missing, sub[1])
+			return ""
+		})
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = expandConfigEnv(child, missing)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[fmt.Sprint(k)] = expandConfigEnv(child, missing)
+		}
+		return m
+	case []interface{}:
+		for i, child := range v {
+			v[i] = expandConfigEnv(child, missing)
+		}
+		return v
+	}
+	return v
+}
+
+// ParseConfig dataをunmarshalで読み込み、文字列の値の${NAME}, ${NAME:-default}を環境変数で展開して検証する
+// 展開は読み込んだ後に行うため、環境変数の値に引用符や改行が含まれていても設定の構造は変わらない。
+// 数値や真偽値の項目には使えない。unmarshalがnilの場合はJSONとして読み込む
+func ParseConfig(data []byte, unmarshal func(data []byte, v interface{}) error) (Config, error) {
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+	}
+	var tree interface{}
+	if err := unmarshal(data, &tree); err != nil {
+		return Config{}, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	var missing []string
+	tree = expandConfigEnv(tree, &missing)
+	if 0 < len(missing) {
+		return Config{}, fmt.Errorf("%w: environment variable %s is not set", ErrInvalidConfig, strings.Join(missing, ", "))
+	}
+	b, err := json.Marshal(tree)
+	if err != nil {
+		return Config{}, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	var config Config
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return Config{}, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// LoadConfig pathの設定ファイルをParseConfigで読み込む
+//
+//	config, err := glbr.LoadConfig("/etc/app/logging.json", nil)
+//	config, err := glbr.LoadConfig("/etc/app/logging.yaml", yaml.Unmarshal)
+func LoadConfig(path string, unmarshal func(data []byte, v interface{}) error) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return ParseConfig(data, unmarshal)
+}
+
+// parseSeverityName severityの名前。空の場合はlogging.Default
+func parseSeverityName(name string) (logging.Severity, error) {
+	if name == "" {
+		return logging.Default, nil
+	}
+	severity := logging.ParseSeverity(name)
+	if severity == logging.Default && !strings.EqualFold(name, "default") {
+		return logging.Default, fmt.Errorf("unknown severity %q", name)
+	}
+	return severity, nil
+}
+
+// Validate 設定の誤りを全て検出し、ErrInvalidConfigとしてまとめて返す
+func (c Config) Validate() error {
+	var problems []string
+	check := func(field string, err error) {
+		if err != nil {
+			problems = append(problems, field+": "+err.Error())
+		}
+	}
+	severity := func(field, name string) {
+		_, err := parseSeverityName(name)
+		check(field, err)
+	}
+	check("log_id", validateLogID(c.LogID))
+	switch c.Output {
+	case "", "cloud":
+		check("project_id", validateProjectID(c.ProjectID))
+	case "agent":
+		if c.Path == "" {
+			check("path", fmt.Errorf("required for agent output"))
+		}
+	case "local", "noop":
+	default:
+		check("output", fmt.Errorf("unknown output %q", c.Output))
+	}
+	if c.ParentLogID != "" {
+		check("parent_log_id", validateLogID(c.ParentLogID))
+		if c.ParentLogID == c.LogID {
+			check("parent_log_id", ErrSameLogID)
+		}
+	}
+	if c.AuditLogID != "" {
+		check("audit_log_id", validateLogID(c.AuditLogID))
+	}
+	severity("min_severity", c.MinSeverity)
+	for name, rate := range c.RateLimit {
+		severity("rate_limit", name)
+		if rate < 0 {
+			check("rate_limit."+name, fmt.Errorf("negative rate"))
+		}
+	}
+	if c.TraceHeaders != nil {
+		severity("trace_headers.unsampled_min_severity", c.TraceHeaders.UnsampledMinSeverity)
+	}
+	if c.Sampling != nil {
+		if c.Sampling.Rate < 0 || 1 < c.Sampling.Rate {
+			check("sampling.rate", ErrInvalidSamplingRate)
+		}
+		severity("sampling.unsampled_min_severity", c.Sampling.UnsampledMinSeverity)
+	}
+	if c.DebugBuffer != nil && c.DebugBuffer.Size <= 0 {
+		check("debug_buffer.size", fmt.Errorf("must be positive"))
+	}
+	if c.Replay != nil {
+		severity("replay.min_severity", c.Replay.MinSeverity)
+		problems = append(problems, c.Replay.Sink.problems("replay.sink")...)
+	}
+	if c.Webhook != nil {
+		if c.Webhook.URL == "" {
+			check("webhook.url", fmt.Errorf("required"))
+		}
+		switch c.Webhook.Format {
+		case "", "slack":
+		case "pagerduty":
+			if c.Webhook.RoutingKey == "" {
+				check("webhook.routing_key", fmt.Errorf("required for pagerduty"))
+			}
+		default:
+			check("webhook.format", fmt.Errorf("unknown format %q", c.Webhook.Format))
+		}
+		severity("webhook.min_severity", c.Webhook.MinSeverity)
+	}
+	for i, sink := range c.Sinks {
+		problems = append(problems, sink.problems(fmt.Sprintf("sinks[%d]", i))...)
+	}
+	if 0 < len(problems) {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// problems Sinkの設定の誤り
+func (sc SinkConfig) problems(field string) []string {
+	var problems []string
+	switch sc.Type {
+	case "loki", "opensearch":
+		if sc.URL == "" {
+			problems = append(problems, field+".url: required for "+sc.Type)
+		}
+	case "agent":
+	case "named":
+		if sc.Name == "" {
+			problems = append(problems, field+".name: required for named")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("%s.type: unknown type %q", field, sc.Type))
+	}
+	if _, err := parseSeverityName(sc.MinSeverity); err != nil {
+		problems = append(problems, field+".min_severity: "+err.Error())
+	}
+	return problems
+}
+
+// stdoutWriter 標準出力。Closeで閉じないようにio.Closerを隠す
+type stdoutWriter struct {
+	io.Writer
+}
+
+// sink 設定からSinkを作成する
+func (sc SinkConfig) sink(named map[string]Sink) (Sink, error) {
+	switch sc.Type {
+	case "loki":
+		return NewLokiSink(sc.URL, LokiOptions{
+			Labels:       sc.Labels,
+			StaticLabels: sc.StaticLabels,
+			TenantID:     sc.TenantID,
+			Interval:     time.Duration(sc.Interval),
+		}), nil
+	case "opensearch":
+		return NewOpenSearchSink(sc.URL, OpenSearchOptions{
+			IndexPrefix: sc.IndexPrefix,
+			Username:    sc.Username,
+			Password:    sc.Password,
+			Interval:    time.Duration(sc.Interval),
+		}), nil
+	case "agent":
+		if sc.Path == "" {
+			return NewAgentSink(stdoutWriter{os.Stdout}), nil
+		}
+		f, err := os.OpenFile(sc.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return NewAgentSink(f), nil
+	case "named":
+		if sink, ok := named[sc.Name]; ok {
+			return sink, nil
+		}
+		return nil, fmt.Errorf("%w: sink %q is not given", ErrInvalidConfig, sc.Name)
+	}
+	return nil, fmt.Errorf("%w: unknown sink type %q", ErrInvalidConfig, sc.Type)
+}
+
+// filter 設定からSinkFilterを作成する
+func (sc SinkConfig) filter() SinkFilter {
+	minimum, _ := parseSeverityName(sc.MinSeverity)
+	return SinkFilter{MinSeverity: minimum, Labels: sc.MatchLabels, LogIDs: sc.LogIDs}
+}
+
+// rateLimits RateLimitのseverityを変換する
+func (c Config) rateLimits() map[logging.Severity]float64 {
+	if len(c.RateLimit) == 0 {
+		return nil
+	}
+	limits := make(map[logging.Severity]float64, len(c.RateLimit))
+	for name, rate := range c.RateLimit {
+		severity, _ := parseSeverityName(name)
+		limits[severity] = rate
+	}
+	return limits
+}
+
+// NewService 設定からserviceを作成する
+// namedはtypeがnamedのSinkの参照先。GCS, BigQuery等のクライアントが必要なSinkはコードで作成して渡す
+// 失敗した場合は作成したSinkを閉じる。namedのSinkは閉じない
+//
+//	log, err := config.NewService(map[string]glbr.Sink{"archive": glbr.NewGCSSink(bucket, "logs/", 0)})
+//	http.Handle("/", log.GroupedBy(config.ParentLogID)(handler))
+func (c Config) NewService(named map[string]Sink, opts ...option.ClientOption) (s Service, err error) {
+	if err := c.Validate(); err != nil {
+		return Service{}, err
+	}
+	var owned []Sink
+	defer func() {
+		if err != nil {
+			closeAll(owned)
+		}
+	}()
+	sink := func(sc SinkConfig) (Sink, error) {
+		sink, err := sc.sink(named)
+		if err == nil && sc.Type != "named" {
+			owned = append(owned, sink)
+		}
+		return sink, err
+	}
+	sinks := make([]Sink, len(c.Sinks))
+	for i, sc := range c.Sinks {
+		if sinks[i], err = sink(sc); err != nil {
+			return Service{}, err
+		}
+	}
+	var replaySink Sink
+	if c.Replay != nil {
+		if replaySink, err = sink(c.Replay.Sink); err != nil {
+			return Service{}, err
+		}
+	}
+	switch c.Output {
+	case "", "cloud":
+		s, err = NewLogging(c.ProjectID, c.LogID, opts...)
+	case "local":
+		s, err = NewLocal(c.LogID, os.Stderr)
+	case "agent":
+		s, err = NewAgentOutput(c.LogID, c.Path)
+	case "noop":
+		s = NewNoOp()
+	}
+	if err != nil {
+		return Service{}, err
+	}
+	// noopのserviceはseverityに関わらず出力しない
+	if minimum, _ := parseSeverityName(c.MinSeverity); minimum != logging.Default && c.Output != "noop" {
+		s = s.WithMinSeverity(minimum)
+	}
+	if limits := c.rateLimits(); limits != nil {
+		s = s.WithRateLimit(limits)
+	}
+	if c.TraceHeaders != nil {
+		unsampled, _ := parseSeverityName(c.TraceHeaders.UnsampledMinSeverity)
+		s = s.WithTraceHeaders(UnsampledPolicy{MinSeverity: unsampled, SkipLinking: c.TraceHeaders.SkipLinking})
+	}
+	if c.Sampling != nil {
+		unsampled, _ := parseSeverityName(c.Sampling.UnsampledMinSeverity)
+		s = s.WithSampling(c.Sampling.Rate, unsampled)
+	}
+	if c.Redaction != nil {
+		s = s.WithRedaction(RedactionRules{Fields: c.Redaction.Fields, QueryParams: c.Redaction.QueryParams})
+	}
+	if c.AuditLogID != "" {
+		s = s.WithAudit(c.AuditLogID, c.AuditChain)
+	}
+	if 0 < c.Deduplication {
+		s = s.WithDeduplication(time.Duration(c.Deduplication))
+	}
+	if 0 < c.SlowRequest {
+		s = s.WithSlowRequest(time.Duration(c.SlowRequest))
+	}
+	if c.DebugBuffer != nil {
+		s = s.WithDebugBuffer(c.DebugBuffer.Size, time.Duration(c.DebugBuffer.Latency))
+	}
+	if c.InFlight {
+		s = s.WithInFlight()
+	}
+	if c.CanonicalLine {
+		s = s.WithCanonicalLogLine()
+	}
+	if c.SyncWrite {
+		s = s.WithSyncWrite()
+	}
+	if len(c.Labels) != 0 {
+		s = s.Option(Label(c.Labels))
+	}
+	if w := c.Webhook; w != nil {
+		minimum, _ := parseSeverityName(w.MinSeverity)
+		opts := WebhookOptions{MinSeverity: minimum, Interval: time.Duration(w.Interval), DedupWindow: time.Duration(w.DedupWindow), Timeout: time.Duration(w.Timeout)}
+		if w.Format == "pagerduty" {
+			opts.Format = PagerDutyWebhook(w.RoutingKey, w.Source)
+		}
+		s = s.WithWebhook(w.URL, opts)
+	}
+	for i, sc := range c.Sinks {
+		s = s.AddSink(sinks[i], sc.filter())
+	}
+	if rc := c.Replay; rc != nil {
+		minimum, _ := parseSeverityName(rc.MinSeverity)
+		s = s.WithReplayBundles(replaySink, ReplayOptions{
+			MinSeverity:   minimum,
+			BodyLimit:     rc.BodyLimit,
+			RedactHeaders: rc.RedactHeaders,
+			RedactQuery:   rc.RedactQuery,
+		})
+	}
+	return s, nil
+}
+
+// closeAll sinksを閉じる
+func closeAll(sinks []Sink) {
+	for _, sink := range sinks {
+		sink.Close()
+	}
+}
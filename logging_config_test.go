@@ -0,0 +1,95 @@
+package glbr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestParseConfigEnv(t *testing.T) {
+	t.Setenv("GLBR_TEST_VERSION", `v1", "min_severity": "Emergency`)
+	config, err := ParseConfig([]byte(`{"log_id": "app", "project_id": "${GLBR_TEST_PROJECT:-my-project}", "labels": {"version": "${GLBR_TEST_VERSION}"}}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Labels["version"] != `v1", "min_severity": "Emergency` {
+		t.Errorf("labels.version = %q", config.Labels["version"])
+	}
+	if config.MinSeverity != "" {
+		t.Errorf("min_severity = %q, want empty", config.MinSeverity)
+	}
+	if config.ProjectID != "my-project" {
+		t.Errorf("project_id = %q", config.ProjectID)
+	}
+	if _, err := ParseConfig([]byte(`{"log_id": "${GLBR_TEST_MISSING}"}`), nil); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("missing env err = %v", err)
+	}
+}
+
+func TestParseConfigSampling(t *testing.T) {
+	for _, data := range []string{
+		`{"log_id": "app", "output": "noop", "sampling": {"rate": 1.5}}`,
+		`{"log_id": "app", "output": "noop", "sampling": {"rate": 0.5, "unsampled_min_severity": "Loud"}}`,
+		`{"log_id": "app", "output": "noop", "sampling": {"rate": 0.5, "unknown": true}}`,
+	} {
+		if _, err := ParseConfig([]byte(data), nil); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: err = %v", data, err)
+		}
+	}
+	config, err := ParseConfig([]byte(`{"log_id": "app", "output": "noop", "sampling": {"rate": 0.25}, "redaction": {"fields": ["password"]}}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Sampling.Rate != 0.25 || len(config.Redaction.Fields) != 1 {
+		t.Errorf("config = %+v", config)
+	}
+}
+
+// noopのserviceはmin_severityやEmergencyより高いseverityでも出力しない
+func TestNewServiceNoOp(t *testing.T) {
+	config, err := ParseConfig([]byte(`{"log_id": "app", "output": "noop", "min_severity": "Debug"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := config.NewService(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+	for _, severity := range []logging.Severity{logging.Debug, logging.Emergency, logging.Emergency + 1, logging.Emergency + 100} {
+		if Enabled(s.Context(), severity) {
+			t.Errorf("Enabled(%v) = true", severity)
+		}
+	}
+}
+
+// 設定の誤りはlogging_errors.goのエラーでpanicする
+func TestConfigurationPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func()
+		want error
+	}{
+		{"nil request", func() {
+			s, _, _ := NewRecorder("app")
+			s.GroupedBy("parent")(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), nil)
+		}, ErrNilRequest},
+		{"workers", func() { NewNoOp().WithAsyncParent(0, 10) }, ErrInvalidWorkers},
+		{"trace ids", func() { FixedTraceIDs() }, ErrEmptyTraceIDs},
+		{"trusted proxy", func() { NewNoOp().WithTrustedProxies("proxy") }, ErrInvalidTrustedProxy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if err, _ := recover().(error); !errors.Is(err, tt.want) {
+					t.Errorf("recovered = %v, want %v", err, tt.want)
+				}
+			}()
+			tt.fn()
+		})
+	}
+}
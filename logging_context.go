@@ -3,72 +3,366 @@ package glbr
 import (
 	"context"
 	"io"
+	"time"
 
 	"cloud.google.com/go/logging"
 )
 
 var (
-	loggerKey            = "loggerClient"       // logger key
-	requestKey           = "request"            // request key
-	severityKey          = "severity"           // severity key
-	traceIDKey           = "trace-id"           // traceid key
-	logIDKey             = "log-id"             // logid key
-	iowriteKey           = "io-write"           // iowrite key
-	groupKey             = "group"              // group key
-	monitoredResourceKey = "monitored-resource" // monitoredresource key
+	stateKey = "glbr-state" // state key
+	connKey  = "conn"       // connection key
+	panicKey = "panic"      // Recoverのpanicの記録済みフラグ key
 )
 
-// logger setter
-func setLogger(c context.Context, logger *logging.Logger) context.Context {
-	return context.WithValue(c, &loggerKey, logger)
+// state contextに保持するglbrの状態
+// 1つのキーにまとめて保持し、更新時はコピーを作成する
+type state struct {
+	logger      entryLogger
+	projects    func(projectID string) entryLogger // ForProjectで使うプロジェクト毎のlogger
+	proto       *protoLogger
+	usage       *usageMeter
+	traceID     *string
+	span        *span
+	baggage     map[string]string // WithBaggageで許可されたbaggage
+	mirrors     []mirror
+	format      Formatter
+	group       *group
+	auditor     *auditor
+	progress    *progress
+	deduper     *deduper
+	rateLimiter *rateLimiter
+	tenant      *tenant
+	notifier    *notifier
+	sinks       []sinkRoute
+	callSites   *callSites
+	live        *liveConfig
+	redactor    *redactor
+	naming      *fieldNaming
+	clock       Clock
+	traceIDs    TraceIDGenerator
+	tracer      *tracer
+	minimum     logging.Severity // これより低いseverityは出力しない
+	syncWrite   bool             // バッファせずに同期的に書き込む
+	entrySpans  bool             // エントリ毎にSpanIDを付ける
+	panicDump   bool             // panicの記録に全てのgoroutineのスタックを含める
+	debugging   bool             // WithDebugHeaderのヘッダーが有効なリクエスト。WatchConfigのmin_severityを無視する
+	noop        bool             // NewNoOpのservice。severityに関わらず出力しない
 }
 
-// logger getter
-func getLogger(c context.Context) (*logging.Logger, bool) {
-	logger, ok := c.Value(&loggerKey).(*logging.Logger)
-	return logger, ok
+// getState state getter
+func getState(c context.Context) (state, bool) {
+	st, ok := c.Value(&stateKey).(*state)
+	if !ok {
+		return state{}, false
+	}
+	return *st, true
+}
+
+// updateState stateのコピーを更新してcontextに設定する
+func updateState(c context.Context, update func(st *state)) context.Context {
+	st, _ := getState(c)
+	update(&st)
+	return context.WithValue(c, &stateKey, &st)
 }
 
-// parent severity setter
-func setSeverity(c context.Context, severity *logging.Severity) context.Context {
-	return context.WithValue(c, &severityKey, severity)
+// mergeState fromで設定されている値をcに引き継ぐ
+// fromでnilのフィールドはcの値のままにする。フラグはどちらかで有効なら有効にする
+// debuggingはリクエスト毎のフラグのため、cの値のままにする。有効な場合はfromのminimumを引き継がない
+func mergeState(c, from context.Context) context.Context {
+	src, ok := getState(from)
+	if !ok {
+		return c
+	}
+	return updateState(c, func(st *state) {
+		if src.logger != nil {
+			st.logger = src.logger
+		}
+		if src.projects != nil {
+			st.projects = src.projects
+		}
+		if src.proto != nil {
+			st.proto = src.proto
+		}
+		if src.usage != nil {
+			st.usage = src.usage
+		}
+		if src.traceID != nil {
+			st.traceID = src.traceID
+		}
+		if src.span != nil {
+			st.span = src.span
+		}
+		if src.baggage != nil {
+			st.baggage = src.baggage
+		}
+		if src.mirrors != nil {
+			st.mirrors = src.mirrors
+		}
+		if src.format != nil {
+			st.format = src.format
+		}
+		if src.group != nil {
+			st.group = src.group
+		}
+		if src.auditor != nil {
+			st.auditor = src.auditor
+		}
+		if src.progress != nil {
+			st.progress = src.progress
+		}
+		if src.deduper != nil {
+			st.deduper = src.deduper
+		}
+		if src.rateLimiter != nil {
+			st.rateLimiter = src.rateLimiter
+		}
+		if src.tenant != nil {
+			st.tenant = src.tenant
+		}
+		if src.notifier != nil {
+			st.notifier = src.notifier
+		}
+		if src.sinks != nil {
+			st.sinks = src.sinks
+		}
+		if src.callSites != nil {
+			st.callSites = src.callSites
+		}
+		if src.live != nil {
+			st.live = src.live
+		}
+		if src.redactor != nil {
+			st.redactor = src.redactor
+		}
+		if src.naming != nil {
+			st.naming = src.naming
+		}
+		if src.clock != nil {
+			st.clock = src.clock
+		}
+		if src.traceIDs != nil {
+			st.traceIDs = src.traceIDs
+		}
+		if src.tracer != nil {
+			st.tracer = src.tracer
+		}
+		if src.minimum != logging.Default && !st.debugging {
+			st.minimum = src.minimum
+		}
+		st.syncWrite = st.syncWrite || src.syncWrite
+		st.entrySpans = st.entrySpans || src.entrySpans
+		st.panicDump = st.panicDump || src.panicDump
+		st.noop = st.noop || src.noop
+	})
 }
 
-// parent severity getter
-func getSeverity(c context.Context) (*logging.Severity, bool) {
-	severity, ok := c.Value(&severityKey).(*logging.Severity)
-	return severity, ok
+// logger setter
+func setLogger(c context.Context, logger entryLogger) context.Context {
+	return updateState(c, func(st *state) { st.logger = logger })
+}
+
+// logger getter
+func getLogger(c context.Context) (entryLogger, bool) {
+	st, _ := getState(c)
+	return st.logger, st.logger != nil
 }
 
 // traceid setter
 func setTraceID(c context.Context, traceID *string) context.Context {
-	return context.WithValue(c, &traceIDKey, traceID)
+	return updateState(c, func(st *state) { st.traceID = traceID })
 }
 
 // traceid getter
 func getTraceID(c context.Context) (*string, bool) {
-	traceID, ok := c.Value(&traceIDKey).(*string)
-	return traceID, ok
+	st, _ := getState(c)
+	return st.traceID, st.traceID != nil
 }
 
 // io.Writer setter
+// 出力先をwだけにする
 func setIOWriter(c context.Context, w io.Writer) context.Context {
-	return context.WithValue(c, &iowriteKey, w)
+	return updateState(c, func(st *state) { st.mirrors = []mirror{{w: w}} })
 }
 
-// io.Writer getter
-func getIOWriter(c context.Context) (io.Writer, bool) {
-	w, ok := c.Value(&iowriteKey).(io.Writer)
-	return w, ok
+// io.Writer adder
+func addIOWriter(c context.Context, m mirror) context.Context {
+	return updateState(c, func(st *state) {
+		st.mirrors = append(append(make([]mirror, 0, len(st.mirrors)+1), st.mirrors...), m)
+	})
+}
+
+// io format setter
+func setIOFormat(c context.Context, format Formatter) context.Context {
+	return updateState(c, func(st *state) { st.format = format })
 }
 
 // group setter
-func setGroup(c context.Context, id string) context.Context {
-	return context.WithValue(c, &groupKey, id)
+func setGroup(c context.Context, g *group) context.Context {
+	return updateState(c, func(st *state) { st.group = g })
 }
 
 // gropu getter
-func getGroup(c context.Context) (string, bool) {
-	w, ok := c.Value(&groupKey).(string)
-	return w, ok
+func getGroup(c context.Context) (*group, bool) {
+	st, _ := getState(c)
+	return st.group, st.group != nil
+}
+
+// auditor setter
+func setAuditor(c context.Context, a *auditor) context.Context {
+	return updateState(c, func(st *state) { st.auditor = a })
+}
+
+// auditor getter
+func getAuditor(c context.Context) (*auditor, bool) {
+	st, _ := getState(c)
+	return st.auditor, st.auditor != nil
+}
+
+// proto logger setter
+func setProtoLogger(c context.Context, l protoLogger) context.Context {
+	return updateState(c, func(st *state) { st.proto = &l })
+}
+
+// proto logger getter
+func getProtoLogger(c context.Context) (protoLogger, bool) {
+	st, _ := getState(c)
+	if st.proto == nil {
+		return protoLogger{}, false
+	}
+	return *st.proto, true
+}
+
+// progress setter
+func setProgress(c context.Context, p *progress) context.Context {
+	return updateState(c, func(st *state) { st.progress = p })
+}
+
+// progress getter
+func getProgress(c context.Context) (*progress, bool) {
+	st, _ := getState(c)
+	return st.progress, st.progress != nil
+}
+
+// deduper setter
+func setDeduper(c context.Context, d *deduper) context.Context {
+	return updateState(c, func(st *state) { st.deduper = d })
+}
+
+// deduper getter
+func getDeduper(c context.Context) (*deduper, bool) {
+	st, _ := getState(c)
+	return st.deduper, st.deduper != nil
+}
+
+// rate limiter setter
+func setRateLimiter(c context.Context, l *rateLimiter) context.Context {
+	return updateState(c, func(st *state) { st.rateLimiter = l })
+}
+
+// rate limiter getter
+func getRateLimiter(c context.Context) (*rateLimiter, bool) {
+	st, _ := getState(c)
+	return st.rateLimiter, st.rateLimiter != nil
+}
+
+// field naming setter
+func setFieldNaming(c context.Context, n *fieldNaming) context.Context {
+	return updateState(c, func(st *state) { st.naming = n })
+}
+
+// field naming getter
+func getFieldNaming(c context.Context) (*fieldNaming, bool) {
+	st, _ := getState(c)
+	return st.naming, st.naming != nil
+}
+
+// clock setter
+func setClock(c context.Context, clock Clock) context.Context {
+	return updateState(c, func(st *state) { st.clock = clock })
+}
+
+// trace id generator setter
+func setTraceIDGenerator(c context.Context, gen TraceIDGenerator) context.Context {
+	return updateState(c, func(st *state) { st.traceIDs = gen })
+}
+
+// tracer getter
+func getTracer(c context.Context) *tracer {
+	st, _ := getState(c)
+	return st.tracer
+}
+
+// usage meter setter
+func setUsageMeter(c context.Context, m usageMeter) context.Context {
+	return updateState(c, func(st *state) { st.usage = &m })
+}
+
+// usage meter getter
+func getUsageMeter(c context.Context) (usageMeter, bool) {
+	st, _ := getState(c)
+	if st.usage == nil {
+		return usageMeter{}, false
+	}
+	return *st.usage, true
+}
+
+// minimum severity setter
+func setMinSeverity(c context.Context, severity logging.Severity) context.Context {
+	return updateState(c, func(st *state) { st.minimum = severity })
+}
+
+// sync write setter
+func setSyncWrite(c context.Context) context.Context {
+	return updateState(c, func(st *state) { st.syncWrite = true })
+}
+
+// detachedContext 値のみを引き継ぎ、キャンセルと期限を引き継がないcontext
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (d detachedContext) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// Detach グループ、TraceID、出力先を引き継ぎ、キャンセルを引き継がないcontextを返す
+// レスポンス返却後も続くバックグラウンド処理のログをリクエストのグループに出力する場合に使う
+func Detach(c context.Context) context.Context {
+	if c == nil {
+		panic(ErrNilContext)
+	}
+	return detachedContext{parent: c}
+}
+
+// TraceIDFrom cに設定されたTraceID
+// GroupedByの内側ではグループのTraceIDを返す。他のミドルウェアからglbrのリクエスト情報を参照する場合に使う
+func TraceIDFrom(c context.Context) (string, bool) {
+	if traceID, ok := getTraceID(c); ok {
+		return *traceID, true
+	}
+	return "", false
+}
+
+// SeverityFrom グループのこれまでの子エントリの最大severity
+// SetGroupSeverityで指定されている場合はその値を返す。グループ外ではfalseを返す
+func SeverityFrom(c context.Context) (logging.Severity, bool) {
+	g, ok := getGroup(c)
+	if !ok {
+		return logging.Default, false
+	}
+	if severity, ok := g.overrideSeverity(); ok {
+		return severity, true
+	}
+	return g.maxSeverity(), true
+}
+
+// GroupIDFrom cが属するグループのID
+// グループ外ではfalseを返す
+func GroupIDFrom(c context.Context) (string, bool) {
+	g, ok := getGroup(c)
+	if !ok {
+		return "", false
+	}
+	return g.id, true
 }
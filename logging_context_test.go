@@ -0,0 +1,92 @@
+package glbr
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+// fullState 全てのフィールドを設定したstate
+// stateにフィールドを追加した場合はここにも追加する。TestMergeStateはゼロ値のフィールドがあると失敗する
+func fullState() state {
+	traceID := "trace"
+	return state{
+		logger:      discardLogger{},
+		projects:    func(string) entryLogger { return discardLogger{} },
+		proto:       &protoLogger{},
+		usage:       &usageMeter{},
+		traceID:     &traceID,
+		span:        &span{},
+		baggage:     map[string]string{"k": "v"},
+		mirrors:     []mirror{{}},
+		format:      JSONFormat,
+		group:       newGroup("trace"),
+		auditor:     &auditor{},
+		progress:    &progress{},
+		deduper:     &deduper{},
+		rateLimiter: &rateLimiter{},
+		tenant:      &tenant{},
+		notifier:    &notifier{},
+		sinks:       []sinkRoute{{}},
+		callSites:   &callSites{},
+		live:        &liveConfig{},
+		redactor:    &redactor{},
+		naming:      &fieldNaming{},
+		clock:       systemClock{},
+		traceIDs:    func() string { return "trace" },
+		tracer:      &tracer{},
+		minimum:     logging.Error,
+		syncWrite:   true,
+		entrySpans:  true,
+		panicDump:   true,
+		debugging:   true,
+		noop:        true,
+	}
+}
+
+// 全てのフィールドがfromから引き継がれ、fromでゼロ値のフィールドはcの値のまま
+func TestMergeState(t *testing.T) {
+	full := fullState()
+	typ := reflect.TypeOf(full)
+	for i := 0; i < typ.NumField(); i++ {
+		if reflect.ValueOf(full).Field(i).IsZero() {
+			t.Fatalf("fullState does not set %s", typ.Field(i).Name)
+		}
+	}
+	from := context.WithValue(context.Background(), &stateKey, &full)
+	merged, _ := getState(mergeState(context.Background(), from))
+	for i := 0; i < typ.NumField(); i++ {
+		name := typ.Field(i).Name
+		zero := reflect.ValueOf(merged).Field(i).IsZero()
+		if name == "debugging" {
+			if !zero {
+				t.Error("debugging is merged from from")
+			}
+			continue
+		}
+		if zero {
+			t.Errorf("%s is not merged", name)
+		}
+	}
+
+	// fromでゼロ値のフィールドはcの値のまま
+	c := context.WithValue(context.Background(), &stateKey, &full)
+	kept, _ := getState(mergeState(c, updateState(context.Background(), func(st *state) { st.clock = systemClock{} })))
+	for i := 0; i < typ.NumField(); i++ {
+		if reflect.ValueOf(kept).Field(i).IsZero() {
+			t.Errorf("%s of c is not kept", typ.Field(i).Name)
+		}
+	}
+	if kept.minimum != logging.Error {
+		t.Errorf("minimum = %v, want c's Error", kept.minimum)
+	}
+
+	// debuggingのリクエストではfromのminimumを引き継がない
+	debugging := updateState(context.Background(), func(st *state) { st.minimum, st.debugging = logging.Debug, true })
+	st, _ := getState(mergeState(debugging, setMinSeverity(context.Background(), logging.Warning)))
+	if st.minimum != logging.Debug {
+		t.Errorf("debugging minimum = %v, want Debug", st.minimum)
+	}
+}
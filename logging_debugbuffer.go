@@ -0,0 +1,81 @@
+package glbr
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// debugBuffer リクエスト内のDebugエントリを親エントリの出力まで保持するリングバッファ
+type debugBuffer struct {
+	size    int
+	entries []bufferedEntry
+	dropped int // 溢れて捨てたエントリ数
+}
+
+// bufferedEntry 保持したエントリと出力に使うcontext
+type bufferedEntry struct {
+	c     context.Context
+	entry logging.Entry
+}
+
+// debugBuffering WithDebugBufferの設定
+type debugBuffering struct {
+	size    int
+	latency time.Duration
+}
+
+// WithDebugBuffer グループ内のDebugエントリを直近size件まで保持し、
+// リクエストがError以上のエントリ、5xx、panicで終わった場合か、レイテンシがlatency以上の場合にのみ出力する
+// それ以外の場合は捨てて、親エントリに debug_discarded={件数} ラベルを付ける。latencyが0以下の場合はレイテンシで判定しない
+// Debugエントリが出力されるように、WithMinSeverityはDebug以下にしておく
+func (s Service) WithDebugBuffer(size int, latency time.Duration) Service {
+	if size <= 0 {
+		s.debugBuffer = nil
+		return s
+	}
+	s.debugBuffer = &debugBuffering{size: size, latency: latency}
+	return s
+}
+
+// bufferDebug Debugエントリをリングバッファに保持する
+// バッファが無いか、親エントリの出力後は保持せずにfalseを返す
+func (g *group) bufferDebug(c context.Context, entry logging.Entry) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.debug == nil || g.closed {
+		return false
+	}
+	b := g.debug
+	if len(b.entries) == b.size {
+		copy(b.entries, b.entries[1:])
+		b.entries = b.entries[:b.size-1]
+		b.dropped++
+	}
+	b.entries = append(b.entries, bufferedEntry{c: c, entry: entry})
+	return true
+}
+
+// releaseDebug 保持したDebugエントリをkeepであれば出力し、捨てた件数を返す
+func (g *group) releaseDebug(keep bool) (discarded int) {
+	g.mu.Lock()
+	b := g.debug
+	g.debug = nil
+	g.mu.Unlock()
+	if b == nil {
+		return 0
+	}
+	if !keep {
+		return len(b.entries) + b.dropped
+	}
+	for _, e := range b.entries {
+		push(e.c, e.entry)
+	}
+	return b.dropped
+}
+
+// keep 保持したDebugエントリを出力するかどうか
+func (d *debugBuffering) keep(severity logging.Severity, code int, latency time.Duration) bool {
+	return logging.Error <= severity || 500 <= code || (0 < d.latency && d.latency <= latency)
+}
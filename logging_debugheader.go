@@ -0,0 +1,184 @@
+package glbr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// DebugHeader 1リクエストだけ詳細なログを出力するリクエストヘッダー
+const DebugHeader = "X-Glbr-Debug"
+
+// DebugHeaderOptions WithDebugHeaderの設定
+type DebugHeaderOptions struct {
+	MinSeverity logging.Severity // ヘッダーのあるリクエストの子エントリの最低severity Default: logging.Default(全て出力する)
+	BodyLimit   int              // 親エントリのdebug_bodyに含めるリクエストボディの最大バイト数。負の値で含めない Default: 64KB
+	MaxTTL      time.Duration    // 受け付ける有効期限の最大 Default: 15分
+	// Subject 署名されたsubjectがリクエストに当てはまるかどうか。ユーザーIDをsubjectにする場合は認証済みのユーザーと比較する
+	// Default: "/"で始まるsubjectをパスのセグメント単位で比較する(/checkは/checkと/check/...に一致し、/checkoutには一致しない)
+	// "/"だけのsubjectと、"/"で始まらないsubjectは受け付けない
+	Subject func(r *http.Request, subject string) bool
+}
+
+// debugHeader WithDebugHeaderの署名の鍵と設定
+type debugHeader struct {
+	secret []byte
+	opts   DebugHeaderOptions
+}
+
+// WithDebugHeader secretで署名されたX-Glbr-Debugヘッダーのあるリクエストだけ、WithMinSeverity, WatchConfig,
+// UnsampledPolicyより低いseverityの子エントリを出力し、リクエストボディの先頭を親エントリのdebug_bodyに含める
+// サポートで特定のユーザーの再現手順だけ詳細なログを出力する場合に使う。ヘッダーの値はDebugHeaderValueで作成する
+// 署名はsubject(パスやユーザー)に紐付き、Subjectで当てはまらないリクエストでは使えない
+// debug_bodyのJSONとフォームのボディは、DefaultReplayRedactedQueryとWithRedactionのフィールドの値を伏せる
+// 親エントリにはdebug_requestラベルが付き、署名が一致しない、期限切れ、subjectが当てはまらないヘッダーは無視してrejectedになる
+//
+//	log = log.WithDebugHeader([]byte(os.Getenv("GLBR_DEBUG_SECRET")), glbr.DebugHeaderOptions{
+//		Subject: func(r *http.Request, subject string) bool { return userID(r) == subject },
+//	})
+func (s Service) WithDebugHeader(secret []byte, opts DebugHeaderOptions) Service {
+	if len(secret) == 0 {
+		panic(ErrEmptySecret)
+	}
+	if opts.BodyLimit == 0 {
+		opts.BodyLimit = 64 << 10
+	}
+	if opts.MaxTTL <= 0 {
+		opts.MaxTTL = 15 * time.Minute
+	}
+	if opts.Subject == nil {
+		opts.Subject = debugPathSubject
+	}
+	s.debugHeader = &debugHeader{secret: secret, opts: opts}
+	return s
+}
+
+// debugPathSubject "/"で始まるsubjectをリクエストのパスとセグメント単位で比較する
+// 全てのパスに一致する"/"は受け付けない
+func debugPathSubject(r *http.Request, subject string) bool {
+	subject = strings.TrimSuffix(subject, "/")
+	if !strings.HasPrefix(subject, "/") {
+		return false
+	}
+	path := r.URL.Path
+	return path == subject || strings.HasPrefix(path, subject+"/")
+}
+
+// DebugHeaderValue subjectに対してttl後まで有効なX-Glbr-Debugヘッダーの値
+// 値は"{期限のUNIX時刻}.{subjectのbase64url}.{期限とsubjectのHMAC-SHA256の16進数}"
+//
+//	curl -H "X-Glbr-Debug: $(value)" https://example.com/checkout
+func DebugHeaderValue(secret []byte, subject string, ttl time.Duration) string {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(subject))
+	return expires + "." + encoded + "." + debugSignature(secret, expires, subject)
+}
+
+// debugSignature 期限とsubjectの署名
+func debugSignature(secret []byte, expires, subject string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(expires))
+	mac.Write([]byte{0})
+	mac.Write([]byte(subject))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// debugVerdict X-Glbr-Debugヘッダーの確認結果
+type debugVerdict int
+
+const (
+	debugAbsent   debugVerdict = iota // ヘッダーがない
+	debugAccepted                     // 有効なヘッダー
+	debugRejected                     // 無効なヘッダー
+)
+
+// String debug_requestラベルの値
+func (v debugVerdict) String() string {
+	switch v {
+	case debugAccepted:
+		return "true"
+	case debugRejected:
+		return "rejected"
+	}
+	return ""
+}
+
+// verify リクエストのヘッダーを確認する
+func (d *debugHeader) verify(r *http.Request, now time.Time) debugVerdict {
+	if d == nil {
+		return debugAbsent
+	}
+	v := r.Header.Get(DebugHeader)
+	if v == "" {
+		return debugAbsent
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return debugRejected
+	}
+	expires, signature := parts[0], parts[2]
+	subject, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return debugRejected
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return debugRejected
+	}
+	if at := time.Unix(unix, 0); at.Before(now) || now.Add(d.opts.MaxTTL).Before(at) {
+		return debugRejected
+	}
+	if !hmac.Equal([]byte(signature), []byte(debugSignature(d.secret, expires, string(subject)))) {
+		return debugRejected
+	}
+	if !d.opts.Subject(r, string(subject)) {
+		return debugRejected
+	}
+	return debugAccepted
+}
+
+// bodyLimit ヘッダーが有効なリクエストでボディの先頭を保持するバイト数
+func (d *debugHeader) bodyLimit(limit int) int {
+	if limit < d.opts.BodyLimit {
+		return d.opts.BodyLimit
+	}
+	return limit
+}
+
+// debugBody 親エントリのペイロードにリクエストボディの先頭を加える
+// JSONとフォームのボディはWithReplayBundlesと同じくkeysのフィールドの値を伏せ、解析できないJSONは含めない
+func (d *debugHeader) debugBody(payload interface{}, contentType string, body *countingBody, keys []string) interface{} {
+	sample := body.bodySample()
+	if d.opts.BodyLimit < 0 || len(sample) == 0 {
+		return payload
+	}
+	if d.opts.BodyLimit < len(sample) {
+		sample = sample[:d.opts.BodyLimit]
+	}
+	debug := map[string]interface{}{}
+	if int64(len(sample)) < body.size() {
+		debug["body_truncated"] = true
+	}
+	if sample = redactBody(contentType, sample, keys); sample == nil {
+		debug["body_omitted"] = true
+	} else {
+		text, encoding := bodyText(sample)
+		debug["body"] = text
+		if encoding != "" {
+			debug["body_encoding"] = encoding
+		}
+	}
+	m, ok := payload.(map[string]interface{})
+	if !ok {
+		m = versioned(map[string]interface{}{})
+	}
+	m["debug_body"] = debug
+	return m
+}
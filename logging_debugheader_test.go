@@ -0,0 +1,81 @@
+package glbr
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugHeaderVerify(t *testing.T) {
+	secret := []byte("secret")
+	d := Service{}.WithDebugHeader(secret, DebugHeaderOptions{}).debugHeader
+	now := time.Now()
+	request := func(path, value string) *http.Request {
+		r := httptest.NewRequest("GET", path, nil)
+		if value != "" {
+			r.Header.Set(DebugHeader, value)
+		}
+		return r
+	}
+	for _, tc := range []struct {
+		name, path, value string
+		want              debugVerdict
+	}{
+		{"absent", "/checkout", "", debugAbsent},
+		{"path", "/checkout/pay", DebugHeaderValue(secret, "/checkout", time.Minute), debugAccepted},
+		{"exact path", "/checkout", DebugHeaderValue(secret, "/checkout", time.Minute), debugAccepted},
+		{"trailing slash", "/checkout/pay", DebugHeaderValue(secret, "/checkout/", time.Minute), debugAccepted},
+		{"other path", "/admin", DebugHeaderValue(secret, "/checkout", time.Minute), debugRejected},
+		{"partial segment", "/checkout", DebugHeaderValue(secret, "/check", time.Minute), debugRejected},
+		{"root", "/checkout", DebugHeaderValue(secret, "/", time.Minute), debugRejected},
+		{"empty subject", "/checkout", DebugHeaderValue(secret, "", time.Minute), debugRejected},
+		{"user without hook", "/checkout", DebugHeaderValue(secret, "user-1", time.Minute), debugRejected},
+		{"wrong secret", "/checkout", DebugHeaderValue([]byte("other"), "/checkout", time.Minute), debugRejected},
+		{"expired", "/checkout", DebugHeaderValue(secret, "/checkout", -time.Minute), debugRejected},
+		{"ttl over max", "/checkout", DebugHeaderValue(secret, "/checkout", time.Hour), debugRejected},
+		{"old format", "/checkout", "1.abc", debugRejected},
+	} {
+		if got := d.verify(request(tc.path, tc.value), now); got != tc.want {
+			t.Errorf("%s: verify = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	d = Service{}.WithDebugHeader(secret, DebugHeaderOptions{
+		Subject: func(r *http.Request, subject string) bool { return r.Header.Get("X-User") == subject },
+	}).debugHeader
+	r := request("/checkout", DebugHeaderValue(secret, "user-1", time.Minute))
+	r.Header.Set("X-User", "user-1")
+	if got := d.verify(r, now); got != debugAccepted {
+		t.Errorf("user subject = %v, want accepted", got)
+	}
+	r.Header.Set("X-User", "user-2")
+	if got := d.verify(r, now); got != debugRejected {
+		t.Errorf("other user = %v, want rejected", got)
+	}
+}
+
+// debug_bodyのボディはフィールドの値を伏せ、解析できないJSONは含めない
+func TestDebugBodyRedaction(t *testing.T) {
+	d := Service{}.WithDebugHeader([]byte("secret"), DebugHeaderOptions{}).debugHeader
+	debugBody := func(contentType, body string) map[string]interface{} {
+		r, cb := wrapBody(httptest.NewRequest("POST", "/", strings.NewReader(body)), 1024)
+		ioutil.ReadAll(r.Body)
+		payload := d.debugBody(nil, contentType, cb, append(DefaultReplayRedactedQuery, "card_number"))
+		return payload.(map[string]interface{})["debug_body"].(map[string]interface{})
+	}
+	got := debugBody("application/json", `{"user": "a", "password": "p", "card": {"card_number": "4111"}}`)
+	if body := got["body"].(string); strings.Contains(body, `"p"`) || strings.Contains(body, "4111") || !strings.Contains(body, `"a"`) {
+		t.Errorf("json body = %s", body)
+	}
+	got = debugBody("application/x-www-form-urlencoded", "user=a&access_token=t")
+	if body := got["body"].(string); body != "user=a&access_token=%5BREDACTED%5D" {
+		t.Errorf("form body = %s", body)
+	}
+	got = debugBody("application/json", `{"password": "p"`)
+	if _, ok := got["body"]; ok || got["body_omitted"] != true {
+		t.Errorf("unparsable json = %v", got)
+	}
+}
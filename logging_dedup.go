@@ -0,0 +1,82 @@
+package glbr
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// WithDeduplication window内に出力された同じseverity、同じメッセージのエントリをまとめる
+// 最初のエントリはそのまま出力され、以降のエントリはwindowの終了時に{"message": ..., "repeat_count": n}の1エントリとして出力される
+// グループ内のエントリはグループ毎にまとめるため、別のリクエストのエントリと混ざらない
+func (s Service) WithDeduplication(window time.Duration) Service {
+	s.ctx = setDeduper(s.ctx, &deduper{window: window, seen: map[dedupKey]*repeated{}})
+	return s
+}
+
+type repeatKey struct {
+	severity logging.Severity
+	message  string
+}
+
+// dedupKey まとめるエントリのグループ、severity、メッセージ
+// グループ外のエントリのgroupはnil
+type dedupKey struct {
+	group *group
+	repeatKey
+}
+
+// repeated window内で抑制されたエントリ
+type repeated struct {
+	count int
+	c     context.Context
+	entry logging.Entry
+}
+
+// deduper 重複したエントリをまとめる
+type deduper struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[dedupKey]*repeated
+}
+
+// suppress エントリを抑制する場合はtrueを返す
+// 文字列以外のペイロードは対象外
+func (d *deduper) suppress(c context.Context, entry logging.Entry) bool {
+	message, ok := entry.Payload.(string)
+	if !ok || d.window <= 0 {
+		return false
+	}
+	g, _ := getGroup(c)
+	key := dedupKey{group: g, repeatKey: repeatKey{severity: entry.Severity, message: message}}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if r, ok := d.seen[key]; ok {
+		r.count++
+		r.c = Detach(c)
+		r.entry = entry
+		return true
+	}
+	d.seen[key] = &repeated{}
+	time.AfterFunc(d.window, func() { d.flush(key) })
+	return false
+}
+
+// flush windowの終了時に抑制したエントリをまとめて出力する
+func (d *deduper) flush(key dedupKey) {
+	d.mu.Lock()
+	r := d.seen[key]
+	delete(d.seen, key)
+	d.mu.Unlock()
+	if r == nil || r.count == 0 {
+		return
+	}
+	r.entry.Payload = versioned(map[string]interface{}{
+		"message":      key.message,
+		"repeat_count": r.count,
+	})
+	push(r.c, r.entry)
+}
@@ -0,0 +1,26 @@
+package glbr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// 別のグループの同じメッセージはまとめない
+func TestDeduperPerGroup(t *testing.T) {
+	d := &deduper{window: time.Hour, seen: map[dedupKey]*repeated{}}
+	a := setGroup(context.Background(), newGroup("a"))
+	b := setGroup(context.Background(), newGroup("b"))
+	entry := logging.Entry{Severity: logging.Error, Payload: "failed"}
+	if d.suppress(a, entry) || d.suppress(b, entry) {
+		t.Error("first entry of each group is suppressed")
+	}
+	if !d.suppress(a, entry) {
+		t.Error("repeated entry in the same group is not suppressed")
+	}
+	if len(d.seen) != 2 {
+		t.Errorf("seen = %d, want 2", len(d.seen))
+	}
+}
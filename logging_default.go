@@ -0,0 +1,87 @@
+package glbr
+
+import (
+	"context"
+	"sync/atomic"
+
+	"cloud.google.com/go/logging"
+)
+
+// defaultService SetDefaultで設定されたserviceのcontext
+var defaultService atomic.Value
+
+// SetDefault パッケージのデフォルトのserviceを設定する
+// DefaultInfof等はcontextを受け渡せない箇所からこのserviceに出力する。段階的な導入向け
+//
+//	glbr.SetDefault(service)
+//	glbr.DefaultInfof(nil, "started")
+func SetDefault(s Service) {
+	defaultService.Store(s.Context())
+}
+
+// DefaultContext デフォルトのserviceに出力するcontext
+// cがGroupedBy, Service.Contextのcontextの場合はcをそのまま返す。グループの子エントリとして出力される
+// それ以外の場合はcのキャンセルと値を引き継ぎ、デフォルトのserviceの設定をcの設定に加える。cはnilでもよい
+// SetDefaultが呼ばれていない場合はfalseを返す
+func DefaultContext(c context.Context) (context.Context, bool) {
+	if c != nil {
+		if _, ok := getLogger(c); ok {
+			return c, true
+		}
+	}
+	d, ok := defaultService.Load().(context.Context)
+	if !ok {
+		return c, false
+	}
+	if c == nil {
+		return d, true
+	}
+	return mergeState(c, d), true
+}
+
+// sendDefault デフォルトのserviceにログを送信する
+func sendDefault(c context.Context, severity logging.Severity, format string, value ...interface{}) {
+	if c, ok := DefaultContext(c); ok {
+		sendEntry(c, severity, format, value...)
+	}
+}
+
+// DefaultDebugf デフォルトのserviceにDebugfで出力する。cはnilでもよい
+func DefaultDebugf(c context.Context, format string, value ...interface{}) {
+	sendDefault(c, logging.Debug, format, value...)
+}
+
+// DefaultInfof デフォルトのserviceにInfofで出力する。cはnilでもよい
+func DefaultInfof(c context.Context, format string, value ...interface{}) {
+	sendDefault(c, logging.Info, format, value...)
+}
+
+// DefaultNoticef デフォルトのserviceにNoticefで出力する。cはnilでもよい
+func DefaultNoticef(c context.Context, format string, value ...interface{}) {
+	sendDefault(c, logging.Notice, format, value...)
+}
+
+// DefaultWarningf デフォルトのserviceにWarningfで出力する。cはnilでもよい
+func DefaultWarningf(c context.Context, format string, value ...interface{}) {
+	sendDefault(c, logging.Warning, format, value...)
+}
+
+// DefaultErrorf デフォルトのserviceにErrorfで出力する。cはnilでもよい
+func DefaultErrorf(c context.Context, format string, value ...interface{}) {
+	sendDefault(c, logging.Error, format, value...)
+}
+
+// DefaultCriticalf デフォルトのserviceにCriticalfで出力する。cはnilでもよい
+func DefaultCriticalf(c context.Context, format string, value ...interface{}) {
+	sendDefault(c, logging.Critical, format, value...)
+}
+
+// DefaultAlertf デフォルトのserviceにAlertfで出力する。cはnilでもよい
+func DefaultAlertf(c context.Context, format string, value ...interface{}) {
+	sendDefault(c, logging.Alert, format, value...)
+}
+
+// DefaultEmergencyf デフォルトのserviceにEmergencyfで出力する。cはnilでもよい
+func DefaultEmergencyf(c context.Context, format string, value ...interface{}) {
+	sendDefault(c, logging.Emergency, format, value...)
+}
@@ -0,0 +1,32 @@
+package glbr
+
+import (
+	"context"
+	"testing"
+)
+
+// loggerのないstateを持つcontextにはデフォルトのserviceの設定が加えられる
+func TestDefaultContext(t *testing.T) {
+	s, rec, err := NewRecorder("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDefault(s)
+	defer SetDefault(NewNoOp())
+
+	traceID := "trace"
+	c := setTraceID(context.Background(), &traceID)
+	DefaultInfof(c, "with trace")
+	entries := rec.Entries("default")
+	if len(entries) != 1 {
+		t.Fatalf("entries = %d, want 1", len(entries))
+	}
+	if got := entries[0].Trace; got != traceID {
+		t.Errorf("Trace = %s, want the trace of c", got)
+	}
+
+	grouped := s.Context()
+	if got, ok := DefaultContext(grouped); !ok || got != grouped {
+		t.Error("context with a logger is replaced")
+	}
+}
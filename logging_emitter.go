@@ -0,0 +1,69 @@
+package glbr
+
+import (
+	"sync"
+)
+
+// emitter 親エントリを出力するワーカー
+// nilの場合はリクエストのgoroutineで出力する
+type emitter struct {
+	queue chan func()
+	wg    sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// WithAsyncParent 親エントリをworkers個のワーカーで非同期に出力する
+// キューがqueueSizeを超えた場合はリクエストのgoroutineで出力する。Closeでキューに残った親エントリを出力してから閉じる
+// workersが0以下の場合はErrInvalidWorkersでpanicする
+func (s Service) WithAsyncParent(workers, queueSize int) Service {
+	if workers <= 0 {
+		panic(ErrInvalidWorkers)
+	}
+	e := &emitter{queue: make(chan func(), queueSize)}
+	e.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer e.wg.Done()
+			for fn := range e.queue {
+				fn()
+			}
+		}()
+	}
+	s.emitter = e
+	return s
+}
+
+// emit 親エントリの出力処理をキューに追加する
+func (e *emitter) emit(fn func()) {
+	if e == nil {
+		fn()
+		return
+	}
+	e.mu.RLock()
+	if !e.closed {
+		select {
+		case e.queue <- fn:
+			e.mu.RUnlock()
+			return
+		default:
+		}
+	}
+	e.mu.RUnlock()
+	fn()
+}
+
+// close キューに残った出力処理の終了を待つ
+func (e *emitter) close() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.mu.Unlock()
+	e.wg.Wait()
+}
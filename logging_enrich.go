@@ -0,0 +1,113 @@
+package glbr
+
+import (
+	"strings"
+
+	"cloud.google.com/go/logging"
+)
+
+// GeoResolver IPアドレスから国と地域を解決する
+type GeoResolver interface {
+	Resolve(ip string) (country, region string, err error)
+}
+
+// WithUserAgent 親エントリにUser-Agentを解析したブラウザ、OS、ボットかどうかをラベルとして付加する
+// ua_browser, ua_os, ua_bot
+func (s Service) WithUserAgent() Service {
+	s.userAgent = true
+	return s
+}
+
+// WithGeoIP 親エントリにクライアントIPから解決した国と地域をラベルとして付加する
+// geo_country, geo_region
+func (s Service) WithGeoIP(resolver GeoResolver) Service {
+	s.geo = resolver
+	return s
+}
+
+// enrich 親エントリにUser-AgentとGeoIPのラベルを付加する
+func (s Service) enrich(entry *logging.Entry) {
+	if !s.userAgent && s.geo == nil {
+		return
+	}
+	if entry.Labels == nil {
+		entry.Labels = map[string]string{}
+	}
+	if s.userAgent {
+		browser, os, bot := parseUserAgent(entry.HTTPRequest.Request.UserAgent())
+		entry.Labels["ua_browser"] = browser
+		entry.Labels["ua_os"] = os
+		if bot {
+			entry.Labels["ua_bot"] = "true"
+		} else {
+			entry.Labels["ua_bot"] = "false"
+		}
+	}
+	if s.geo != nil {
+		if country, region, err := s.geo.Resolve(remoteHost(entry.HTTPRequest)); err == nil {
+			if country != "" {
+				entry.Labels["geo_country"] = country
+			}
+			if region != "" {
+				entry.Labels["geo_region"] = region
+			}
+		}
+	}
+}
+
+// 判定順に並べる
+var (
+	uaBots = []string{"bot", "crawler", "spider", "slurp", "curl/", "wget/", "python-requests", "go-http-client", "headless"}
+
+	uaBrowsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"Edge/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Opera", "Opera"},
+		{"SamsungBrowser/", "Samsung Internet"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Chromium/", "Chromium"},
+		{"Safari/", "Safari"},
+		{"MSIE ", "Internet Explorer"},
+		{"Trident/", "Internet Explorer"},
+	}
+
+	uaOSs = []struct{ token, name string }{
+		{"Windows", "Windows"},
+		{"iPhone", "iOS"},
+		{"iPad", "iOS"},
+		{"Android", "Android"},
+		{"CrOS", "Chrome OS"},
+		{"Mac OS X", "macOS"},
+		{"Macintosh", "macOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// parseUserAgent User-Agentからブラウザ、OS、ボットかどうかを簡易的に判定する
+func parseUserAgent(ua string) (browser, os string, bot bool) {
+	browser, os = "other", "other"
+	lower := strings.ToLower(ua)
+	for _, token := range uaBots {
+		if strings.Contains(lower, token) {
+			bot = true
+			break
+		}
+	}
+	for _, b := range uaBrowsers {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, o := range uaOSs {
+		if strings.Contains(ua, o.token) {
+			os = o.name
+			break
+		}
+	}
+	return
+}
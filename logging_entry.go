@@ -3,8 +3,7 @@ package glbr
 import (
 	"context"
 	"fmt"
-	"io"
-	"time"
+	"os"
 
 	"cloud.google.com/go/logging"
 )
@@ -16,35 +15,125 @@ func push(c context.Context, entry logging.Entry) {
 		}
 		// logging.client.errc is closed in the logging.Close function,
 		// it will panic if called after Close function.
-		logger.Log(entry)
+		if st, _ := getState(c); st.syncWrite {
+			if err := logger.LogSync(Detach(c), entry); err != nil {
+				fmt.Fprintf(os.Stderr, "glbr: %v\n", err)
+			}
+		} else {
+			logger.Log(entry)
+		}
+		if meter, ok := getUsageMeter(c); ok {
+			meter.add(entry)
+		}
 	} else {
 		fmt.Println("logger not found")
 	}
-	if w, ok := getIOWriter(c); ok {
-		pl, _ := entry.Payload.(string)
-		tm := entry.Timestamp.Format("2006/01/02 03:04:05")
-		io.WriteString(w, fmt.Sprintf("%s %s: %s\n", tm, entry.Severity, pl))
+	st, _ := getState(c)
+	logID := ""
+	if st.usage != nil {
+		logID = st.usage.logID
+	}
+	st.forward(logID, entry)
+	if st.group != nil {
+		st.group.capture(logID, entry)
+	}
+	held := false
+	for _, m := range st.mirrors {
+		if entry.Severity < m.minimum {
+			continue
+		}
+		if m.grouped && st.group != nil {
+			if !held {
+				held = st.group.hold(entry)
+			}
+			if held {
+				continue
+			}
+		}
+		m.write(entry, st.format)
+	}
+}
+
+// Enabled severityのエントリが出力されるかどうか
+// 引数の生成にコストがかかる場合に使う
+//
+//	if glbr.Enabled(c, logging.Debug) {
+//		glbr.Debugf(c, "%v", expensive())
+//	}
+func Enabled(c context.Context, severity logging.Severity) bool {
+	if noOpBuild {
+		return false
+	}
+	st, _ := getState(c)
+	if st.noop {
+		return false
+	}
+	if st.live != nil && !st.debugging && severity < st.live.minimum() {
+		return false
 	}
+	return st.minimum <= severity
 }
 
 // sendEntry ログを送信する
+// 出力されないseverityの場合はフォーマットしない
 func sendEntry(c context.Context, severity logging.Severity, format string, value ...interface{}) {
-	if maxSeverity, ok := getSeverity(c); ok {
-		if *maxSeverity < severity {
-			*maxSeverity = severity
+	if !Enabled(c, severity) {
+		return
+	}
+	sendPayload(c, severity, fmt.Sprintf(format, value...), nil)
+}
+
+// sendPayload 任意のペイロードとラベルでログを送信する
+func sendPayload(c context.Context, severity logging.Severity, payload interface{}, labels map[string]string) {
+	if !Enabled(c, severity) {
+		return
+	}
+	if g, ok := getGroup(c); ok {
+		if late := g.raise(severity); late {
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels["late"] = "true"
+			if g.insertID != "" {
+				labels["parent_insert_id"] = g.insertID
+			}
 		}
+		g.observe(severity, payload)
 	}
+	st, _ := getState(c)
+	labels = baggageLabels(labels, st.baggage)
 	traceID, ok := getTraceID(c)
 	if !ok {
 		traceID = new(string)
-		*traceID = newTraceID()
+		*traceID = traceIDFrom(c)
 	}
-	push(c, logging.Entry{
-		Payload:   fmt.Sprintf(format, value...),
+	entry := logging.Entry{
+		Payload:   normalizePayload(c, st.redactor.payload(payload)),
+		Labels:    labels,
 		Severity:  severity,
 		Trace:     *traceID,
-		Timestamp: time.Now(),
-	})
+		Timestamp: clockFrom(c).Now(),
+	}
+	applySpan(c, &entry)
+	if st.tenant != nil && !st.tenant.allow(c, &entry) {
+		return
+	}
+	if d, ok := getDeduper(c); ok && d.suppress(c, entry) {
+		return
+	}
+	if l, ok := getRateLimiter(c); ok && !l.allow(c, entry) {
+		return
+	}
+	if st.group != nil && st.group.fold(entry) {
+		return
+	}
+	if severity == logging.Debug && st.group != nil && st.group.bufferDebug(c, entry) {
+		return
+	}
+	if st.callSites != nil {
+		st.callSites.record(entry)
+	}
+	push(c, entry)
 }
 
 // CustomSeverityf 0 < Debugf(100) < ... < Emergencyf(700)
@@ -0,0 +1,38 @@
+package glbr
+
+import (
+	"errors"
+)
+
+// 設定や呼び出し方の誤りを表すエラー
+// errors.Isで判別できる。設定時にpanicする場合もこれらの値でpanicする
+var (
+	ErrEmptyLogID            = errors.New("glbr: logID is empty")
+	ErrLogIDTooLong          = errors.New("glbr: logID is 512 characters or more")
+	ErrInvalidLogID          = errors.New("glbr: logID contains invalid characters")
+	ErrInvalidProjectID      = errors.New("glbr: projectID is invalid")
+	ErrNilContext            = errors.New("glbr: nil context")
+	ErrAlreadyGrouped        = errors.New("glbr: GroupedBy is applied twice to the same handler")
+	ErrEmptyParentLogID      = errors.New("glbr: parentLogID is empty")
+	ErrSameLogID             = errors.New("glbr: parentLogID or auditLogID is identical to the logID of NewLogging")
+	ErrLoggerNotFound        = errors.New("glbr: logger not found, call initilize function 'NewLogging'")
+	ErrAuditorNotFound       = errors.New("glbr: auditor not found, call 'WithAudit'")
+	ErrMissingAuditField     = errors.New("glbr: action and subject are required")
+	ErrNilPayload            = errors.New("glbr: payload is nil")
+	ErrTimeoutOutsideGroup   = errors.New("glbr: Timeout must be applied inside GroupedBy")
+	ErrInvalidTimeoutStatus  = errors.New("glbr: timeout status must be 503 or 504")
+	ErrUnknownSchemaVersion  = errors.New("glbr: unknown payload schema_version")
+	ErrInvalidBucket         = errors.New("glbr: bucket location and id are required")
+	ErrCMEKMismatch          = errors.New("glbr: bucket encryption does not match the expected KMS key")
+	ErrInvalidEscalationRule = errors.New("glbr: escalation rule is invalid")
+	ErrSnapshotUnavailable   = errors.New("glbr: SnapshotGroup requires GroupedBy and WithSnapshots")
+	ErrDuplicateField        = errors.New("glbr: field is already registered")
+	ErrNotHijacker           = errors.New("glbr: the underlying ResponseWriter does not implement http.Hijacker")
+	ErrInvalidConfig         = errors.New("glbr: config is invalid")
+	ErrEmptySecret           = errors.New("glbr: secret is empty")
+	ErrInvalidSamplingRate   = errors.New("glbr: sampling rate must be between 0 and 1")
+	ErrInvalidTrustedProxy   = errors.New("glbr: trusted proxy is not a valid CIDR")
+	ErrNilRequest            = errors.New("glbr: http.Request is nil")
+	ErrInvalidWorkers        = errors.New("glbr: workers must be greater than 0")
+	ErrEmptyTraceIDs         = errors.New("glbr: FixedTraceIDs requires at least one id")
+)
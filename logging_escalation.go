@@ -0,0 +1,146 @@
+package glbr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// EscalationRule グループを閉じる時に評価する親エントリのseverityの引き上げ規則
+// 0値の条件は評価せず、指定した条件を全て満たした場合に親エントリのseverityをSeverityまで引き上げる
+//
+//	// Warning以上の子エントリが3件以上あればError
+//	glbr.EscalationRule{Name: "warnings", Severity: logging.Error, MinSeverity: logging.Warning, Count: 3}
+//	// メッセージが"deadlock"を含む子エントリがあればCritical
+//	glbr.EscalationRule{Name: "deadlock", Severity: logging.Critical, Message: "deadlock"}
+type EscalationRule struct {
+	Name        string           // 適用された場合に親エントリのescalatedラベルに付加する名前
+	Severity    logging.Severity // 引き上げる親エントリのseverity
+	MinSeverity logging.Severity // Countで数える子エントリの最低severity
+	Count       int              // MinSeverity以上の子エントリの件数
+	Message     string           // 子エントリのメッセージにマッチする正規表現
+	MinStatus   int              // レスポンスのステータスコード
+	MinLatency  time.Duration    // リクエストのレイテンシ
+}
+
+// escalation コンパイル済みの規則
+type escalation struct {
+	rules    []EscalationRule
+	patterns []*regexp.Regexp // rulesと同じ順。Messageの指定がない場合はnil
+}
+
+// WithEscalation グループを閉じる時にrulesを評価し、条件を満たした規則のうち最も高いSeverityまで親エントリのseverityを引き上げる
+// 適用された規則の名前は escalated ラベルにカンマ区切りで付加される。SetGroupSeverityの指定がある場合はそちらが優先される
+// 条件の無い規則やMessageが正規表現として不正な規則はErrInvalidEscalationRuleでpanicする
+func (s Service) WithEscalation(rules ...EscalationRule) Service {
+	e := &escalation{rules: rules, patterns: make([]*regexp.Regexp, len(rules))}
+	for i, rule := range rules {
+		if rule.Count <= 0 && rule.Message == "" && rule.MinStatus <= 0 && rule.MinLatency <= 0 {
+			panic(fmt.Errorf("%w: %q has no condition", ErrInvalidEscalationRule, rule.Name))
+		}
+		if rule.Message != "" {
+			re, err := regexp.Compile(rule.Message)
+			if err != nil {
+				panic(fmt.Errorf("%w: %q: %v", ErrInvalidEscalationRule, rule.Name, err))
+			}
+			e.patterns[i] = re
+		}
+	}
+	if len(rules) == 0 {
+		e = nil
+	}
+	s.escalation = e
+	return s
+}
+
+// escalationState グループ内の子エントリの集計
+type escalationState struct {
+	counts  map[logging.Severity]int
+	matched []bool // Messageにマッチした子エントリがあった規則
+}
+
+func newEscalationState(e *escalation) *escalationState {
+	return &escalationState{counts: map[logging.Severity]int{}, matched: make([]bool, len(e.rules))}
+}
+
+// observe 子エントリのseverityとメッセージを集計する
+// 親エントリの出力後は集計しない
+func (g *group) observe(severity logging.Severity, payload interface{}) {
+	if g.escalation == nil {
+		return
+	}
+	message, hasMessage := payloadMessage(payload)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return
+	}
+	g.escalated.counts[severity]++
+	if !hasMessage {
+		return
+	}
+	for i, re := range g.escalation.patterns {
+		if re != nil && !g.escalated.matched[i] && re.MatchString(message) {
+			g.escalated.matched[i] = true
+		}
+	}
+}
+
+// escalate 条件を満たした規則を評価し、引き上げたseverityと適用された規則の名前を返す
+func (g *group) escalate(severity logging.Severity, code int, latency time.Duration) (logging.Severity, []string) {
+	if g.escalation == nil {
+		return severity, nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var names []string
+	for i, rule := range g.escalation.rules {
+		if 0 < rule.Count {
+			n := 0
+			for s, c := range g.escalated.counts {
+				if rule.MinSeverity <= s {
+					n += c
+				}
+			}
+			if n < rule.Count {
+				continue
+			}
+		}
+		if g.escalation.patterns[i] != nil && !g.escalated.matched[i] {
+			continue
+		}
+		if 0 < rule.MinStatus && code < rule.MinStatus {
+			continue
+		}
+		if 0 < rule.MinLatency && latency < rule.MinLatency {
+			continue
+		}
+		if severity < rule.Severity {
+			severity = rule.Severity
+		}
+		names = append(names, rule.Name)
+	}
+	return severity, names
+}
+
+// escalatedLabel 適用された規則の名前をラベルにする
+func escalatedLabel(labels map[string]string, names []string) {
+	if 0 < len(names) {
+		labels["escalated"] = strings.Join(names, ",")
+	}
+}
+
+// payloadMessage 文字列のペイロード、またはmapのmessageフィールドを返す
+func payloadMessage(payload interface{}) (string, bool) {
+	switch p := payload.(type) {
+	case string:
+		return p, true
+	case map[string]interface{}:
+		message, ok := p["message"].(string)
+		return message, ok
+	}
+	return "", false
+}
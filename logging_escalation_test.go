@@ -0,0 +1,83 @@
+package glbr
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestEscalation(t *testing.T) {
+	rules := []EscalationRule{
+		{Name: "warnings", Severity: logging.Error, MinSeverity: logging.Warning, Count: 3},
+		{Name: "deadlock", Severity: logging.Critical, Message: "deadlock"},
+		{Name: "server_error", Severity: logging.Warning, MinStatus: 500},
+		{Name: "slow_deadlock", Severity: logging.Alert, Message: "deadlock", MinStatus: 503},
+	}
+	tests := []struct {
+		name      string
+		handler   func(w http.ResponseWriter, r *http.Request)
+		severity  logging.Severity
+		escalated string
+	}{
+		{"no rule", func(w http.ResponseWriter, r *http.Request) {
+			Warningf(r.Context(), "retry")
+			Warningf(r.Context(), "retry")
+		}, logging.Warning, ""},
+		{"count", func(w http.ResponseWriter, r *http.Request) {
+			Infof(r.Context(), "start")
+			Warningf(r.Context(), "retry")
+			Errorf(r.Context(), "retry")
+			Warningf(r.Context(), "retry")
+		}, logging.Error, "warnings"},
+		{"message", func(w http.ResponseWriter, r *http.Request) {
+			Infof(r.Context(), "deadlock detected")
+		}, logging.Critical, "deadlock"},
+		{"status", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}, logging.Warning, "server_error"},
+		{"all conditions", func(w http.ResponseWriter, r *http.Request) {
+			Infof(r.Context(), "deadlock detected")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}, logging.Alert, "deadlock,server_error,slow_deadlock"},
+		{"override", func(w http.ResponseWriter, r *http.Request) {
+			Infof(r.Context(), "deadlock detected")
+			SetGroupSeverity(r.Context(), logging.Info)
+		}, logging.Info, "deadlock"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, rec, err := NewRecorder("app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			s = s.WithEscalation(rules...)
+			s.GroupedBy("parent")(http.HandlerFunc(tt.handler)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+			parents := rec.Entries("parent")
+			if len(parents) != 1 {
+				t.Fatalf("parent entries = %d", len(parents))
+			}
+			if parents[0].Severity != tt.severity || parents[0].Labels["escalated"] != tt.escalated {
+				t.Errorf("parent = %v escalated=%q, want %v %q", parents[0].Severity, parents[0].Labels["escalated"], tt.severity, tt.escalated)
+			}
+		})
+	}
+}
+
+func TestWithEscalationInvalid(t *testing.T) {
+	for _, rule := range []EscalationRule{
+		{Name: "empty", Severity: logging.Error},
+		{Name: "pattern", Severity: logging.Error, Message: "("},
+	} {
+		func() {
+			defer func() {
+				if err, _ := recover().(error); !errors.Is(err, ErrInvalidEscalationRule) {
+					t.Errorf("%s: recovered = %v, want ErrInvalidEscalationRule", rule.Name, err)
+				}
+			}()
+			NewNoOp().WithEscalation(rule)
+		}()
+	}
+}
@@ -0,0 +1,62 @@
+//go:build windows
+// +build windows
+
+package glbr
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/logging"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// eventLogSink エントリをWindowsのイベントログに書き込むSink
+type eventLogSink struct {
+	log *eventlog.Log
+}
+
+// NewEventLogSink エントリをWindowsのイベントログのsourceに書き込むSink
+// Windows Serverで動くサービス向け。sourceは事前に eventlog.InstallAsEventCreate 等で登録しておく
+// severityはイベントのレベル(Error以上: エラー, Warning: 警告, それ以外: 情報)に対応付け、
+// イベントIDはseverityを100で割った値(Debug: 1 ... Emergency: 8, Default: 0)になる
+//
+//	sink, err := glbr.NewEventLogSink("api")
+//	log = log.AddSink(sink, glbr.SinkFilter{MinSeverity: logging.Notice})
+func NewEventLogSink(source string) (Sink, error) {
+	l, err := eventlog.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLogSink{log: l}, nil
+}
+
+func (s *eventLogSink) Send(logID string, entry logging.Entry) {
+	var b strings.Builder
+	b.WriteString(entryMessage(entry))
+	fmt.Fprintf(&b, "\r\n\r\nlog_id: %s\r\nseverity: %s", logID, entry.Severity)
+	if entry.Trace != "" {
+		fmt.Fprintf(&b, "\r\ntrace: %s", entry.Trace)
+	}
+	for _, k := range sortedKeys(entry.Labels) {
+		fmt.Fprintf(&b, "\r\n%s: %s", k, entry.Labels[k])
+	}
+	eid := uint32(entry.Severity / 100)
+	var err error
+	switch {
+	case logging.Error <= entry.Severity:
+		err = s.log.Error(eid, b.String())
+	case logging.Warning <= entry.Severity:
+		err = s.log.Warning(eid, b.String())
+	default:
+		err = s.log.Info(eid, b.String())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glbr: eventlog: %v\n", err)
+	}
+}
+
+func (s *eventLogSink) Close() error {
+	return s.log.Close()
+}
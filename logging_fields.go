@@ -0,0 +1,199 @@
+package glbr
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FieldType Setで設定するフィールドの型
+type FieldType int
+
+// フィールドの型
+const (
+	FieldAny      FieldType = iota // 型を検証しない
+	FieldString                    // string
+	FieldInt                       // 整数型
+	FieldFloat                     // 浮動小数点型または整数型
+	FieldBool                      // bool
+	FieldDuration                  // time.Duration
+	FieldTime                      // time.Time
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case FieldString:
+		return "string"
+	case FieldInt:
+		return "int"
+	case FieldFloat:
+		return "float"
+	case FieldBool:
+		return "bool"
+	case FieldDuration:
+		return "duration"
+	case FieldTime:
+		return "time"
+	default:
+		return "any"
+	}
+}
+
+// FieldSpec 正規ログ行のフィールドの定義
+type FieldSpec struct {
+	Name           string
+	Type           FieldType
+	MaxCardinality int    // 値の種類の上限。超えた値は違反として扱う。0以下で制限しない
+	Description    string // フィールドの説明
+	Owner          string // フィールドを定義したチーム
+}
+
+// FieldRegistry フィールドの定義を一か所にまとめ、Setの値を検証する
+// チーム間でフィールドの名前や型がずれることを防ぐ
+type FieldRegistry struct {
+	mu     sync.Mutex
+	specs  map[string]FieldSpec
+	values map[string]map[string]struct{} // MaxCardinalityのあるフィールドの値の種類
+}
+
+// NewFieldRegistry specsを登録したFieldRegistryを返す
+// 同じ名前の定義が重複した場合はErrDuplicateFieldでpanicする
+//
+//	fields := glbr.NewFieldRegistry(
+//		glbr.FieldSpec{Name: "user_id", Type: glbr.FieldString, Owner: "accounts"},
+//		glbr.FieldSpec{Name: "plan", Type: glbr.FieldString, MaxCardinality: 10},
+//	)
+func NewFieldRegistry(specs ...FieldSpec) *FieldRegistry {
+	r := &FieldRegistry{specs: map[string]FieldSpec{}, values: map[string]map[string]struct{}{}}
+	for _, spec := range specs {
+		if err := r.Register(spec); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Register フィールドの定義を追加する
+// 同じ名前の定義がある場合はErrDuplicateFieldを返す
+func (r *FieldRegistry) Register(spec FieldSpec) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.specs[spec.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateField, spec.Name)
+	}
+	r.specs[spec.Name] = spec
+	return nil
+}
+
+// Fields 登録されたフィールドの定義を名前の順に返す
+func (r *FieldRegistry) Fields() []FieldSpec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	specs := make([]FieldSpec, 0, len(r.specs))
+	for _, spec := range r.specs {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs
+}
+
+// validate フィールドの値を検証し、違反の理由を返す
+func (r *FieldRegistry) validate(key string, value interface{}) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spec, ok := r.specs[key]
+	if !ok {
+		return "unknown"
+	}
+	if !spec.Type.accepts(value) {
+		return "type"
+	}
+	if 0 < spec.MaxCardinality {
+		seen := r.values[key]
+		if seen == nil {
+			seen = map[string]struct{}{}
+			r.values[key] = seen
+		}
+		v := fmt.Sprint(value)
+		if _, ok := seen[v]; !ok {
+			if spec.MaxCardinality <= len(seen) {
+				return "cardinality"
+			}
+			seen[v] = struct{}{}
+		}
+	}
+	return ""
+}
+
+// accepts valueがtの型かどうか
+func (t FieldType) accepts(value interface{}) bool {
+	switch t {
+	case FieldDuration:
+		_, ok := value.(time.Duration)
+		return ok
+	case FieldTime:
+		_, ok := value.(time.Time)
+		return ok
+	case FieldAny:
+		return true
+	}
+	if _, ok := value.(time.Duration); ok {
+		return false
+	}
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return t == FieldString
+	case reflect.Bool:
+		return t == FieldBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return t == FieldInt || t == FieldFloat
+	case reflect.Float32, reflect.Float64:
+		return t == FieldFloat
+	}
+	return false
+}
+
+// fieldPolicy WithFieldRegistryの設定
+type fieldPolicy struct {
+	registry *FieldRegistry
+	strict   bool
+}
+
+// WithFieldRegistry Setで設定するフィールドをregistryの定義で検証する
+// 未定義、型の不一致、値の種類の超過は親エントリに field_violations={名前}:{理由},... ラベルとして記録し、
+// strictの場合はフィールドを出力しない
+func (s Service) WithFieldRegistry(registry *FieldRegistry, strict bool) Service {
+	s.fieldPolicy = &fieldPolicy{registry: registry, strict: strict}
+	return s
+}
+
+// check フィールドを検証し、設定してよいかどうかを返す
+// 違反はグループに記録する。gのmuを保持して呼び出す
+func (p *fieldPolicy) check(g *group, key string, value interface{}) bool {
+	if p == nil {
+		return true
+	}
+	reason := p.registry.validate(key, value)
+	if reason == "" {
+		return true
+	}
+	g.violations = append(g.violations, key+":"+reason)
+	return !p.strict
+}
+
+// violationLabel フィールドの違反をラベルにする
+func (g *group) violationLabel(labels map[string]string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if 0 < len(g.violations) {
+		labels["field_violations"] = strings.Join(g.violations, ",")
+	}
+}
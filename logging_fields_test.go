@@ -0,0 +1,98 @@
+package glbr
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFieldTypeAccepts(t *testing.T) {
+	tests := []struct {
+		typ   FieldType
+		value interface{}
+		want  bool
+	}{
+		{FieldString, "a", true},
+		{FieldString, 1, false},
+		{FieldInt, 1, true},
+		{FieldInt, uint8(1), true},
+		{FieldInt, 1.5, false},
+		{FieldInt, time.Second, false},
+		{FieldFloat, 1, true},
+		{FieldFloat, 1.5, true},
+		{FieldFloat, "1.5", false},
+		{FieldBool, true, true},
+		{FieldBool, "true", false},
+		{FieldDuration, time.Second, true},
+		{FieldDuration, 1, false},
+		{FieldTime, time.Now(), true},
+		{FieldTime, "2024-05-01", false},
+		{FieldAny, nil, true},
+		{FieldString, nil, false},
+	}
+	for _, tt := range tests {
+		if got := tt.typ.accepts(tt.value); got != tt.want {
+			t.Errorf("%v accepts %#v = %v, want %v", tt.typ, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFieldRegistry(t *testing.T) {
+	registry := NewFieldRegistry(
+		FieldSpec{Name: "user_id", Type: FieldString, Owner: "accounts"},
+		FieldSpec{Name: "plan", Type: FieldString, MaxCardinality: 2},
+	)
+	if err := registry.Register(FieldSpec{Name: "plan"}); !errors.Is(err, ErrDuplicateField) {
+		t.Errorf("Register duplicate = %v, want ErrDuplicateField", err)
+	}
+	if err := registry.Register(FieldSpec{Name: "items", Type: FieldInt}); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, spec := range registry.Fields() {
+		names = append(names, spec.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"items", "plan", "user_id"}) {
+		t.Errorf("Fields = %v", names)
+	}
+
+	for _, strict := range []bool{false, true} {
+		s, rec, err := NewRecorder("app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s = s.WithFieldRegistry(registry, strict)
+		for _, plan := range []string{"free", "pro", "free", "enterprise"} {
+			plan := plan
+			s.GroupedBy("parent")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Set(r.Context(), "user_id", "u1")
+				Set(r.Context(), "plan", plan)
+				Set(r.Context(), "items", "3")
+				Set(r.Context(), "unknown", true)
+			})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}
+		parents := rec.Entries("parent")
+		if len(parents) != 4 {
+			t.Fatalf("parent entries = %d", len(parents))
+		}
+		if got := parents[2].Labels["field_violations"]; got != "items:type,unknown:unknown" {
+			t.Errorf("strict=%v: known plan violations = %q", strict, got)
+		}
+		last := parents[3]
+		if got := last.Labels["field_violations"]; got != "plan:cardinality,items:type,unknown:unknown" {
+			t.Errorf("strict=%v: violations = %q", strict, got)
+		}
+		fields := last.Payload.(map[string]interface{})["fields"].(map[string]interface{})
+		if fields["user_id"] != "u1" {
+			t.Errorf("strict=%v: valid field is not set: %v", strict, fields)
+		}
+		_, hasPlan := fields["plan"]
+		_, hasItems := fields["items"]
+		if hasPlan == strict || hasItems == strict {
+			t.Errorf("strict=%v: fields = %v", strict, fields)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package glbr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// Formatter WithIOWriter, AddIOWriterの出力先にエントリを書き込む形式
+type Formatter func(w io.Writer, entry logging.Entry) error
+
+// WithIOFormat WithIOWriterの出力先に書き込む形式を指定する Default: TextFormat
+func (s Service) WithIOFormat(format Formatter) Service {
+	s.ctx = setIOFormat(s.ctx, format)
+	return s
+}
+
+// payloadText ペイロードを文字列にする
+func payloadText(payload interface{}) string {
+	if pl, ok := payload.(string); ok {
+		return pl
+	}
+	b, _ := json.Marshal(payload)
+	return string(b)
+}
+
+// TextFormat テキスト形式
+//
+//	2006/01/02 03:04:05 Debug: message trace=1234
+func TextFormat(w io.Writer, entry logging.Entry) error {
+	tm := entry.Timestamp.Format("2006/01/02 03:04:05")
+	_, err := fmt.Fprintf(w, "%s %s: %s trace=%s\n", tm, entry.Severity, payloadText(entry.Payload), entry.Trace)
+	return err
+}
+
+// jsonLine JSONFormatの1行
+type jsonLine struct {
+	Time     string            `json:"time"`
+	Severity string            `json:"severity"`
+	Message  interface{}       `json:"message"`
+	Trace    string            `json:"trace,omitempty"`
+	SpanID   string            `json:"span_id,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+// JSONFormat JSON Lines形式
+//
+//	{"time":"2006-01-02T15:04:05.000000000Z","severity":"Debug","message":"message","trace":"1234"}
+func JSONFormat(w io.Writer, entry logging.Entry) error {
+	b, err := json.Marshal(jsonLine{
+		Time:     entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		Severity: entry.Severity.String(),
+		Message:  entry.Payload,
+		Trace:    entry.Trace,
+		SpanID:   entry.SpanID,
+		Labels:   entry.Labels,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// severityColor severity毎のANSIエスケープシーケンス
+func severityColor(severity logging.Severity) string {
+	switch {
+	case logging.Error <= severity:
+		return "\x1b[31m" // red
+	case logging.Warning <= severity:
+		return "\x1b[33m" // yellow
+	case logging.Notice <= severity:
+		return "\x1b[36m" // cyan
+	case logging.Info <= severity:
+		return "\x1b[32m" // green
+	default:
+		return "\x1b[90m" // gray
+	}
+}
+
+// ConsoleFormat 色付きのコンソール形式
+//
+//	15:04:05.000 DEBUG     message  trace=1234
+func ConsoleFormat(w io.Writer, entry logging.Entry) error {
+	_, err := fmt.Fprintf(w, "%s %s%-9s\x1b[0m %s  \x1b[90mtrace=%s\x1b[0m\n",
+		entry.Timestamp.Format("15:04:05.000"), severityColor(entry.Severity),
+		strings.ToUpper(entry.Severity.String()), payloadText(entry.Payload), entry.Trace)
+	return err
+}
+
+// PrettyFormat ローカル実行向けの色付きの形式
+// 親エントリはリクエストの行として、WithPrettyOutputではグループの子エントリをその下に字下げして書き込む
+//
+//	15:04:05.000 ▶ GET /path 200 12.3ms
+//	  │ 15:04:05.000 INFO      message  key=value
+func PrettyFormat(w io.Writer, entry logging.Entry) error {
+	tm := entry.Timestamp.Format("15:04:05.000")
+	color := severityColor(entry.Severity)
+	if req := entry.HTTPRequest; req != nil && req.Request != nil {
+		line := fmt.Sprintf("%s %s▶ %s %s %d\x1b[0m %v", tm, color,
+			req.Request.Method, req.Request.URL.RequestURI(), req.Status, req.Latency.Round(100*time.Microsecond))
+		if entry.Payload != nil {
+			line += "  " + payloadText(entry.Payload)
+		}
+		_, err := fmt.Fprintf(w, "%s%s\n", line, prettyLabels(entry.Labels))
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s%-9s\x1b[0m %s%s\n", tm, color,
+		strings.ToUpper(entry.Severity.String()), payloadText(entry.Payload), prettyLabels(entry.Labels))
+	return err
+}
+
+// prettyLabels ラベルをキーの順に並べる
+func prettyLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString("  \x1b[90m")
+	for i, k := range keys {
+		if 0 < i {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s=%s", k, labels[k])
+	}
+	b.WriteString("\x1b[0m")
+	return b.String()
+}
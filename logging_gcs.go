@@ -0,0 +1,48 @@
+package glbr
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// NewGCSSink エントリをinterval毎にgzipで圧縮したJSON Lines(SinkRecord)のオブジェクトとしてbucketにアップロードするSink
+// 通常の取り込みと並行して安価に長期保存する場合に使う。intervalが0以下の場合は1分
+// オブジェクト名は {prefix}2006/01/02/15-04-05.000000000-{乱数}.jsonl.gz (UTC)
+//
+//	log = log.AddSink(glbr.NewGCSSink(client.Bucket("log-archive"), "api/", 5*time.Minute), glbr.SinkFilter{})
+func NewGCSSink(bucket *storage.BucketHandle, prefix string, interval time.Duration) Sink {
+	return newBatchSink("gcs", interval, 100000, func(records []SinkRecord) error {
+		return uploadJSONL(bucket, prefix, records)
+	})
+}
+
+// uploadJSONL recordsを1つのオブジェクトとしてアップロードする
+func uploadJSONL(bucket *storage.BucketHandle, prefix string, records []SinkRecord) error {
+	name := fmt.Sprintf("%s%s-%08x.jsonl.gz", prefix, time.Now().UTC().Format("2006/01/02/15-04-05.000000000"), rand.Uint32())
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	w := bucket.Object(name).NewWriter(c)
+	w.ContentType = "application/x-ndjson"
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			w.CloseWithError(err)
+			return err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		w.CloseWithError(err)
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("upload %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package glbr
+
+import (
+	"context"
+	"strconv"
+
+	"cloud.google.com/go/logging"
+)
+
+const (
+	goroutineDumpLimit = 1 << 20  // DumpGoroutinesで出力する最大バイト数
+	goroutineDumpChunk = 64 << 10 // 1エントリあたりの最大バイト数。エントリの上限(256KB)より小さくする
+)
+
+// DumpGoroutines 全てのgoroutineのスタックをWarningでcのグループに出力する
+// リクエストが期限に達しそうな時に、処理が止まっている箇所を調べる場合に使う。
+// 1MBまでを64KB毎のエントリに分けて出力し、各エントリには goroutine_dump_chunk={n}/{total} ラベルが付く
+//
+//	if deadline, ok := c.Deadline(); ok && time.Until(deadline) < time.Second {
+//		glbr.DumpGoroutines(c)
+//	}
+func DumpGoroutines(c context.Context) {
+	if !Enabled(c, logging.Warning) {
+		return
+	}
+	dump := goroutines(goroutineDumpLimit)
+	total := (len(dump) + goroutineDumpChunk - 1) / goroutineDumpChunk
+	for i := 0; i < total; i++ {
+		end := (i + 1) * goroutineDumpChunk
+		if len(dump) < end {
+			end = len(dump)
+		}
+		labels := map[string]string{"goroutine_dump_chunk": strconv.Itoa(i+1) + "/" + strconv.Itoa(total)}
+		if i == total-1 && len(dump) == goroutineDumpLimit {
+			labels["goroutine_dump_truncated"] = "true"
+		}
+		sendPayload(c, logging.Warning, dump[i*goroutineDumpChunk:end], labels)
+	}
+}
@@ -0,0 +1,324 @@
+package glbr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// group リクエスト単位のグループ状態
+// handlerから起動されたgoroutineからも参照されるため、状態の変更はmuで保護する
+type group struct {
+	id           string
+	spanID       string         // WithEntrySpansで親エントリに付けるSpanID
+	traced       bool           // リクエストヘッダーのtraceを引き継いだ
+	sampled      bool           // traceがサンプリングされている
+	remoteSpanID string         // 呼び出し元のSpanID
+	insertID     string         // 親エントリのInsertID。lateの子エントリが参照する
+	wg           sync.WaitGroup // Goで起動されたgoroutine
+	response     *logResponse   // グループのレスポンス
+
+	mu       sync.Mutex
+	closed   bool              // 親エントリの出力後
+	waiting  bool              // Goで起動されたgoroutineの終了を待ち始めた
+	running  int               // 実行中のGoで起動されたgoroutine
+	late     bool              // レスポンスの送信開始後にError以上のエントリが出力された
+	max      logging.Severity  // 子エントリの最大severity
+	timeout  time.Duration     // 超過したタイムアウト
+	severity *logging.Severity // 親エントリのseverityの上書き
+	labels   map[string]string // 親エントリに付加するラベル
+	outcome  interface{}       // 親エントリのペイロード
+	held     []logging.Entry   // 親エントリの後にまとめて出力する子エントリ
+	debug    *debugBuffer      // WithDebugBufferで保持するDebugエントリ
+
+	escalation  *escalation            // WithEscalationの規則
+	escalated   *escalationState       // 規則の評価に使う子エントリの集計
+	snapshot    *snapshot              // WithSnapshotsで記録する子エントリ
+	fields      map[string]interface{} // Setで設定した親エントリのフィールド
+	canonical   *canonicalLine         // WithCanonicalLogLineで畳み込んだ子エントリ
+	fieldPolicy *fieldPolicy           // WithFieldRegistryの設定
+	violations  []string               // フィールドの違反
+}
+
+func newGroup(id string) *group {
+	return &group{id: id, sampled: true}
+}
+
+// raise 子エントリのseverityを集計する
+// 親エントリの出力後に呼ばれた場合は集計せずにlateを返す
+func (g *group) raise(severity logging.Severity) (late bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return true
+	}
+	if g.max < severity {
+		g.max = severity
+	}
+	if logging.Error <= severity && g.response != nil && g.response.wroteHeader() {
+		g.late = true
+	}
+	return false
+}
+
+// hold 子エントリを親エントリの出力まで保持する
+// 親エントリの出力後は保持せずにfalseを返す
+func (g *group) hold(entry logging.Entry) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return false
+	}
+	g.held = append(g.held, entry)
+	return true
+}
+
+// heldEntries holdで保持された子エントリ
+func (g *group) heldEntries() []logging.Entry {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.held
+}
+
+// lateError レスポンスの送信開始後にError以上のエントリが出力されたかどうか
+// テンプレートの実行エラー等、ボディの途中で発生したエラーの検出に使う
+func (g *group) lateError() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.late
+}
+
+// close グループを閉じる
+// 以降の子エントリは親エントリに集計されず、late=trueと親エントリのInsertIDのparent_insert_idラベル付きで出力される
+func (g *group) close() {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+}
+
+// maxSeverity 子エントリの最大severity
+func (g *group) maxSeverity() logging.Severity {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.max
+}
+
+// parentInsertID 親エントリのInsertID
+// 冪等キーがある場合はキーから導出する
+func (s Service) parentInsertID(parentLogID string, r *http.Request) string {
+	if hash := s.idempotencyHash(parentLogID, r); hash != "" {
+		return "idem-" + hash
+	}
+	return fmt.Sprintf("%016x%016x", newSpanIDValue(), newSpanIDValue())
+}
+
+// wait Goで起動されたgoroutineの終了を待つ
+// 以降のGoは待たない
+func (g *group) wait() {
+	g.mu.Lock()
+	g.waiting = true
+	g.mu.Unlock()
+	g.wg.Wait()
+}
+
+// startWait 以降のGoを待たないようにし、実行中のgoroutineが残っているかを返す
+func (g *group) startWait() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.waiting = true
+	return 0 < g.running
+}
+
+// untrack Goで起動したgoroutineの終了を記録する
+func (g *group) untrack() {
+	g.mu.Lock()
+	g.running--
+	g.mu.Unlock()
+	g.wg.Done()
+}
+
+// track Goで起動するgoroutineを待つ対象に加える
+// 既に待ち始めている場合はfalse
+func (g *group) track() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.waiting || g.closed {
+		return false
+	}
+	g.wg.Add(1)
+	g.running++
+	return true
+}
+
+// Go グループを引き継いだgoroutineでfnを実行する
+// グループの親エントリはfnの終了を待ってから出力される。handlerの応答はfnの終了を待たない
+// handlerの終了後に呼び出された場合は待たずに実行し、親エントリの出力後のエントリはlateになる
+func Go(c context.Context, fn func(c context.Context)) {
+	if g, ok := getGroup(c); ok && g.track() {
+		go func() {
+			defer g.untrack()
+			fn(c)
+		}()
+		return
+	}
+	go fn(c)
+}
+
+// setTimeout タイムアウトの超過を記録する
+func (g *group) setTimeout(budget time.Duration) {
+	g.mu.Lock()
+	g.timeout = budget
+	g.mu.Unlock()
+}
+
+// timedOut タイムアウトを超過していればその設定値を返す
+func (g *group) timedOut() (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.timeout, 0 < g.timeout
+}
+
+// overrideSeverity SetGroupSeverityで指定されたseverity
+func (g *group) overrideSeverity() (logging.Severity, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.severity == nil {
+		return logging.Default, false
+	}
+	return *g.severity, true
+}
+
+// SetGroupSeverity グループの親エントリのseverityを指定する
+// 子エントリの最大severityより優先される。グループ外では何もしない
+func SetGroupSeverity(c context.Context, severity logging.Severity) {
+	if g, ok := getGroup(c); ok {
+		g.mu.Lock()
+		g.severity = &severity
+		g.mu.Unlock()
+	}
+}
+
+// annotations Annotateで付加されたラベルのコピー
+func (g *group) annotations() map[string]string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	labels := make(map[string]string, len(g.labels))
+	for k, v := range g.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// Annotate グループの親エントリにラベルを付加する
+// グループが閉じられる時にまとめて出力される。グループ外では何もしない
+func Annotate(c context.Context, key, value string) {
+	if g, ok := getGroup(c); ok {
+		g.mu.Lock()
+		if g.labels == nil {
+			g.labels = map[string]string{}
+		}
+		g.labels[key] = value
+		g.mu.Unlock()
+	}
+}
+
+// payload 親エントリのペイロード
+func (g *group) payload() interface{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	payload := map[string]interface{}{}
+	if g.outcome != nil {
+		payload["outcome"] = g.outcome
+	}
+	if 0 < len(g.fields) {
+		payload["fields"] = g.fields
+	}
+	if g.canonical != nil && 0 < len(g.canonical.messages) {
+		payload["messages"] = g.canonical.messages
+		if 0 < g.canonical.dropped {
+			payload["messages_dropped"] = g.canonical.dropped
+		}
+	}
+	if len(payload) == 0 {
+		return nil
+	}
+	return versioned(payload)
+}
+
+// Outcome グループの親エントリのペイロードに処理結果を付加する
+// resultはencoding/jsonで変換され、{"outcome": result}として出力される。グループ外では何もしない
+func Outcome(c context.Context, result interface{}) {
+	if g, ok := getGroup(c); ok {
+		g.mu.Lock()
+		g.outcome = result
+		g.mu.Unlock()
+	}
+}
+
+// Timeout 処理時間をbudgetで制限する
+// 超過した場合は503を返し、グループの親エントリをWarning以上にしてtimeout=trueとbudgetを記録する
+func (s Service) Timeout(budget time.Duration) GroupingHandler {
+	return s.TimeoutStatus(budget, http.StatusServiceUnavailable)
+}
+
+// TimeoutStatus 処理時間をbudgetで制限し、超過した場合はstatus(503または504)を返す
+// GroupedByの内側に置く。グループの外で超過した場合は、timeout=trueとbudgetをWarningで出力する
+//
+//	handler := log.GroupedBy("ParentLogID")(log.TimeoutStatus(time.Second, http.StatusGatewayTimeout)(mux))
+func (s Service) TimeoutStatus(budget time.Duration, status int) GroupingHandler {
+	if status != http.StatusServiceUnavailable && status != http.StatusGatewayTimeout {
+		panic(ErrInvalidTimeoutStatus)
+	}
+	return func(next http.Handler) http.Handler {
+		if _, ok := next.(*groupHandler); ok {
+			panic(ErrTimeoutOutsideGroup)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), budget)
+			defer cancel()
+			res := &logResponse{origin: timeoutWriter{ResponseWriter: w, ctx: ctx, status: status}}
+			http.TimeoutHandler(next, budget, "").ServeHTTP(res, r.WithContext(ctx))
+			if code, _, _ := res.status(); code != http.StatusServiceUnavailable || ctx.Err() != context.DeadlineExceeded {
+				return
+			}
+			if g, ok := getGroup(ctx); ok {
+				g.setTimeout(budget)
+				return
+			}
+			c := ctx
+			if _, ok := getLogger(c); !ok {
+				c = s.Context()
+			}
+			sendPayload(c, logging.Warning, fmt.Sprintf("%s %s timed out after %s", r.Method, r.URL.Path, budget), map[string]string{
+				"timeout":        "true",
+				"timeout_budget": budget.String(),
+			})
+		})
+	}
+}
+
+// timeoutWriter http.TimeoutHandlerが超過時に送信する503をstatusに置き換える
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx    context.Context
+	status int
+}
+
+func (w timeoutWriter) WriteHeader(code int) {
+	if code == http.StatusServiceUnavailable && w.ctx.Err() == context.DeadlineExceeded {
+		code = w.status
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// GroupedByTimeout GroupedByとTimeoutを組み合わせたもの
+func (s Service) GroupedByTimeout(parentLogID string, budget time.Duration) GroupingHandler {
+	group, timeout := s.GroupedBy(parentLogID), s.Timeout(budget)
+	return func(next http.Handler) http.Handler {
+		return group(timeout(next))
+	}
+}
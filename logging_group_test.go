@@ -0,0 +1,143 @@
+package glbr
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestGroupRaiseClose(t *testing.T) {
+	const n = 1000
+	g := newGroup("trace")
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		late int
+		max  logging.Severity
+	)
+	wg.Add(n + 1)
+	for i := 0; i < n; i++ {
+		severity := logging.Severity((i%7 + 1) * 100)
+		go func() {
+			defer wg.Done()
+			l := g.raise(severity)
+			mu.Lock()
+			defer mu.Unlock()
+			if l {
+				late++
+			} else if max < severity {
+				max = severity
+			}
+		}()
+	}
+	go func() {
+		defer wg.Done()
+		g.close()
+	}()
+	wg.Wait()
+	if got := g.maxSeverity(); got != max {
+		t.Errorf("maxSeverity = %v, want %v (late %d)", got, max, late)
+	}
+	if !g.raise(logging.Emergency) {
+		t.Error("raise after close is not late")
+	}
+	if got := g.maxSeverity(); got != max {
+		t.Errorf("maxSeverity after late raise = %v, want %v", got, max)
+	}
+}
+
+func TestTimeoutStatus(t *testing.T) {
+	var buf bytes.Buffer
+	s, err := NewLocal("app", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	timeout := s.TimeoutStatus(10*time.Millisecond, http.StatusGatewayTimeout)
+
+	w := httptest.NewRecorder()
+	s.GroupedBy("parent")(timeout(slow)).ServeHTTP(w, httptest.NewRequest("GET", "/grouped", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("grouped status = %d, want 504", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	timeout(slow).ServeHTTP(w, httptest.NewRequest("GET", "/ungrouped", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("ungrouped status = %d, want 504", w.Code)
+	}
+	s.Shutdown(context.Background())
+	if out := buf.String(); !strings.Contains(out, "GET /ungrouped timed out after 10ms") || strings.Count(out, "timeout=true") != 2 {
+		t.Errorf("output = %s", out)
+	}
+}
+
+// 親エントリの出力を待ち始めた後のGoは待たれずに実行される
+func TestGoAfterWait(t *testing.T) {
+	g := newGroup("trace")
+	c := setGroup(context.Background(), g)
+	release := make(chan struct{})
+	Go(c, func(context.Context) { <-release })
+	waited := make(chan struct{})
+	go func() {
+		g.wait()
+		close(waited)
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		Go(c, func(context.Context) { wg.Done() })
+	}
+	wg.Wait()
+	close(release)
+	<-waited
+	g.close()
+	done := make(chan struct{})
+	Go(c, func(context.Context) { close(done) })
+	<-done
+}
+
+// Goで起動されたgoroutineが残っていてもhandlerの応答は待たされず、親エントリはその終了後に出力される
+func TestGoDoesNotBlockResponse(t *testing.T) {
+	s, rec, err := NewRecorder("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	handler := s.GroupedBy("parent")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Go(r.Context(), func(c context.Context) {
+			<-release
+			Infof(c, "background")
+		})
+	}))
+	served := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		close(served)
+	}()
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Fatal("ServeHTTP waited for the goroutine started by Go")
+	}
+	if got := len(rec.Entries("parent")); got != 0 {
+		t.Errorf("parent entries before release = %d, want 0", got)
+	}
+	close(release)
+	s.Shutdown(context.Background())
+	if got := len(rec.Entries("parent")); got != 1 {
+		t.Errorf("parent entries after shutdown = %d, want 1", got)
+	}
+	if got := len(rec.Entries("app")); got != 1 {
+		t.Errorf("child entries = %d, want 1", got)
+	}
+}
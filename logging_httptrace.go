@@ -0,0 +1,123 @@
+package glbr
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// clientTiming 外部呼び出しの各フェーズの所要時間
+type clientTiming struct {
+	Host         string `json:"host"`
+	Reused       bool   `json:"reused"`
+	DNS          string `json:"dns,omitempty"`
+	Connect      string `json:"connect,omitempty"`
+	TLSHandshake string `json:"tls_handshake,omitempty"`
+	TTFB         string `json:"ttfb,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// ClientTrace 外部呼び出しのDNS、接続、TLSハンドシェイク、最初のレスポンスバイトまでの時間を
+// {"http_client_trace": {...}}としてDebugで出力するhttptrace.ClientTraceを返す
+// DNS、接続、TLSハンドシェイクが失敗した場合は、その時点までの時間とエラーをWarningで出力する。出力は1回だけ
+// cがグループ内であれば子エントリとして出力される
+func ClientTrace(c context.Context) *httptrace.ClientTrace {
+	clock := clockFrom(c)
+	var (
+		mu                             sync.Mutex
+		timing                         clientTiming
+		sent                           bool
+		start, dns, connect, handshake time.Time
+	)
+	send := func(severity logging.Severity) {
+		mu.Lock()
+		if sent {
+			mu.Unlock()
+			return
+		}
+		sent = true
+		t := timing
+		mu.Unlock()
+		sendPayload(c, severity, versioned(map[string]interface{}{"http_client_trace": t}), nil)
+	}
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			mu.Lock()
+			start = clock.Now()
+			timing.Host = hostPort
+			mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			timing.Reused = info.Reused
+			mu.Unlock()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			dns = clock.Now()
+			mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			mu.Lock()
+			timing.DNS = clock.Since(dns).String()
+			if info.Err != nil {
+				timing.Error = info.Err.Error()
+			}
+			mu.Unlock()
+			if info.Err != nil {
+				send(logging.Warning)
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			connect = clock.Now()
+			mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			timing.Connect = clock.Since(connect).String()
+			if err != nil {
+				timing.Error = err.Error()
+			}
+			mu.Unlock()
+			if err != nil {
+				send(logging.Warning)
+			}
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			handshake = clock.Now()
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			mu.Lock()
+			timing.TLSHandshake = clock.Since(handshake).String()
+			if err != nil {
+				timing.Error = err.Error()
+			}
+			mu.Unlock()
+			if err != nil {
+				send(logging.Warning)
+			}
+		},
+		GotFirstResponseByte: func() {
+			mu.Lock()
+			timing.TTFB = clock.Since(start).String()
+			mu.Unlock()
+			send(logging.Debug)
+		},
+	}
+}
+
+// WithClientTrace リクエストのcontextにClientTraceを設定したリクエストを返す
+//
+//	res, err := http.DefaultClient.Do(glbr.WithClientTrace(req))
+func WithClientTrace(req *http.Request) *http.Request {
+	c := req.Context()
+	return req.WithContext(httptrace.WithClientTrace(c, ClientTrace(c)))
+}
@@ -0,0 +1,54 @@
+package glbr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"cloud.google.com/go/logging"
+)
+
+// DefaultIdempotencyHeaders WithIdempotencyKeyで参照するリクエストヘッダー
+var DefaultIdempotencyHeaders = []string{"Idempotency-Key", "X-Idempotency-Key"}
+
+// WithIdempotencyKey 冪等キーのヘッダーがあるリクエストの親エントリに、キーから導出したInsertIDと
+// idempotency_key_hashラベルを設定する。DefaultIdempotencyHeadersとheadersを順に参照し、最初に見つかった値を使う
+// Cloud Loggingが重複として除外するのはtimestampも同じエントリだけのため、時刻の異なるクライアントのリトライは除外されない。
+// リトライをまとめる場合は、クエリでラベルごとに最初のエントリを選ぶ
+//
+//	SELECT * EXCEPT(n) FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY labels.idempotency_key_hash ORDER BY timestamp) AS n FROM logs) WHERE n = 1
+func (s Service) WithIdempotencyKey(headers ...string) Service {
+	s.idempotencyHeaders = append(append([]string{}, DefaultIdempotencyHeaders...), headers...)
+	return s
+}
+
+// idempotencyHash 冪等キーのハッシュ。キーがない場合は""
+// 別のエンドポイントで同じキーが使われても衝突しないよう、logID、メソッド、ホスト、パスを含める
+func (s Service) idempotencyHash(parentLogID string, r *http.Request) string {
+	for _, name := range s.idempotencyHeaders {
+		key := r.Header.Get(name)
+		if key == "" {
+			continue
+		}
+		h := sha256.New()
+		for _, v := range []string{parentLogID, r.Method, r.Host, r.URL.Path, key} {
+			h.Write([]byte(v))
+			h.Write([]byte{0})
+		}
+		return hex.EncodeToString(h.Sum(nil))[:32]
+	}
+	return ""
+}
+
+// recordIdempotency 冪等キーから親エントリのInsertIDとラベルを導出する
+func (s Service) recordIdempotency(entry *logging.Entry, parentLogID string, r *http.Request) {
+	hash := s.idempotencyHash(parentLogID, r)
+	if hash == "" {
+		return
+	}
+	entry.InsertID = "idem-" + hash
+	if entry.Labels == nil {
+		entry.Labels = map[string]string{}
+	}
+	entry.Labels["idempotency_key_hash"] = hash
+}
@@ -0,0 +1,31 @@
+package glbr
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+// 同じキーのリトライは同じラベルになり、エンドポイントが異なれば別のラベルになる
+func TestRecordIdempotency(t *testing.T) {
+	s := Service{}.WithIdempotencyKey()
+	record := func(path, key string) logging.Entry {
+		r := httptest.NewRequest("POST", path, nil)
+		r.Header.Set("Idempotency-Key", key)
+		var entry logging.Entry
+		s.recordIdempotency(&entry, "parent", r)
+		return entry
+	}
+	first, retry, other := record("/orders", "k1"), record("/orders", "k1"), record("/refunds", "k1")
+	hash := first.Labels["idempotency_key_hash"]
+	if hash == "" || retry.Labels["idempotency_key_hash"] != hash {
+		t.Errorf("labels = %v, %v", first.Labels, retry.Labels)
+	}
+	if other.Labels["idempotency_key_hash"] == hash {
+		t.Error("different path has the same hash")
+	}
+	if first.InsertID != "idem-"+hash {
+		t.Errorf("InsertID = %q", first.InsertID)
+	}
+}
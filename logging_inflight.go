@@ -0,0 +1,29 @@
+package glbr
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// WithInFlight 親エントリにリクエストの到着時点で処理中だったリクエスト数(自身を含む)を inflight ラベルとして付加する
+// GroupedByで作成したhandler毎に数える。レイテンシの悪化と同時実行数の相関を調べる場合に使う
+func (s Service) WithInFlight() Service {
+	s.inflight = true
+	return s
+}
+
+// enter 処理中のリクエスト数を1増やし、増やした後の数と、処理の終了時に呼び出すleaveを返す
+func (h *groupHandler) enter() (n int64, leave func()) {
+	if !h.s.inflight {
+		return 0, func() {}
+	}
+	n = atomic.AddInt64(&h.active, 1)
+	return n, func() { atomic.AddInt64(&h.active, -1) }
+}
+
+// inflightLabels 処理中のリクエスト数を親エントリのラベルにする
+func inflightLabels(labels map[string]string, n int64) {
+	if 0 < n {
+		labels["inflight"] = strconv.FormatInt(n, 10)
+	}
+}
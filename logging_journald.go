@@ -0,0 +1,134 @@
+//go:build linux
+// +build linux
+
+package glbr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/logging"
+)
+
+// journalSocket systemd-journaldのネイティブプロトコルのソケット
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalSink エントリをsystemd-journaldに送信するSink
+type journalSink struct {
+	identifier string
+	mu         sync.Mutex
+	conn       *net.UnixConn
+	addr       *net.UnixAddr
+}
+
+// NewJournalSink エントリをsystemd-journaldにネイティブプロトコルで送信するSink
+// GCEのVMでsystemdのユニットとして動くサービス向け。severityはPRIORITYに対応付け、identifierはSYSLOG_IDENTIFIERになる。
+// TraceID、ラベル、リクエスト、ペイロードのフィールドは GLBR_TRACE, LABEL_{KEY}, HTTP_STATUS, PAYLOAD_{KEY} 等のフィールドになる
+//
+//	sink, err := glbr.NewJournalSink("api")
+//	log = log.AddSink(sink, glbr.SinkFilter{})
+func NewJournalSink(identifier string) (Sink, error) {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	addr := &net.UnixAddr{Name: journalSocket, Net: "unixgram"}
+	if _, err := os.Stat(journalSocket); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("journald: %w", err)
+	}
+	return &journalSink{identifier: identifier, conn: conn, addr: addr}, nil
+}
+
+func (s *journalSink) Send(logID string, entry logging.Entry) {
+	fields := map[string]string{
+		"MESSAGE":           entryMessage(entry),
+		"PRIORITY":          strconv.Itoa(journalPriority(entry.Severity)),
+		"SYSLOG_IDENTIFIER": s.identifier,
+		"GLBR_LOG_ID":       logID,
+		"GLBR_SEVERITY":     entry.Severity.String(),
+	}
+	if entry.Trace != "" {
+		fields["GLBR_TRACE"] = entry.Trace
+	}
+	if entry.SpanID != "" {
+		fields["GLBR_SPAN_ID"] = entry.SpanID
+	}
+	for k, v := range entry.Labels {
+		fields["LABEL_"+journalFieldName(k)] = v
+	}
+	if r := entry.HTTPRequest; r != nil && r.Request != nil {
+		fields["HTTP_METHOD"] = r.Request.Method
+		fields["HTTP_URL"] = r.Request.URL.String()
+		fields["HTTP_STATUS"] = strconv.Itoa(r.Status)
+		fields["HTTP_LATENCY"] = r.Latency.String()
+	}
+	if m, ok := jsonValue(entry.Payload).(map[string]interface{}); ok {
+		for k, v := range m {
+			if k != "message" {
+				fields["PAYLOAD_"+journalFieldName(k)] = payloadText(v)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	for _, k := range sortedKeys(fields) {
+		writeJournalField(&buf, k, fields[k])
+	}
+	s.mu.Lock()
+	_, err := s.conn.WriteToUnix(buf.Bytes(), s.addr)
+	s.mu.Unlock()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glbr: journald: %v\n", err)
+	}
+}
+
+func (s *journalSink) Close() error {
+	return s.conn.Close()
+}
+
+// writeJournalField フィールドをネイティブプロトコルで書き込む
+// 改行を含む値は長さ(64bitリトルエンディアン)を前置する
+func writeJournalField(buf *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(buf, "%s=%s\n", key, value)
+		return
+	}
+	buf.WriteString(key)
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalPriority severityをsyslogの優先度にする
+func journalPriority(severity logging.Severity) int {
+	switch {
+	case logging.Emergency <= severity:
+		return 0
+	case logging.Alert <= severity:
+		return 1
+	case logging.Critical <= severity:
+		return 2
+	case logging.Error <= severity:
+		return 3
+	case logging.Warning <= severity:
+		return 4
+	case logging.Notice <= severity:
+		return 5
+	case logging.Info <= severity || severity == logging.Default:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// journalFieldName journaldのフィールド名として有効な大文字、数字、_にする
+func journalFieldName(name string) string {
+	return strings.ToUpper(strings.TrimLeft(bigQueryFieldName(name), "_"))
+}
@@ -0,0 +1,63 @@
+package glbr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// KafkaProducer Kafkaへの書き込み
+// 使用するKafkaクライアント(sarama, kafka-go等)のproducerをこのinterfaceに合わせて渡す
+//
+//	type producer struct{ w *kafka.Writer }
+//
+//	func (p producer) Produce(c context.Context, topic string, key, value []byte) error {
+//		return p.w.WriteMessages(c, kafka.Message{Topic: topic, Key: key, Value: value})
+//	}
+type KafkaProducer interface {
+	Produce(c context.Context, topic string, key, value []byte) error
+}
+
+// KafkaOptions NewKafkaSinkの設定
+type KafkaOptions struct {
+	Topic    func(logID string) string // logIDの書き込み先のトピック Default: logID
+	OnError  func(err error)           // 書き込みに失敗したエントリ毎に呼ばれる。nilの場合は標準のloggerに出力する
+	Interval time.Duration             // 送信間隔 Default: 1秒
+}
+
+// NewKafkaSink エントリをSinkRecordのJSONとしてlogID毎のトピックに書き込むSink
+// キーはTraceIDで、同じリクエストのエントリは同じパーティションに入る。既存のストリーミング処理にグループのエントリを流す場合に使う
+//
+//	log = log.AddSink(glbr.NewKafkaSink(producer{w}, glbr.KafkaOptions{OnError: func(err error) { failures.Inc() }}), glbr.SinkFilter{})
+func NewKafkaSink(producer KafkaProducer, opts KafkaOptions) Sink {
+	if opts.Topic == nil {
+		opts.Topic = func(logID string) string { return logID }
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	return newBatchSink("kafka", opts.Interval, 1000, func(records []SinkRecord) error {
+		c, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		var first error
+		for _, record := range records {
+			value, err := json.Marshal(record)
+			if err == nil {
+				topic := opts.Topic(record.LogID)
+				if err = producer.Produce(c, topic, []byte(record.Trace), value); err != nil {
+					err = fmt.Errorf("produce %s: %w", topic, err)
+				}
+			}
+			if err == nil {
+				continue
+			}
+			if opts.OnError != nil {
+				opts.OnError(err)
+			} else if first == nil {
+				first = err
+			}
+		}
+		return first
+	})
+}
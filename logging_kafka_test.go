@@ -0,0 +1,85 @@
+package glbr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// fakeProducer 書き込まれたメッセージを記録するKafkaProducer
+type fakeProducer struct {
+	mu       sync.Mutex
+	messages []fakeMessage
+	fail     string // このトピックへの書き込みは失敗する
+}
+
+type fakeMessage struct {
+	topic      string
+	key, value []byte
+}
+
+func (p *fakeProducer) Produce(c context.Context, topic string, key, value []byte) error {
+	if topic == p.fail {
+		return errors.New("leader not available")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, fakeMessage{topic: topic, key: key, value: value})
+	return nil
+}
+
+func TestKafkaSink(t *testing.T) {
+	producer := &fakeProducer{}
+	sink := NewKafkaSink(producer, KafkaOptions{Topic: func(logID string) string { return "logs." + logID }, Interval: time.Hour})
+	sink.Send("app", logging.Entry{Timestamp: time.Now(), Severity: logging.Warning, Payload: "slow", Trace: "projects/p/traces/t1"})
+	sink.Send("audit", logging.Entry{Timestamp: time.Now(), Payload: map[string]string{"action": "login"}})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(producer.messages) != 2 {
+		t.Fatalf("messages = %d, want 2", len(producer.messages))
+	}
+	m := producer.messages[0]
+	if m.topic != "logs.app" || string(m.key) != "projects/p/traces/t1" {
+		t.Errorf("message = %s key %s, want the topic of the logID keyed by trace", m.topic, m.key)
+	}
+	var record SinkRecord
+	if err := json.Unmarshal(m.value, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.LogID != "app" || record.Severity != "Warning" || record.Payload != "slow" {
+		t.Errorf("record = %+v", record)
+	}
+	if producer.messages[1].topic != "logs.audit" || len(producer.messages[1].key) != 0 {
+		t.Errorf("second message = %s key %q", producer.messages[1].topic, producer.messages[1].key)
+	}
+}
+
+func TestKafkaSinkError(t *testing.T) {
+	producer := &fakeProducer{fail: "audit"}
+	sink := NewKafkaSink(producer, KafkaOptions{Interval: time.Hour})
+	sink.Send("audit", logging.Entry{Timestamp: time.Now(), Payload: "lost"})
+	sink.Send("app", logging.Entry{Timestamp: time.Now(), Payload: "kept"})
+	if err := sink.Close(); err == nil || !strings.Contains(err.Error(), "produce audit: leader not available") {
+		t.Errorf("Close = %v, want the produce error", err)
+	}
+	if len(producer.messages) != 1 || producer.messages[0].topic != "app" {
+		t.Errorf("messages = %v, want the entries after the failure to be written", producer.messages)
+	}
+
+	// OnErrorがある場合は失敗したエントリ毎に呼ばれ、エラーは返さない
+	var failed []error
+	sink = NewKafkaSink(&fakeProducer{fail: "audit"}, KafkaOptions{Interval: time.Hour, OnError: func(err error) { failed = append(failed, err) }})
+	sink.Send("audit", logging.Entry{Timestamp: time.Now()})
+	sink.Send("audit", logging.Entry{Timestamp: time.Now()})
+	if err := sink.Close(); err != nil || len(failed) != 2 {
+		t.Errorf("Close = %v, OnError calls = %d, want nil, 2", err, len(failed))
+	}
+}
@@ -0,0 +1,110 @@
+package glbr
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"cloud.google.com/go/logging"
+)
+
+// entryLogger エントリの書き込み先
+// *logging.Loggerを満たす
+type entryLogger interface {
+	Log(entry logging.Entry)
+	LogSync(c context.Context, entry logging.Entry) error
+	Flush() error
+}
+
+// discardLogger エントリを送信しないlogger
+type discardLogger struct{}
+
+func (discardLogger) Log(logging.Entry)                            {}
+func (discardLogger) LogSync(context.Context, logging.Entry) error { return nil }
+func (discardLogger) Flush() error                                 { return nil }
+
+// NewLocal Cloud Loggingに送信しないserviceを取得する
+// ローカル実行やdry-run向け。エントリはwにPrettyFormatで書き込まれ、グループの子エントリはリクエストの行の下に字下げされる
+//
+//	log, err := glbr.NewLocal("LogID", os.Stdout)
+func NewLocal(logID string, w io.Writer) (Service, error) {
+	if noOpBuild {
+		return NewNoOp(), nil
+	}
+	if err := validateLogID(logID); err != nil {
+		return Service{}, err
+	}
+	service := Service{
+		ctx:     context.Background(),
+		option:  make([]logging.LoggerOption, 0),
+		logID:   logID,
+		loggers: newLoggerCache(),
+		closer:  &closer{done: make(chan struct{})},
+		usage:   newUsage(),
+	}
+	return service.WithPrettyOutput(w), nil
+}
+
+// WithPrettyOutput wにPrettyFormatで書き込む出力先を追加する
+// グループの子エントリは親エントリの出力まで保持され、リクエストの行の下に字下げしてまとめて書き込まれる
+func (s Service) WithPrettyOutput(w io.Writer) Service {
+	s.ctx = addIOWriter(s.ctx, mirror{w: w, format: PrettyFormat, grouped: true})
+	return s
+}
+
+// mirrorGroup 親エントリと保持された子エントリをグループ単位で書き込む出力先に書き込む
+// 並行するリクエストの行が混ざらないように、グループ毎に1回で書き込む
+func mirrorGroup(c context.Context, parent logging.Entry, children []logging.Entry) {
+	st, _ := getState(c)
+	for _, m := range st.mirrors {
+		if !m.grouped {
+			continue
+		}
+		var buf bytes.Buffer
+		child := m
+		child.w = &indentWriter{w: &buf, prefix: []byte("  \x1b[90m│\x1b[0m "), start: true}
+		for _, entry := range children {
+			if m.minimum <= entry.Severity {
+				child.write(entry, st.format)
+			}
+		}
+		if buf.Len() == 0 && parent.Severity < m.minimum {
+			continue
+		}
+		var out bytes.Buffer
+		line := m
+		line.w = &out
+		line.write(parent, st.format)
+		out.Write(buf.Bytes())
+		m.w.Write(out.Bytes())
+	}
+}
+
+// indentWriter 各行の先頭にprefixを付けて書き込む
+type indentWriter struct {
+	w      io.Writer
+	prefix []byte
+	start  bool // 次の書き込みが行頭
+}
+
+func (iw *indentWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for 0 < len(p) {
+		if iw.start {
+			if _, err := iw.w.Write(iw.prefix); err != nil {
+				return 0, err
+			}
+			iw.start = false
+		}
+		line := p
+		if i := bytes.IndexByte(p, '\n'); 0 <= i {
+			line = p[:i+1]
+			iw.start = true
+		}
+		if _, err := iw.w.Write(line); err != nil {
+			return 0, err
+		}
+		p = p[len(line):]
+	}
+	return n, nil
+}
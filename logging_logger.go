@@ -0,0 +1,48 @@
+package glbr
+
+import (
+	"context"
+
+	"github.com/KawanoTakayuki/glbr/logger"
+)
+
+func init() {
+	logger.Register(func(c context.Context) logger.Logger {
+		if l, ok := contextLoggerOf(c); ok {
+			return l
+		}
+		return nil
+	})
+}
+
+// Logger ライブラリ向けの最小限のlogger
+// ライブラリはglbrに依存しないlogger.Loggerとlogger.FromContextOrNopを使う
+type Logger = logger.Logger
+
+// contextLogger cのグループ、TraceID、出力先に出力するLogger
+type contextLogger struct {
+	c context.Context
+}
+
+func (l contextLogger) Debugf(format string, value ...interface{})   { Debugf(l.c, format, value...) }
+func (l contextLogger) Infof(format string, value ...interface{})    { Infof(l.c, format, value...) }
+func (l contextLogger) Warningf(format string, value ...interface{}) { Warningf(l.c, format, value...) }
+func (l contextLogger) Errorf(format string, value ...interface{})   { Errorf(l.c, format, value...) }
+
+// contextLoggerOf cに設定されたserviceに出力するLogger
+// cがService.Context, GroupedByのcontextでない場合はfalse
+func contextLoggerOf(c context.Context) (Logger, bool) {
+	if noOpBuild {
+		return nil, false
+	}
+	if st, ok := getState(c); !ok || (st.logger == nil && len(st.mirrors) == 0) {
+		return nil, false
+	}
+	return contextLogger{c: c}, true
+}
+
+// FromContextOrNop cに設定されたserviceに出力するLogger
+// cがService.Context, GroupedByのcontextでない場合や、nilの場合は何も出力しないLoggerを返す
+func FromContextOrNop(c context.Context) Logger {
+	return logger.FromContextOrNop(c)
+}
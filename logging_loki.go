@@ -0,0 +1,121 @@
+package glbr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LokiOptions NewLokiSinkの設定
+type LokiOptions struct {
+	Labels       []string          // ストリームのラベルにするエントリのラベル。値の種類が少ないものに限る
+	StaticLabels map[string]string // 全てのストリームに付けるラベル(env, cluster等)
+	TenantID     string            // マルチテナントのLokiのX-Scope-OrgID
+	Interval     time.Duration     // 送信間隔 Default: 10秒
+	Client       *http.Client      // Default: http.DefaultClient
+}
+
+// NewLokiSink エントリをGrafana Lokiのpush API({url}/loki/api/v1/push)に送信するSink
+// GCP以外の環境でもGroupedBy等のAPIをそのまま使う場合に使う。行はSinkRecordのJSONで、
+// ストリームのラベルは log_id, severity とopts.Labelsで指定したエントリのラベル。ラベル名はlowercase_snakeに正規化される
+//
+//	log = log.AddSink(glbr.NewLokiSink("http://loki:3100", glbr.LokiOptions{Labels: []string{"tenant"}, StaticLabels: map[string]string{"env": "prod"}}), glbr.SinkFilter{})
+func NewLokiSink(url string, opts LokiOptions) Sink {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	endpoint := strings.TrimSuffix(url, "/") + "/loki/api/v1/push"
+	return newBatchSink("loki", opts.Interval, 1000, func(records []SinkRecord) error {
+		body, err := json.Marshal(lokiPush(records, opts))
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if opts.TenantID != "" {
+			req.Header.Set("X-Scope-OrgID", opts.TenantID)
+		}
+		return postSink(opts.Client, req)
+	})
+}
+
+// lokiStream pushリクエストのストリーム
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"` // [UNIX時刻(ナノ秒), 行]
+}
+
+// lokiPush エントリをラベルの組み合わせ毎のストリームにまとめる
+// ストリーム内の行は時刻順に並べる
+func lokiPush(records []SinkRecord, opts LokiOptions) map[string][]*lokiStream {
+	streams := map[string]*lokiStream{}
+	var order []string
+	for _, record := range records {
+		labels := map[string]string{}
+		for k, v := range opts.StaticLabels {
+			labels[bigQueryFieldName(k)] = v
+		}
+		for _, k := range opts.Labels {
+			if v, ok := record.Labels[k]; ok {
+				labels[bigQueryFieldName(k)] = v
+			}
+		}
+		labels["log_id"] = record.LogID
+		labels["severity"] = record.Severity
+		keys := sortedKeys(labels)
+		var key strings.Builder
+		for _, k := range keys {
+			fmt.Fprintf(&key, "%s=%q,", k, labels[k])
+		}
+		s, ok := streams[key.String()]
+		if !ok {
+			s = &lokiStream{Stream: labels}
+			streams[key.String()] = s
+			order = append(order, key.String())
+		}
+		line, _ := json.Marshal(record)
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(record.Timestamp.UnixNano(), 10), string(line)})
+	}
+	out := make([]*lokiStream, 0, len(order))
+	for _, key := range order {
+		s := streams[key]
+		sort.SliceStable(s.Values, func(i, j int) bool {
+			a, _ := strconv.ParseInt(s.Values[i][0], 10, 64)
+			b, _ := strconv.ParseInt(s.Values[j][0], 10, 64)
+			return a < b
+		})
+		out = append(out, s)
+	}
+	return map[string][]*lokiStream{"streams": out}
+}
+
+// postSink reqを送信し、2xx以外のレスポンスをエラーにする
+func postSink(client *http.Client, req *http.Request) error {
+	c, cancel := context.WithTimeout(req.Context(), 30*time.Second)
+	defer cancel()
+	res, err := client.Do(req.WithContext(c))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || 300 <= res.StatusCode {
+		b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%s: %s", res.Status, bytes.TrimSpace(b))
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	return nil
+}
@@ -0,0 +1,78 @@
+package glbr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestLokiSink(t *testing.T) {
+	var (
+		path, tenant, contentType string
+		push                      struct {
+			Streams []lokiStream `json:"streams"`
+		}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, tenant, contentType = r.URL.Path, r.Header.Get("X-Scope-OrgID"), r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink := NewLokiSink(srv.URL+"/", LokiOptions{Labels: []string{"tenantID"}, StaticLabels: map[string]string{"env": "prod"}, TenantID: "team-a", Interval: time.Hour})
+	ts := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	sink.Send("app", logging.Entry{Timestamp: ts.Add(time.Second), Severity: logging.Info, Payload: "second", Labels: map[string]string{"tenantID": "a", "user": "u1"}})
+	sink.Send("app", logging.Entry{Timestamp: ts, Severity: logging.Info, Payload: "first", Labels: map[string]string{"tenantID": "a"}})
+	sink.Send("app", logging.Entry{Timestamp: ts, Severity: logging.Error, Payload: "failed"})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/loki/api/v1/push" || tenant != "team-a" || contentType != "application/json" {
+		t.Errorf("request = %s X-Scope-OrgID=%s Content-Type=%s", path, tenant, contentType)
+	}
+	if len(push.Streams) != 2 {
+		t.Fatalf("streams = %+v, want 2", push.Streams)
+	}
+	info := push.Streams[0]
+	want := map[string]string{"env": "prod", "tenant_id": "a", "log_id": "app", "severity": "Info"}
+	for k, v := range want {
+		if info.Stream[k] != v {
+			t.Errorf("stream label %s = %q, want %q", k, info.Stream[k], v)
+		}
+	}
+	if _, ok := info.Stream["user"]; ok {
+		t.Error("label not listed in Labels became a stream label")
+	}
+	if len(info.Values) != 2 || info.Values[0][0] != "1714521600000000000" || !strings.Contains(info.Values[0][1], `"payload":"first"`) {
+		t.Errorf("values = %v, want ordered by time", info.Values)
+	}
+	var line SinkRecord
+	if err := json.Unmarshal([]byte(info.Values[1][1]), &line); err != nil || line.Labels["user"] != "u1" {
+		t.Errorf("line = %s (%v)", info.Values[1][1], err)
+	}
+	if errs := push.Streams[1]; errs.Stream["severity"] != "Error" || errs.Stream["tenant_id"] != "" {
+		t.Errorf("error stream = %v", errs.Stream)
+	}
+}
+
+func TestLokiSinkError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "entry too far behind", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	sink := NewLokiSink(srv.URL, LokiOptions{Interval: time.Hour})
+	sink.Send("app", logging.Entry{Timestamp: time.Now(), Payload: "old"})
+	if err := sink.Close(); err == nil || !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "entry too far behind") {
+		t.Errorf("Close = %v, want the response status and body", err)
+	}
+}
@@ -0,0 +1,64 @@
+package glbr
+
+import (
+	"context"
+	"net/http"
+)
+
+// Chain ミドルウェアを1つのGroupingHandlerにまとめる
+// 先頭のミドルウェアが最も外側になる。推奨する順序は Recover → GroupedBy → Timeout
+//
+//	handler := glbr.Chain(service.Recover(), service.GroupedBy("ParentLogID"), service.Timeout(time.Second))(mux)
+func Chain(middlewares ...GroupingHandler) GroupingHandler {
+	return func(next http.Handler) http.Handler {
+		for i := len(middlewares) - 1; 0 <= i; i-- {
+			if middlewares[i] != nil {
+				next = middlewares[i](next)
+			}
+		}
+		return next
+	}
+}
+
+// panicLogged Recoverの内側のGroupedByがpanicを記録したかどうか
+// panicは同じgoroutineで伝わるため、排他制御は不要
+type panicLogged struct {
+	logged bool
+}
+
+// markPanicLogged Recoverにpanicを記録済みであることを伝える
+func markPanicLogged(c context.Context) {
+	if p, ok := c.Value(&panicKey).(*panicLogged); ok {
+		p.logged = true
+	}
+}
+
+// Recover handlerのpanicを回復して500を返す
+// GroupedByの外側に置いた場合、panicはグループ内に記録された後に回復される
+// GroupedByは元のpanicの値のまま再panicするため、間に置いたミドルウェアも元の値を受け取る
+func (s Service) Recover() GroupingHandler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := &panicLogged{}
+			r = r.WithContext(context.WithValue(r.Context(), &panicKey, p))
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				if !p.logged {
+					c := r.Context()
+					if _, ok := getLogger(c); !ok {
+						c = s.Context()
+					}
+					logPanic(c, recovered)
+				}
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
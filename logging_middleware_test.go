@@ -0,0 +1,44 @@
+package glbr
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// GroupedByは元のpanicの値で再panicし、Recoverは記録済みのpanicを再び出力しない
+func TestRecoverLoggedPanic(t *testing.T) {
+	var buf bytes.Buffer
+	s, err := NewLocal("app", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen interface{}
+	observe := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				seen = recover()
+				panic(seen)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+	handler := Chain(s.Recover(), observe, s.GroupedBy("parent"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	s.Shutdown(context.Background())
+	if seen != "boom" {
+		t.Errorf("panic value = %#v, want \"boom\"", seen)
+	}
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d", w.Code)
+	}
+	if n := strings.Count(buf.String(), "panic: boom"); n != 1 {
+		t.Errorf("panic logged %d times, want 1", n)
+	}
+}
@@ -0,0 +1,28 @@
+package glbr
+
+import (
+	"context"
+
+	"cloud.google.com/go/logging"
+)
+
+// NewNoOp 何も出力しないserviceを取得する
+// APIはNewLoggingで取得したserviceと同じで、ログの呼び出しはEnabledの判定だけで返る。GroupedByはhandlerをそのまま返す
+// 性能を優先するビルドや、glbrへの対応を任意にしたいライブラリ向け
+//
+// glbr_noopタグを付けてビルドした場合は、NewLogging, NewLocal, NewAgentOutputもNoOpのserviceを返し、
+// Enabledは常にfalseになるため、ログの呼び出しはほぼ取り除かれる
+//
+//	go build -tags glbr_noop ./...
+func NewNoOp() Service {
+	service := Service{
+		ctx:     updateState(context.Background(), func(st *state) { st.noop = true }),
+		option:  make([]logging.LoggerOption, 0),
+		logID:   "noop",
+		loggers: newLoggerCache(),
+		closer:  &closer{done: make(chan struct{})},
+		usage:   newUsage(),
+		noop:    true,
+	}
+	return service
+}
@@ -0,0 +1,7 @@
+//go:build !glbr_noop
+// +build !glbr_noop
+
+package glbr
+
+// noOpBuild glbr_noopタグを付けてビルドした
+const noOpBuild = false
@@ -0,0 +1,174 @@
+package glbr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenSearchOptions NewOpenSearchSinkの設定
+type OpenSearchOptions struct {
+	IndexPrefix   string            // インデックス名の接頭辞。{IndexPrefix}-2006.01.02 (UTC)に書き込む Default: glbr
+	PayloadFields map[string]string // インデックステンプレートで型を固定するペイロードのフィールドと型(keyword, long, date等)
+	Username      string            // Basic認証
+	Password      string
+	Interval      time.Duration // 送信間隔 Default: 10秒
+	Client        *http.Client  // Default: http.DefaultClient
+}
+
+func (opts *OpenSearchOptions) defaults() {
+	if opts.IndexPrefix == "" {
+		opts.IndexPrefix = "glbr"
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+}
+
+// NewOpenSearchSink エントリをElasticsearch/OpenSearchのbulk API({url}/_bulk)で日毎のインデックスに書き込むSink
+// SIEMがOpenSearchにある場合に使う。ドキュメントはSinkRecordで、InsertIDがあれば_idにする。文字列のペイロードは{"message": ...}にする
+// インデックスのマッピングはPutOpenSearchIndexTemplateで事前に作成しておく
+//
+//	opts := glbr.OpenSearchOptions{IndexPrefix: "api", PayloadFields: map[string]string{"user_id": "keyword"}}
+//	glbr.PutOpenSearchIndexTemplate(c, "https://search:9200", opts)
+//	log = log.AddSink(glbr.NewOpenSearchSink("https://search:9200", opts), glbr.SinkFilter{MinSeverity: logging.Notice})
+func NewOpenSearchSink(url string, opts OpenSearchOptions) Sink {
+	opts.defaults()
+	endpoint := strings.TrimSuffix(url, "/") + "/_bulk"
+	return newBatchSink("opensearch", opts.Interval, 1000, func(records []SinkRecord) error {
+		var body bytes.Buffer
+		enc := json.NewEncoder(&body)
+		for _, record := range records {
+			action := map[string]string{"_index": opts.IndexPrefix + "-" + record.Timestamp.Format("2006.01.02")}
+			if record.InsertID != "" {
+				action["_id"] = record.InsertID
+			}
+			if err := enc.Encode(map[string]interface{}{"index": action}); err != nil {
+				return err
+			}
+			if message, ok := record.Payload.(string); ok {
+				record.Payload = map[string]string{"message": message} // マッピングをobjectに揃える
+			}
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+		req, err := http.NewRequest(http.MethodPost, endpoint, &body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		if opts.Username != "" {
+			req.SetBasicAuth(opts.Username, opts.Password)
+		}
+		return postBulk(opts.Client, req)
+	})
+}
+
+// postBulk bulk APIを呼び出し、失敗したドキュメントがあれば最初のエラーを返す
+func postBulk(client *http.Client, req *http.Request) error {
+	c, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	res, err := client.Do(req.WithContext(c))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || 300 <= res.StatusCode {
+		return fmt.Errorf("bulk: %s", res.Status)
+	}
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return fmt.Errorf("bulk: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	failed := 0
+	var first json.RawMessage
+	for _, item := range result.Items {
+		for _, r := range item {
+			if 300 <= r.Status {
+				failed++
+				if first == nil {
+					first = r.Error
+				}
+			}
+		}
+	}
+	return fmt.Errorf("bulk: %d of %d documents failed: %s", failed, len(result.Items), first)
+}
+
+// OpenSearchIndexTemplate {IndexPrefix}-* のインデックスに適用するインデックステンプレート
+// SinkRecordの各フィールドとopts.PayloadFieldsの型を指定する。ラベルはkeywordとして扱う
+func OpenSearchIndexTemplate(opts OpenSearchOptions) map[string]interface{} {
+	opts.defaults()
+	keyword := map[string]interface{}{"type": "keyword"}
+	payload := map[string]interface{}{"message": map[string]interface{}{"type": "text"}}
+	for name, typ := range opts.PayloadFields {
+		payload[name] = map[string]interface{}{"type": typ}
+	}
+	return map[string]interface{}{
+		"index_patterns": []string{opts.IndexPrefix + "-*"},
+		"template": map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"dynamic_templates": []interface{}{
+					map[string]interface{}{
+						"labels": map[string]interface{}{"path_match": "labels.*", "mapping": keyword},
+					},
+				},
+				"properties": map[string]interface{}{
+					"log_id":    keyword,
+					"timestamp": map[string]interface{}{"type": "date"},
+					"severity":  keyword,
+					"trace":     keyword,
+					"span_id":   keyword,
+					"insert_id": keyword,
+					"labels":    map[string]interface{}{"type": "object"},
+					"http_request": map[string]interface{}{"properties": map[string]interface{}{
+						"method":          keyword,
+						"url":             keyword,
+						"status":          map[string]interface{}{"type": "integer"},
+						"request_size":    map[string]interface{}{"type": "long"},
+						"response_size":   map[string]interface{}{"type": "long"},
+						"latency_seconds": map[string]interface{}{"type": "double"},
+						"remote_ip":       map[string]interface{}{"type": "ip"},
+						"user_agent":      map[string]interface{}{"type": "text"},
+					}},
+					"payload": map[string]interface{}{"type": "object", "properties": payload},
+				},
+			},
+		},
+	}
+}
+
+// PutOpenSearchIndexTemplate OpenSearchIndexTemplateを{url}/_index_template/{IndexPrefix}に作成または更新する
+func PutOpenSearchIndexTemplate(c context.Context, url string, opts OpenSearchOptions) error {
+	opts.defaults()
+	body, err := json.Marshal(OpenSearchIndexTemplate(opts))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, strings.TrimSuffix(url, "/")+"/_index_template/"+opts.IndexPrefix, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if opts.Username != "" {
+		req.SetBasicAuth(opts.Username, opts.Password)
+	}
+	return postSink(opts.Client, req.WithContext(c))
+}
@@ -0,0 +1,95 @@
+package glbr
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestOpenSearchSink(t *testing.T) {
+	var (
+		path, contentType, user, password string
+		lines                             []map[string]interface{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		user, password, _ = r.BasicAuth()
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var line map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Errorf("line %s: %v", scanner.Text(), err)
+			}
+			lines = append(lines, line)
+		}
+		w.Write([]byte(`{"errors": false, "items": []}`))
+	}))
+	defer srv.Close()
+
+	sink := NewOpenSearchSink(srv.URL, OpenSearchOptions{IndexPrefix: "api", Username: "glbr", Password: "secret", Interval: time.Hour})
+	ts := time.Date(2024, 5, 1, 23, 59, 0, 0, time.UTC)
+	sink.Send("app", logging.Entry{Timestamp: ts, Severity: logging.Info, Payload: "started", InsertID: "id-1"})
+	sink.Send("app", logging.Entry{Timestamp: ts.Add(time.Hour), Severity: logging.Error, Payload: map[string]interface{}{"user_id": "u1"}})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/_bulk" || contentType != "application/x-ndjson" || user != "glbr" || password != "secret" {
+		t.Errorf("request = %s Content-Type=%s auth=%s:%s", path, contentType, user, password)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("lines = %v, want 2 actions and 2 documents", lines)
+	}
+	first := lines[0]["index"].(map[string]interface{})
+	if first["_index"] != "api-2024.05.01" || first["_id"] != "id-1" {
+		t.Errorf("first action = %v", first)
+	}
+	if payload := lines[1]["payload"].(map[string]interface{}); payload["message"] != "started" || lines[1]["severity"] != "Info" {
+		t.Errorf("first document = %v, want the string payload as message", lines[1])
+	}
+	second := lines[2]["index"].(map[string]interface{})
+	if second["_index"] != "api-2024.05.02" {
+		t.Errorf("second index = %v, want the UTC day of the entry", second["_index"])
+	}
+	if _, ok := second["_id"]; ok {
+		t.Error("_id is set without InsertID")
+	}
+	if payload := lines[3]["payload"].(map[string]interface{}); payload["user_id"] != "u1" {
+		t.Errorf("second document = %v", lines[3])
+	}
+}
+
+func TestOpenSearchSinkError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"status", http.StatusServiceUnavailable, `{}`, "bulk: 503"},
+		{"document", http.StatusOK, `{"errors": true, "items": [{"index": {"status": 201}}, {"index": {"status": 400, "error": {"type": "mapper_parsing_exception"}}}]}`, "1 of 2 documents failed"},
+		{"malformed response", http.StatusOK, `not json`, "bulk: invalid character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			sink := NewOpenSearchSink(srv.URL, OpenSearchOptions{Interval: time.Hour})
+			sink.Send("app", logging.Entry{Timestamp: time.Now(), Payload: "a"})
+			sink.Send("app", logging.Entry{Timestamp: time.Now(), Payload: "b"})
+			if err := sink.Close(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Close = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
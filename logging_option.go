@@ -22,10 +22,15 @@ type Option interface {
 // Option log service option
 func (s Service) Option(opts ...Option) Service {
 	s.option = make([]logging.LoggerOption, 0)
+	s.resource = nil
+	s.loggers = newLoggerCache()
 	for _, opt := range opts {
 		if opt != nil {
 			s.option = append(s.option, opt.loggerOption())
 		}
+		if mr, ok := opt.(monitoredResourceOption); ok {
+			s.resource = mr.mr
+		}
 	}
 	return s
 }
@@ -66,9 +71,12 @@ func (o concurrentOption) loggerOption() logging.LoggerOption {
 	return logging.ConcurrentWriteLimit(int(o))
 }
 
-// WriteDelay ログエントリの遅延書き込み時間　Default: 1s
+// WriteDelay ログエントリの遅延書き込み時間(ナノ秒)　Default: 1s
 func WriteDelay(threshold int) Option { return writeDelayOption(threshold) }
 
+// DelayThreshold ログエントリの遅延書き込み時間　Default: 1s
+func DelayThreshold(threshold time.Duration) Option { return writeDelayOption(threshold) }
+
 type writeDelayOption time.Duration
 
 func (o writeDelayOption) loggerOption() logging.LoggerOption {
@@ -110,3 +118,32 @@ type bufferedByteLimitOption int
 func (o bufferedByteLimitOption) loggerOption() logging.LoggerOption {
 	return logging.BufferedByteLimit(int(o))
 }
+
+// WebServerOptions Webサーバー向けのバッファ設定
+// レスポンス毎の小さなエントリを低遅延で送信し、バッファの上限を抑える
+//
+//	DelayThreshold: 1s, EntryCount: 1000, EntryByteThreshold: 1MiB, BufferedByte: 256MiB, ConcurrentWrite: 4
+func WebServerOptions() []Option {
+	return []Option{
+		DelayThreshold(time.Second),
+		EntryCount(1000),
+		EntryByteThreshold(1 << 20),
+		BufferedByte(256 << 20),
+		ConcurrentWrite(4),
+	}
+}
+
+// BatchOptions バッチ処理向けのバッファ設定
+// 遅延を許容して大きな単位でまとめて送信する。EntryByteLimitはAPIのリクエスト上限(10MB)未満にする
+//
+//	DelayThreshold: 5s, EntryCount: 5000, EntryByteThreshold: 5MiB, EntryByteLimit: 9MiB, BufferedByte: 1GiB, ConcurrentWrite: 8
+func BatchOptions() []Option {
+	return []Option{
+		DelayThreshold(5 * time.Second),
+		EntryCount(5000),
+		EntryByteThreshold(5 << 20),
+		EntryByteLimit(9 << 20),
+		BufferedByte(1 << 30),
+		ConcurrentWrite(8),
+	}
+}
@@ -0,0 +1,237 @@
+package glbr
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+// otlpExportMethod OTLPのLogsService.Export
+const otlpExportMethod = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+
+// otlpScope OTLPのInstrumentationScopeの名前
+const otlpScope = "github.com/KawanoTakayuki/glbr"
+
+// NewOTLPSink エントリをOTLP/gRPCでOpenTelemetry Collectorにinterval毎に送信するSink
+// Collectorを経由してLokiやElastic等の任意のバックエンドに送る場合に使う。intervalが0以下の場合は1分
+// resourceはResourceの属性(service.name等)。ラベルはログレコードの属性に、logIDは glbr.log_id 属性になる。
+// connは呼び出し元で作成して閉じる
+//
+//	conn, err := grpc.Dial("otel-collector:4317", grpc.WithInsecure())
+//	log = log.AddSink(glbr.NewOTLPSink(conn, map[string]string{"service.name": "api"}, 10*time.Second), glbr.SinkFilter{})
+func NewOTLPSink(conn *grpc.ClientConn, resource map[string]string, interval time.Duration) Sink {
+	return newBatchSink("otlp", interval, 1000, func(records []SinkRecord) error {
+		c, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		req := otlpExportRequest(resource, records, time.Now())
+		var res []byte
+		return conn.Invoke(c, otlpExportMethod, &req, &res, grpc.ForceCodec(rawCodec{}))
+	})
+}
+
+// rawCodec エンコード済みのprotobufをそのまま送受信するcodec
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) { return *v.(*[]byte), nil }
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+func (rawCodec) Name() string { return "proto" }
+
+// pbWriter protobufのフィールドを書き込む
+type pbWriter struct {
+	proto.Buffer
+}
+
+func (w *pbWriter) tag(field, wireType int) {
+	w.EncodeVarint(uint64(field<<3 | wireType))
+}
+
+func (w *pbWriter) varint(field int, v uint64) {
+	w.tag(field, 0)
+	w.EncodeVarint(v)
+}
+
+func (w *pbWriter) fixed64(field int, v uint64) {
+	w.tag(field, 1)
+	w.EncodeFixed64(v)
+}
+
+func (w *pbWriter) bytes(field int, b []byte) {
+	w.tag(field, 2)
+	w.EncodeRawBytes(b)
+}
+
+func (w *pbWriter) str(field int, s string) {
+	if s != "" {
+		w.tag(field, 2)
+		w.EncodeStringBytes(s)
+	}
+}
+
+// otlpExportRequest ExportLogsServiceRequestをエンコードする
+func otlpExportRequest(resource map[string]string, records []SinkRecord, observed time.Time) []byte {
+	var res pbWriter // Resource
+	for _, k := range sortedKeys(resource) {
+		res.bytes(1, otlpKeyValue(k, resource[k]))
+	}
+	var scope pbWriter // InstrumentationScope
+	scope.str(1, otlpScope)
+	var scopeLogs pbWriter // ScopeLogs
+	scopeLogs.bytes(1, scope.Bytes())
+	for _, record := range records {
+		scopeLogs.bytes(2, otlpLogRecord(record, observed))
+	}
+	var resourceLogs pbWriter // ResourceLogs
+	resourceLogs.bytes(1, res.Bytes())
+	resourceLogs.bytes(2, scopeLogs.Bytes())
+	var req pbWriter // ExportLogsServiceRequest
+	req.bytes(1, resourceLogs.Bytes())
+	return req.Bytes()
+}
+
+// otlpLogRecord LogRecordをエンコードする
+func otlpLogRecord(record SinkRecord, observed time.Time) []byte {
+	var w pbWriter
+	w.fixed64(1, uint64(record.Timestamp.UnixNano()))
+	severity := logging.ParseSeverity(record.Severity)
+	w.varint(2, otlpSeverityNumber(severity))
+	w.str(3, record.Severity)
+	if record.Payload != nil {
+		w.bytes(5, otlpAnyValue(jsonValue(record.Payload)))
+	}
+	attrs := map[string]string{"glbr.log_id": record.LogID}
+	for k, v := range record.Labels {
+		attrs[k] = v
+	}
+	if h := record.HTTPRequest; h != nil {
+		attrs["http.request.method"] = h.Method
+		attrs["url.full"] = h.URL
+		attrs["http.response.status_code"] = strconv.Itoa(h.Status)
+		attrs["glbr.latency_seconds"] = strconv.FormatFloat(h.Latency, 'f', -1, 64)
+		if h.RemoteIP != "" {
+			attrs["client.address"] = h.RemoteIP
+		}
+		if h.UserAgent != "" {
+			attrs["user_agent.original"] = h.UserAgent
+		}
+	}
+	for _, k := range sortedKeys(attrs) {
+		w.bytes(6, otlpKeyValue(k, attrs[k]))
+	}
+	if traceID, err := hex.DecodeString(spanTraceID(record.Trace)); err == nil && len(traceID) == 16 {
+		w.bytes(9, traceID)
+	}
+	if spanID, err := hex.DecodeString(record.SpanID); err == nil && len(spanID) == 8 {
+		w.bytes(10, spanID)
+	}
+	w.fixed64(11, uint64(observed.UnixNano()))
+	return w.Bytes()
+}
+
+// otlpSeverityNumber Cloud LoggingのseverityをOTLPのSeverityNumberにする
+func otlpSeverityNumber(severity logging.Severity) uint64 {
+	switch {
+	case logging.Emergency <= severity:
+		return 24 // FATAL4
+	case logging.Alert <= severity:
+		return 22 // FATAL2
+	case logging.Critical <= severity:
+		return 21 // FATAL
+	case logging.Error <= severity:
+		return 17 // ERROR
+	case logging.Warning <= severity:
+		return 13 // WARN
+	case logging.Notice <= severity:
+		return 10 // INFO2
+	case logging.Info <= severity:
+		return 9 // INFO
+	case logging.Debug <= severity:
+		return 5 // DEBUG
+	default:
+		return 0 // UNSPECIFIED
+	}
+}
+
+// otlpKeyValue 文字列の値のKeyValueをエンコードする
+func otlpKeyValue(key string, value interface{}) []byte {
+	var w pbWriter
+	w.str(1, key)
+	w.bytes(2, otlpAnyValue(value))
+	return w.Bytes()
+}
+
+// otlpAnyValue JSONの値をAnyValueとしてエンコードする
+func otlpAnyValue(v interface{}) []byte {
+	var w pbWriter
+	switch v := v.(type) {
+	case string:
+		w.tag(1, 2)
+		w.EncodeStringBytes(v)
+	case bool:
+		b := uint64(0)
+		if v {
+			b = 1
+		}
+		w.varint(2, b)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			w.varint(3, uint64(int64(v)))
+		} else {
+			w.fixed64(4, math.Float64bits(v))
+		}
+	case []interface{}:
+		var array pbWriter // ArrayValue
+		for _, child := range v {
+			array.bytes(1, otlpAnyValue(child))
+		}
+		w.bytes(5, array.Bytes())
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var list pbWriter // KeyValueList
+		for _, k := range keys {
+			list.bytes(1, otlpKeyValue(k, v[k]))
+		}
+		w.bytes(6, list.Bytes())
+	}
+	return w.Bytes()
+}
+
+// jsonValue 値をJSONで表現した時の値(map[string]interface{}, []interface{}, string, float64, bool, nil)にする
+func jsonValue(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return payloadText(v)
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return string(b)
+	}
+	return out
+}
+
+// sortedKeys mapのキーを昇順で返す
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
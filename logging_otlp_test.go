@@ -0,0 +1,232 @@
+package glbr
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/golang/protobuf/proto"
+)
+
+// opentelemetry-protoのlogs/v1, common/v1, resource/v1, collector/logs/v1をprotoc-gen-goの形式で写したもの
+// AnyValueのoneofはワイヤー形式が同じ通常のフィールドで表す
+
+type otlpExportLogsServiceRequest struct {
+	ResourceLogs []*otlpResourceLogs `protobuf:"bytes,1,rep,name=resource_logs,proto3"`
+}
+
+type otlpResourceLogs struct {
+	Resource  *otlpResource    `protobuf:"bytes,1,opt,name=resource,proto3"`
+	ScopeLogs []*otlpScopeLogs `protobuf:"bytes,2,rep,name=scope_logs,proto3"`
+	SchemaUrl string           `protobuf:"bytes,3,opt,name=schema_url,proto3"`
+}
+
+type otlpResource struct {
+	Attributes             []*otlpKeyValueMsg `protobuf:"bytes,1,rep,name=attributes,proto3"`
+	DroppedAttributesCount uint32             `protobuf:"varint,2,opt,name=dropped_attributes_count,proto3"`
+}
+
+type otlpScopeLogs struct {
+	Scope      *otlpInstrumentationScope `protobuf:"bytes,1,opt,name=scope,proto3"`
+	LogRecords []*otlpLogRecordMsg       `protobuf:"bytes,2,rep,name=log_records,proto3"`
+}
+
+type otlpInstrumentationScope struct {
+	Name    string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Version string `protobuf:"bytes,2,opt,name=version,proto3"`
+}
+
+type otlpLogRecordMsg struct {
+	TimeUnixNano         uint64             `protobuf:"fixed64,1,opt,name=time_unix_nano,proto3"`
+	SeverityNumber       int32              `protobuf:"varint,2,opt,name=severity_number,proto3"`
+	SeverityText         string             `protobuf:"bytes,3,opt,name=severity_text,proto3"`
+	Body                 *otlpAnyValueMsg   `protobuf:"bytes,5,opt,name=body,proto3"`
+	Attributes           []*otlpKeyValueMsg `protobuf:"bytes,6,rep,name=attributes,proto3"`
+	Flags                uint32             `protobuf:"fixed32,8,opt,name=flags,proto3"`
+	TraceId              []byte             `protobuf:"bytes,9,opt,name=trace_id,proto3"`
+	SpanId               []byte             `protobuf:"bytes,10,opt,name=span_id,proto3"`
+	ObservedTimeUnixNano uint64             `protobuf:"fixed64,11,opt,name=observed_time_unix_nano,proto3"`
+}
+
+type otlpKeyValueMsg struct {
+	Key   string           `protobuf:"bytes,1,opt,name=key,proto3"`
+	Value *otlpAnyValueMsg `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+type otlpAnyValueMsg struct {
+	StringValue string            `protobuf:"bytes,1,opt,name=string_value,proto3"`
+	BoolValue   bool              `protobuf:"varint,2,opt,name=bool_value,proto3"`
+	IntValue    int64             `protobuf:"varint,3,opt,name=int_value,proto3"`
+	DoubleValue float64           `protobuf:"fixed64,4,opt,name=double_value,proto3"`
+	ArrayValue  *otlpArrayValue   `protobuf:"bytes,5,opt,name=array_value,proto3"`
+	KvlistValue *otlpKeyValueList `protobuf:"bytes,6,opt,name=kvlist_value,proto3"`
+	BytesValue  []byte            `protobuf:"bytes,7,opt,name=bytes_value,proto3"`
+}
+
+type otlpArrayValue struct {
+	Values []*otlpAnyValueMsg `protobuf:"bytes,1,rep,name=values,proto3"`
+}
+
+type otlpKeyValueList struct {
+	Values []*otlpKeyValueMsg `protobuf:"bytes,1,rep,name=values,proto3"`
+}
+
+func (m *otlpExportLogsServiceRequest) Reset()         { *m = otlpExportLogsServiceRequest{} }
+func (m *otlpExportLogsServiceRequest) String() string { return proto.CompactTextString(m) }
+func (*otlpExportLogsServiceRequest) ProtoMessage()    {}
+func (m *otlpResourceLogs) Reset()                     { *m = otlpResourceLogs{} }
+func (m *otlpResourceLogs) String() string             { return proto.CompactTextString(m) }
+func (*otlpResourceLogs) ProtoMessage()                {}
+func (m *otlpResource) Reset()                         { *m = otlpResource{} }
+func (m *otlpResource) String() string                 { return proto.CompactTextString(m) }
+func (*otlpResource) ProtoMessage()                    {}
+func (m *otlpScopeLogs) Reset()                        { *m = otlpScopeLogs{} }
+func (m *otlpScopeLogs) String() string                { return proto.CompactTextString(m) }
+func (*otlpScopeLogs) ProtoMessage()                   {}
+func (m *otlpInstrumentationScope) Reset()             { *m = otlpInstrumentationScope{} }
+func (m *otlpInstrumentationScope) String() string     { return proto.CompactTextString(m) }
+func (*otlpInstrumentationScope) ProtoMessage()        {}
+func (m *otlpLogRecordMsg) Reset()                     { *m = otlpLogRecordMsg{} }
+func (m *otlpLogRecordMsg) String() string             { return proto.CompactTextString(m) }
+func (*otlpLogRecordMsg) ProtoMessage()                {}
+func (m *otlpKeyValueMsg) Reset()                      { *m = otlpKeyValueMsg{} }
+func (m *otlpKeyValueMsg) String() string              { return proto.CompactTextString(m) }
+func (*otlpKeyValueMsg) ProtoMessage()                 {}
+func (m *otlpAnyValueMsg) Reset()                      { *m = otlpAnyValueMsg{} }
+func (m *otlpAnyValueMsg) String() string              { return proto.CompactTextString(m) }
+func (*otlpAnyValueMsg) ProtoMessage()                 {}
+func (m *otlpArrayValue) Reset()                       { *m = otlpArrayValue{} }
+func (m *otlpArrayValue) String() string               { return proto.CompactTextString(m) }
+func (*otlpArrayValue) ProtoMessage()                  {}
+func (m *otlpKeyValueList) Reset()                     { *m = otlpKeyValueList{} }
+func (m *otlpKeyValueList) String() string             { return proto.CompactTextString(m) }
+func (*otlpKeyValueList) ProtoMessage()                {}
+
+// attributes KeyValueを文字列のmapにする
+func (m *otlpLogRecordMsg) attributes() map[string]string {
+	attrs := map[string]string{}
+	for _, kv := range m.Attributes {
+		attrs[kv.Key] = kv.Value.StringValue
+	}
+	return attrs
+}
+
+// エンコードしたExportLogsServiceRequestをOTLPのメッセージとしてデコードできる
+func TestOTLPExportRequestRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 30, 45, 123456789, time.UTC)
+	observed := ts.Add(time.Second)
+	records := []SinkRecord{
+		{
+			LogID:     "app",
+			Timestamp: ts,
+			Severity:  logging.Error.String(),
+			Payload: map[string]interface{}{
+				"message": "failed",
+				"count":   3,
+				"ratio":   1.5,
+				"ok":      false,
+				"tags":    []string{"a", "b"},
+			},
+			Trace:  "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+			SpanID: "00f067aa0ba902b7",
+			Labels: map[string]string{"version": "v1"},
+			HTTPRequest: &SinkHTTPRequest{
+				Method:    "GET",
+				URL:       "https://example.com/",
+				Status:    500,
+				Latency:   0.25,
+				RemoteIP:  "198.51.100.7",
+				UserAgent: "test",
+			},
+		},
+		{LogID: "app", Timestamp: ts, Severity: logging.Debug.String(), Payload: "text"},
+	}
+	var req otlpExportLogsServiceRequest
+	if err := proto.Unmarshal(otlpExportRequest(map[string]string{"service.name": "api"}, records, observed), &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.ResourceLogs) != 1 || len(req.ResourceLogs[0].ScopeLogs) != 1 {
+		t.Fatalf("request = %v", req.String())
+	}
+	resource := req.ResourceLogs[0].Resource
+	if len(resource.Attributes) != 1 || resource.Attributes[0].Key != "service.name" || resource.Attributes[0].Value.StringValue != "api" {
+		t.Errorf("resource = %v", resource)
+	}
+	scope := req.ResourceLogs[0].ScopeLogs[0]
+	if scope.Scope.Name != otlpScope {
+		t.Errorf("scope = %v", scope.Scope)
+	}
+	if len(scope.LogRecords) != 2 {
+		t.Fatalf("log records = %d, want 2", len(scope.LogRecords))
+	}
+
+	first := scope.LogRecords[0]
+	if first.TimeUnixNano != uint64(ts.UnixNano()) || first.ObservedTimeUnixNano != uint64(observed.UnixNano()) {
+		t.Errorf("timestamps = %d, %d", first.TimeUnixNano, first.ObservedTimeUnixNano)
+	}
+	if first.SeverityNumber != 17 || first.SeverityText != "Error" {
+		t.Errorf("severity = %d %s, want 17 Error", first.SeverityNumber, first.SeverityText)
+	}
+	wantAttrs := map[string]string{
+		"glbr.log_id":               "app",
+		"version":                   "v1",
+		"http.request.method":       "GET",
+		"url.full":                  "https://example.com/",
+		"http.response.status_code": "500",
+		"glbr.latency_seconds":      "0.25",
+		"client.address":            "198.51.100.7",
+		"user_agent.original":       "test",
+	}
+	if got := first.attributes(); !reflect.DeepEqual(got, wantAttrs) {
+		t.Errorf("attributes = %v, want %v", got, wantAttrs)
+	}
+	if got := hex.EncodeToString(first.TraceId); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace_id = %s", got)
+	}
+	if got := hex.EncodeToString(first.SpanId); got != "00f067aa0ba902b7" {
+		t.Errorf("span_id = %s", got)
+	}
+	body := map[string]*otlpAnyValueMsg{}
+	if first.Body.KvlistValue == nil {
+		t.Fatalf("body = %v", first.Body)
+	}
+	for _, kv := range first.Body.KvlistValue.Values {
+		body[kv.Key] = kv.Value
+	}
+	if body["message"].StringValue != "failed" || body["count"].IntValue != 3 || body["ratio"].DoubleValue != 1.5 || body["ok"] == nil || body["ok"].BoolValue {
+		t.Errorf("body = %v", first.Body)
+	}
+	if tags := body["tags"].ArrayValue; tags == nil || len(tags.Values) != 2 || tags.Values[1].StringValue != "b" {
+		t.Errorf("tags = %v", body["tags"])
+	}
+
+	second := scope.LogRecords[1]
+	if second.SeverityNumber != 5 || second.Body.StringValue != "text" || second.TraceId != nil || second.SpanId != nil {
+		t.Errorf("second = %v", second)
+	}
+}
+
+func TestOTLPSeverityNumber(t *testing.T) {
+	tests := []struct {
+		severity logging.Severity
+		want     uint64
+	}{
+		{logging.Default, 0},
+		{logging.Debug, 5},
+		{logging.Info, 9},
+		{logging.Notice, 10},
+		{logging.Warning, 13},
+		{logging.Error, 17},
+		{logging.Critical, 21},
+		{logging.Alert, 22},
+		{logging.Emergency, 24},
+		{logging.Emergency + 100, 24},
+	}
+	for _, tt := range tests {
+		if got := otlpSeverityNumber(tt.severity); got != tt.want {
+			t.Errorf("otlpSeverityNumber(%v) = %d, want %d", tt.severity, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package glbr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+
+	"cloud.google.com/go/logging"
+)
+
+// panicRecord panicのペイロード
+type panicRecord struct {
+	Type       string      `json:"type"`
+	Value      interface{} `json:"value,omitempty"`
+	ErrorChain []string    `json:"error_chain,omitempty"`
+	Goroutines string      `json:"goroutines,omitempty"`
+}
+
+// WithPanicGoroutineDump panicの記録に全てのgoroutineのスタックを含める
+func (s Service) WithPanicGoroutineDump() Service {
+	s.ctx = updateState(s.ctx, func(st *state) { st.panicDump = true })
+	return s
+}
+
+// logPanic panicをCriticalで出力する
+// {"message": "panic: ...\n{stack}", "panic": {"type", "value", "error_chain", "goroutines"}}として出力する。
+// messageはError Reportingで集計できる形式のまま残す
+func logPanic(c context.Context, recovered interface{}) {
+	record := panicRecord{Type: fmt.Sprintf("%T", recovered), Value: panicValue(recovered)}
+	if err, ok := recovered.(error); ok {
+		for ; err != nil; err = errors.Unwrap(err) {
+			record.ErrorChain = append(record.ErrorChain, err.Error())
+		}
+	}
+	if st, _ := getState(c); st.panicDump {
+		record.Goroutines = goroutines(0)
+	}
+	sendPayload(c, logging.Critical, versioned(map[string]interface{}{
+		"message": fmt.Sprintf("panic: %v\n%s", recovered, debug.Stack()),
+		"panic":   record,
+	}), nil)
+}
+
+// panicValue panicの値を構造のまま出力できる形にする
+// error, fmt.Stringerは文字列、構造体やmapはJSONに変換できる場合はそのまま、できない場合は%+vの文字列にする
+func panicValue(recovered interface{}) interface{} {
+	switch v := recovered.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	}
+	switch reflect.Indirect(reflect.ValueOf(recovered)).Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		if _, err := json.Marshal(recovered); err == nil {
+			return recovered
+		}
+	}
+	return fmt.Sprintf("%+v", recovered)
+}
+
+// goroutines 全てのgoroutineのスタック
+// limitが0より大きい場合はlimitバイトまでにする
+func goroutines(limit int) string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || (0 < limit && limit <= len(buf)) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	if 0 < limit && limit < len(buf) {
+		buf = buf[:limit]
+	}
+	return string(buf)
+}
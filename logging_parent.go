@@ -0,0 +1,41 @@
+package glbr
+
+import (
+	"strings"
+)
+
+// Folder フォルダをNewLoggingの書き込み先にする
+// 組織全体のログを集約する構成で使う
+//
+//	log, err := glbr.NewLogging(glbr.Folder("123456789"), "LogID")
+func Folder(folderID string) string {
+	return "folders/" + folderID
+}
+
+// Organization 組織をNewLoggingの書き込み先にする
+func Organization(organizationID string) string {
+	return "organizations/" + organizationID
+}
+
+// BillingAccount 請求先アカウントをNewLoggingの書き込み先にする
+func BillingAccount(billingAccountID string) string {
+	return "billingAccounts/" + billingAccountID
+}
+
+// logParent 書き込み先のリソース名
+// projectIDのみの場合はprojects/{projectID}とする
+func logParent(parent string) string {
+	if !strings.ContainsRune(parent, '/') {
+		return "projects/" + parent
+	}
+	return parent
+}
+
+// parentProject 書き込み先がプロジェクトの場合はprojectIDを返す
+func parentProject(parent string) (string, bool) {
+	parent = logParent(parent)
+	if !strings.HasPrefix(parent, "projects/") {
+		return "", false
+	}
+	return strings.TrimPrefix(parent, "projects/"), true
+}
@@ -0,0 +1,68 @@
+package glbr
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// progress 進捗の出力間隔
+type progress struct {
+	interval time.Duration
+	percent  float64
+	start    time.Time
+
+	mu          sync.Mutex
+	lastTime    time.Time
+	lastPercent float64
+}
+
+// WithProgress Progressの出力間隔を指定する
+// 前回の出力からinterval以上経過したか、percent以上進んだ場合に出力する
+func WithProgress(c context.Context, interval time.Duration, percent float64) context.Context {
+	return setProgress(c, &progress{interval: interval, percent: percent, start: clockFrom(c).Now()})
+}
+
+// allow 出力するかどうか
+func (p *progress) allow(now time.Time, percent float64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.lastTime.IsZero() &&
+		(p.interval <= 0 || now.Sub(p.lastTime) < p.interval) &&
+		(p.percent <= 0 || percent-p.lastPercent < p.percent) {
+		return false
+	}
+	p.lastTime = now
+	p.lastPercent = percent
+	return true
+}
+
+// progressRecord 進捗のペイロード
+type progressRecord struct {
+	Done    int64   `json:"done"`
+	Total   int64   `json:"total"`
+	Percent float64 `json:"percent"`
+	Elapsed string  `json:"elapsed,omitempty"`
+}
+
+// Progress バッチ処理の進捗をInfoで出力する
+// WithProgressで指定した間隔で間引かれる。指定がない場合は開始と完了のみ出力する
+func Progress(c context.Context, done, total int64) {
+	record := progressRecord{Done: done, Total: total}
+	if 0 < total {
+		record.Percent = float64(done) * 100 / float64(total)
+	}
+	finished := done == total
+	if p, ok := getProgress(c); ok {
+		now := clockFrom(c).Now()
+		if !finished && !p.allow(now, record.Percent) {
+			return
+		}
+		record.Elapsed = now.Sub(p.start).String()
+	} else if done != 0 && !finished {
+		return
+	}
+	sendPayload(c, logging.Info, versioned(map[string]interface{}{"progress": record}), nil)
+}
@@ -0,0 +1,79 @@
+package glbr
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"cloud.google.com/go/logging"
+	"google.golang.org/api/option"
+)
+
+// projectPool プロジェクト毎のクライアント
+// NewLoggingのプロジェクト以外のクライアントは初回の書き込み時に作成し、serviceと同時に閉じる
+type projectPool struct {
+	defaultID string
+	opts      []option.ClientOption
+
+	mu      sync.Mutex
+	clients map[string]*logging.Client
+}
+
+func newProjectPool(defaultID string, opts []option.ClientOption) *projectPool {
+	return &projectPool{defaultID: defaultID, opts: opts, clients: map[string]*logging.Client{}}
+}
+
+// client projectIDのクライアントを返す
+func (p *projectPool) client(projectID string) (*logging.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if client, ok := p.clients[projectID]; ok {
+		return client, nil
+	}
+	client, err := logging.NewClient(context.Background(), projectID, p.opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.clients[projectID] = client
+	return client, nil
+}
+
+// close 作成したクライアントを閉じる
+func (p *projectPool) close() error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	for _, client := range p.clients {
+		if cerr := client.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// ForProject cで出力するエントリをprojectIDのプロジェクトに書き込む
+// テナント毎のプロジェクトに振り分ける場合に使う。クライアントは初回の書き込み時に作成され、serviceのCloseで閉じられる
+//
+//	glbr.Infof(glbr.ForProject(c, tenant.ProjectID), "tenant log")
+func ForProject(c context.Context, projectID string) context.Context {
+	if c == nil {
+		panic(ErrNilContext)
+	}
+	st, _ := getState(c)
+	if st.projects == nil {
+		return c
+	}
+	return setLogger(c, st.projects(projectID))
+}
+
+// WithProjectSelector グループの親エントリと子エントリを書き込むプロジェクトをリクエスト毎に選択する
+// selectorが空文字を返した場合はNewLoggingのプロジェクトに書き込む
+//
+//	log = log.WithProjectSelector(func(r *http.Request) string { return tenantProject(r.Host) })
+func (s Service) WithProjectSelector(selector func(r *http.Request) string) Service {
+	s.projectSelector = selector
+	return s
+}
@@ -0,0 +1,118 @@
+package glbr
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	"cloud.google.com/go/logging"
+	vkit "cloud.google.com/go/logging/apiv2"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/api/option"
+	"google.golang.org/genproto/googleapis/api/monitoredres"
+	logtypepb "google.golang.org/genproto/googleapis/logging/type"
+	logpb "google.golang.org/genproto/googleapis/logging/v2"
+)
+
+// protoClient ProtoPayloadを書き込むためのクライアント
+// logging.EntryはProtoPayloadに対応していないため、APIを直接呼び出す。初回の書き込み時に接続する
+type protoClient struct {
+	projectID string
+	opts      []option.ClientOption
+
+	once   sync.Once
+	client *vkit.Client
+	err    error
+}
+
+func newProtoClient(projectID string, opts []option.ClientOption) *protoClient {
+	return &protoClient{projectID: projectID, opts: opts}
+}
+
+func (p *protoClient) connect(c context.Context) (*vkit.Client, error) {
+	p.once.Do(func() {
+		p.client, p.err = vkit.NewClient(c, p.opts...)
+	})
+	return p.client, p.err
+}
+
+func (p *protoClient) close() error {
+	if p == nil {
+		return nil
+	}
+	var err error
+	p.once.Do(func() {}) // 以降は接続しない
+	if p.client != nil {
+		err = p.client.Close()
+	}
+	return err
+}
+
+// protoLogger logIDに対してProtoPayloadのエントリを書き込む
+type protoLogger struct {
+	client   *protoClient
+	logID    string
+	resource *monitoredres.MonitoredResource
+}
+
+// log ProtoPayloadのエントリを同期的に書き込む
+func (l protoLogger) log(c context.Context, severity logging.Severity, msg proto.Message) error {
+	payload, err := ptypes.MarshalAny(msg)
+	if err != nil {
+		return err
+	}
+	if l.client == nil {
+		return nil // NewLocal
+	}
+	client, err := l.client.connect(c)
+	if err != nil {
+		return err
+	}
+	ts, err := ptypes.TimestampProto(clockFrom(c).Now())
+	if err != nil {
+		return err
+	}
+	entry := &logpb.LogEntry{
+		Payload:   &logpb.LogEntry_ProtoPayload{ProtoPayload: payload},
+		Severity:  logtypepb.LogSeverity(severity),
+		Timestamp: ts,
+	}
+	if traceID, ok := getTraceID(c); ok {
+		entry.Trace = *traceID
+	}
+	if st, _ := getState(c); st.span != nil {
+		entry.SpanId = st.span.id
+		entry.TraceSampled = st.span.sampled
+	}
+	resource := l.resource
+	if resource == nil {
+		resource = &monitoredres.MonitoredResource{Type: "global"}
+		if projectID, ok := parentProject(l.client.projectID); ok {
+			resource.Labels = map[string]string{"project_id": projectID}
+		}
+	}
+	_, err = client.WriteLogEntries(c, &logpb.WriteLogEntriesRequest{
+		LogName:  logParent(l.client.projectID) + "/logs/" + url.PathEscape(l.logID),
+		Resource: resource,
+		Entries:  []*logpb.LogEntry{entry},
+	})
+	return err
+}
+
+// Proto protobufのメッセージをProtoPayloadとして出力する
+// メッセージの型URLはtype.googleapis.com/{メッセージ名}として保持される。書き込みは同期的に行われる
+func Proto(c context.Context, severity logging.Severity, msg proto.Message) error {
+	l, ok := getProtoLogger(c)
+	if !ok {
+		return ErrLoggerNotFound
+	}
+	if msg == nil {
+		return ErrNilPayload
+	}
+	if g, ok := getGroup(c); ok {
+		g.raise(severity)
+		g.observe(severity, nil)
+	}
+	return l.log(c, severity, msg)
+}
@@ -0,0 +1,49 @@
+package glbr
+
+import (
+	"net/http"
+	"net/http/httputil"
+)
+
+// upstreamTransport 上流へのリクエストをグループに記録する
+type upstreamTransport struct {
+	base http.RoundTripper
+}
+
+func (t upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := req.Context()
+	Annotate(c, "upstream", req.URL.Host)
+	clock := clockFrom(c)
+	st := clock.Now()
+	res, err := t.base.RoundTrip(req)
+	latency := clock.Since(st)
+	Annotate(c, "upstream_latency", latency.String())
+	if err != nil {
+		return nil, err
+	}
+	Infof(c, "upstream %s %s %d %s", req.Method, req.URL, res.StatusCode, latency)
+	return res, nil
+}
+
+// ReverseProxy ReverseProxyの上流へのリクエストをグループに記録するよう設定する
+// 親エントリには上流のホスト(upstream)と上流のレイテンシ(upstream_latency)がラベルとして付加され、
+// 上流のエラーはErrorで出力して502を返す。GroupedByの内側で使う
+func ReverseProxy(proxy *httputil.ReverseProxy) *httputil.ReverseProxy {
+	base := proxy.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	proxy.Transport = upstreamTransport{base: base}
+	handler := proxy.ErrorHandler
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		c := r.Context()
+		Annotate(c, "upstream_error", err.Error())
+		Errorf(c, "upstream error: %v", err)
+		if handler != nil {
+			handler(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	return proxy
+}
@@ -0,0 +1,53 @@
+package glbr
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"cloud.google.com/go/logging"
+	"cloud.google.com/go/pubsub"
+)
+
+// pubsubSink Pub/SubのトピックにエントリをPublishするSink
+type pubsubSink struct {
+	topic *pubsub.Topic
+}
+
+// NewPubSubSink エントリをSinkRecordのJSONとしてtopicにPublishするSink
+// ログルーターを経由せずにセキュリティイベントをリアルタイムの処理に流す場合に使う。
+// メッセージの属性には log_id, severity, trace が付く。Publishの失敗は標準のloggerに出力する
+//
+//	topic := client.Topic("security-events")
+//	log = log.AddSink(glbr.NewPubSubSink(topic), glbr.SinkFilter{MinSeverity: logging.Warning, Labels: map[string]string{"category": "security"}})
+func NewPubSubSink(topic *pubsub.Topic) Sink {
+	return &pubsubSink{topic: topic}
+}
+
+func (s *pubsubSink) Send(logID string, entry logging.Entry) {
+	data, err := json.Marshal(NewSinkRecord(logID, entry))
+	if err != nil {
+		log.Printf("glbr: pubsub sink: %v", err)
+		return
+	}
+	c := context.Background()
+	result := s.topic.Publish(c, &pubsub.Message{
+		Data: data,
+		Attributes: map[string]string{
+			"log_id":   logID,
+			"severity": entry.Severity.String(),
+			"trace":    entry.Trace,
+		},
+	})
+	go func() {
+		if _, err := result.Get(c); err != nil {
+			log.Printf("glbr: pubsub sink: %v", err)
+		}
+	}()
+}
+
+// Close Publish中のメッセージの送信を待ってトピックを止める
+func (s *pubsubSink) Close() error {
+	s.topic.Stop()
+	return nil
+}
@@ -0,0 +1,119 @@
+package glbr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// WithRateLimit severity毎に1秒あたりに出力するエントリ数を制限する
+// 指定されていないseverityは無制限。制限により破棄されたエントリ数は、次に出力できた時にWarningで報告される
+func (s Service) WithRateLimit(perSecond map[logging.Severity]float64) Service {
+	l := &rateLimiter{buckets: map[logging.Severity]*bucket{}}
+	for severity, rate := range perSecond {
+		if 0 < rate {
+			l.buckets[severity] = newBucket(rate)
+		}
+	}
+	s.ctx = setRateLimiter(s.ctx, l)
+	return s
+}
+
+// bucket トークンバケット
+// 容量はrateと1の大きい方。1未満のrateでも1件は出力できる
+type bucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+	dropped  int
+}
+
+func newBucket(rate float64) *bucket {
+	capacity := math.Max(rate, 1)
+	return &bucket{rate: rate, capacity: capacity, tokens: capacity}
+}
+
+// take トークンを取得する。取得できた場合はそれまでに破棄されたエントリ数を返す
+func (b *bucket) take(now time.Time) (ok bool, dropped int) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.capacity < b.tokens {
+			b.tokens = b.capacity
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		b.dropped++
+		return false, 0
+	}
+	b.tokens--
+	dropped, b.dropped = b.dropped, 0
+	return true, dropped
+}
+
+// rateLimiter severity毎のトークンバケット
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[logging.Severity]*bucket
+}
+
+// rates severity毎の1秒あたりのエントリ数
+func (l *rateLimiter) rates() map[logging.Severity]float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rates := make(map[logging.Severity]float64, len(l.buckets))
+	for severity, b := range l.buckets {
+		rates[severity] = b.rate
+	}
+	return rates
+}
+
+// setRates 1秒あたりのエントリ数を変更する
+// 変更されていないseverityのバケットはそのまま使う
+func (l *rateLimiter) setRates(perSecond map[logging.Severity]float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	buckets := map[logging.Severity]*bucket{}
+	for severity, rate := range perSecond {
+		if rate <= 0 {
+			continue
+		}
+		if b, ok := l.buckets[severity]; ok && b.rate == rate {
+			buckets[severity] = b
+		} else {
+			buckets[severity] = newBucket(rate)
+		}
+	}
+	l.buckets = buckets
+}
+
+// allow エントリを出力できる場合はtrueを返す
+func (l *rateLimiter) allow(c context.Context, entry logging.Entry) bool {
+	l.mu.Lock()
+	b, ok := l.buckets[entry.Severity]
+	if !ok {
+		l.mu.Unlock()
+		return true
+	}
+	ok, dropped := b.take(clockFrom(c).Now())
+	l.mu.Unlock()
+	if 0 < dropped {
+		push(c, logging.Entry{
+			Payload: fmt.Sprintf("%d %s entries dropped by rate limit", dropped, entry.Severity),
+			Labels: map[string]string{
+				"dropped_count":    strconv.Itoa(dropped),
+				"dropped_severity": entry.Severity.String(),
+			},
+			Severity:  logging.Warning,
+			Trace:     entry.Trace,
+			Timestamp: entry.Timestamp,
+		})
+	}
+	return ok
+}
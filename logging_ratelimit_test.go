@@ -0,0 +1,76 @@
+package glbr
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// 1未満のrateでも容量は1で、1/rate秒ごとに1件出力できる
+func TestBucketFractionalRate(t *testing.T) {
+	b := newBucket(0.5)
+	now := time.Now()
+	if ok, _ := b.take(now); !ok {
+		t.Fatal("first take failed")
+	}
+	if ok, _ := b.take(now.Add(time.Second)); ok {
+		t.Error("take after 1s succeeded, want dropped")
+	}
+	ok, dropped := b.take(now.Add(3 * time.Second))
+	if !ok || dropped != 1 {
+		t.Errorf("take after 3s = %v, %d, want true, 1", ok, dropped)
+	}
+	if ok, _ := b.take(now.Add(time.Hour)); !ok {
+		t.Error("take after an hour failed")
+	}
+	if b.tokens != 0 {
+		t.Errorf("tokens = %v, want capacity 1 to be used", b.tokens)
+	}
+}
+
+// manualClock テストで進めるClock
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (m *manualClock) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+func (m *manualClock) Since(t time.Time) time.Duration { return m.Now().Sub(t) }
+
+func (m *manualClock) advance(d time.Duration) {
+	m.mu.Lock()
+	m.now = m.now.Add(d)
+	m.mu.Unlock()
+}
+
+// バケットはWithClockのClockで補充される
+func TestRateLimitClock(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}
+	s, rec, err := NewRecorder("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := s.WithClock(clock).WithRateLimit(map[logging.Severity]float64{logging.Info: 1}).Context()
+	for i := 0; i < 3; i++ {
+		Infof(c, "request")
+	}
+	if got := len(rec.Entries("app")); got != 1 {
+		t.Fatalf("entries before advance = %d, want 1", got)
+	}
+	clock.advance(time.Second)
+	Infof(c, "request")
+	entries := rec.Entries("app")
+	if len(entries) != 3 {
+		t.Fatalf("entries after advance = %d, want the entry and the dropped report", len(entries))
+	}
+	if report := entries[1]; report.Labels["dropped_count"] != "2" || !report.Timestamp.Equal(clock.Now()) {
+		t.Errorf("report = %v %v", report.Labels, report.Timestamp)
+	}
+}
@@ -0,0 +1,90 @@
+package glbr
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/logging"
+)
+
+// RecordedEntry Recorderに記録されたエントリ
+type RecordedEntry struct {
+	LogID string
+	Entry logging.Entry
+}
+
+// Recorder Cloud Loggingに送信する代わりにエントリを記録する
+// テストで出力されたエントリを確認する場合に使う
+type Recorder struct {
+	mu      sync.Mutex
+	entries []RecordedEntry
+}
+
+// NewRecorder エントリをRecorderに記録するserviceを取得する
+// 親エントリ、監査ログを含め、全てのlogIDのエントリが書き込み順に記録される
+//
+//	log, rec, err := glbr.NewRecorder("LogID")
+//	glbr.Debugf(log.Context(), "message")
+//	rec.Entries("LogID") // [{Payload: "message", Severity: Debug, ...}]
+func NewRecorder(logID string) (Service, *Recorder, error) {
+	if err := validateLogID(logID); err != nil {
+		return Service{}, nil, err
+	}
+	rec := &Recorder{}
+	service := Service{
+		ctx:      context.Background(),
+		option:   make([]logging.LoggerOption, 0),
+		logID:    logID,
+		loggers:  newLoggerCache(),
+		closer:   &closer{done: make(chan struct{})},
+		usage:    newUsage(),
+		recorder: rec,
+	}
+	return service, rec, nil
+}
+
+func (r *Recorder) record(logID string, entry logging.Entry) {
+	r.mu.Lock()
+	r.entries = append(r.entries, RecordedEntry{LogID: logID, Entry: entry})
+	r.mu.Unlock()
+}
+
+// All 記録された全てのエントリ
+func (r *Recorder) All() []RecordedEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedEntry(nil), r.entries...)
+}
+
+// Entries logIDに記録されたエントリ
+func (r *Recorder) Entries(logID string) []logging.Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var entries []logging.Entry
+	for _, e := range r.entries {
+		if e.LogID == logID {
+			entries = append(entries, e.Entry)
+		}
+	}
+	return entries
+}
+
+// Reset 記録されたエントリを破棄する
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.entries = nil
+	r.mu.Unlock()
+}
+
+// recordLogger Recorderに記録するlogger
+type recordLogger struct {
+	recorder *Recorder
+	logID    string
+}
+
+func (l recordLogger) Log(entry logging.Entry) { l.recorder.record(l.logID, entry) }
+func (l recordLogger) LogSync(_ context.Context, entry logging.Entry) error {
+	l.recorder.record(l.logID, entry)
+	return nil
+}
+func (recordLogger) Flush() error { return nil }
@@ -0,0 +1,90 @@
+package glbr
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// RedactionRules WithRedactionで値を伏せる対象
+// 名前は大文字小文字を区別しない
+type RedactionRules struct {
+	Fields      []string // 構造化ペイロードのフィールド。ネストしたフィールドも対象
+	QueryParams []string // 親エントリのリクエストURLのクエリパラメータ
+}
+
+// redactor WithRedactionの規則
+// WatchConfigで変更されるため、規則はmuで保護する
+type redactor struct {
+	mu    sync.RWMutex
+	rules RedactionRules
+}
+
+// WithRedaction rulesのフィールドとクエリパラメータの値を[REDACTED]にしてから出力する
+// 子エントリ、親エントリのペイロードとリクエストURLが対象。文字列のペイロードは変更しない
+//
+//	log = log.WithRedaction(glbr.RedactionRules{Fields: []string{"password", "card_number"}, QueryParams: glbr.DefaultReplayRedactedQuery})
+func (s Service) WithRedaction(rules RedactionRules) Service {
+	s.ctx = updateState(s.ctx, func(st *state) { st.redactor = &redactor{rules: rules} })
+	return s
+}
+
+// set 規則を変更する
+func (rd *redactor) set(rules RedactionRules) {
+	rd.mu.Lock()
+	rd.rules = rules
+	rd.mu.Unlock()
+}
+
+// current 現在の規則
+func (rd *redactor) current() RedactionRules {
+	if rd == nil {
+		return RedactionRules{}
+	}
+	rd.mu.RLock()
+	defer rd.mu.RUnlock()
+	return rd.rules
+}
+
+// payload ペイロードのフィールドの値を伏せる
+// 呼び出し元の値は変更せず、JSONに変換したコピーを返す
+func (rd *redactor) payload(payload interface{}) interface{} {
+	fields := rd.current().Fields
+	if len(fields) == 0 || payload == nil {
+		return payload
+	}
+	if _, ok := payload.(string); ok {
+		return payload
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return payload
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return payload
+	}
+	return redactFields(v, fields)
+}
+
+// request リクエストURLのクエリパラメータの値を伏せる
+// 伏せる値がない場合はrをそのまま返す
+func (rd *redactor) request(r *http.Request) *http.Request {
+	params := rd.current().QueryParams
+	if len(params) == 0 || r.URL == nil || r.URL.RawQuery == "" {
+		return r
+	}
+	query := redactQuery(r.URL.RawQuery, params)
+	if query == r.URL.RawQuery {
+		return r
+	}
+	lr := new(http.Request)
+	*lr = *r
+	u := *r.URL
+	u.RawQuery = query
+	lr.URL = &u
+	return lr
+}
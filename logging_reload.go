@@ -0,0 +1,370 @@
+package glbr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// WatchConfig pathの設定ファイルをintervalごとに読み直し、再起動せずに変更を適用する
+// 適用するのは min_severity, rate_limit, sampling, redaction, replayの min_severity, redact_headers, redact_query。変更毎にNoticeのエントリを出力する
+// 設定ファイルにない項目は、WatchConfigを呼び出す前にWithMinSeverity, WithRateLimit, WithSampling, WithRedaction,
+// WithReplayBundlesで設定した値になる。rate_limitはseverity毎に上書きし、0で無制限にする
+// 再起動が必要な項目の変更はWarningで報告して無視する。読み込みや検証に失敗した場合はErrorを出力し、直前の設定を維持する
+// NoOpのserviceでは何もしない。監視はShutdownで停止する interval Default: 10秒
+//
+//	log, err := config.NewService(nil)
+//	log, err = log.WatchConfig("/etc/app/logging.json", nil, 0)
+func (s Service) WatchConfig(path string, unmarshal func(data []byte, v interface{}) error, interval time.Duration) (Service, error) {
+	return s.watchConfig(path, func(context.Context) ([]byte, error) {
+		return ioutil.ReadFile(path)
+	}, unmarshal, interval)
+}
+
+// watchConfig fetchで取得した設定を最初に適用し、intervalごとに変更を適用する
+func (s Service) watchConfig(source string, fetch func(c context.Context) ([]byte, error), unmarshal func(data []byte, v interface{}) error, interval time.Duration) (Service, error) {
+	if s.noop {
+		return s, nil
+	}
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	c, cancel := context.WithTimeout(context.Background(), interval)
+	data, err := fetch(c)
+	cancel()
+	if err != nil {
+		return s, err
+	}
+	config, err := ParseConfig(data, unmarshal)
+	if err != nil {
+		return s, err
+	}
+	st, _ := getState(s.ctx)
+	l := &liveConfig{
+		limiter:   st.rateLimiter,
+		sampler:   s.sampler,
+		redactor:  st.redactor,
+		replay:    s.replay,
+		unmarshal: unmarshal,
+		data:      data,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	l.base.minimum = st.minimum
+	if l.limiter == nil {
+		l.limiter = &rateLimiter{buckets: map[logging.Severity]*bucket{}}
+	}
+	l.base.rates = l.limiter.rates()
+	if l.sampler == nil {
+		l.sampler = &sampler{}
+		l.sampler.set(1, logging.Default)
+	}
+	l.base.rate, l.base.unsampled = l.sampler.settings()
+	if l.redactor == nil {
+		l.redactor = &redactor{}
+	}
+	l.base.redaction = l.redactor.current()
+	if l.replay != nil {
+		l.base.replay = l.replay.options()
+	}
+	l.apply(config)
+	s.sampler = l.sampler
+	s.ctx = updateState(s.ctx, func(st *state) {
+		st.minimum = logging.Default
+		st.rateLimiter = l.limiter
+		st.redactor = l.redactor
+		st.live = l
+	})
+	go l.watch(s.Context(), source, fetch, interval)
+	return s, nil
+}
+
+// liveConfig WatchConfigで再起動せずに変更する設定
+type liveConfig struct {
+	min       int32 // logging.Severity
+	base      liveBase
+	limiter   *rateLimiter
+	sampler   *sampler
+	redactor  *redactor
+	replay    *replayer
+	unmarshal func(data []byte, v interface{}) error
+	mu        sync.Mutex
+	config    Config // 最後に適用した設定
+	data      []byte // 最後に読み込んだ内容
+	lastErr   string // 最後に報告した取得のエラー
+	stop      chan struct{}
+	done      chan struct{}
+	once      sync.Once
+}
+
+// liveBase WatchConfigを呼び出す前にコードで設定された値
+type liveBase struct {
+	minimum   logging.Severity
+	rates     map[logging.Severity]float64
+	rate      float64
+	unsampled logging.Severity
+	redaction RedactionRules
+	replay    ReplayOptions
+}
+
+// minimum 出力する最低severity
+func (l *liveConfig) minimum() logging.Severity {
+	return logging.Severity(atomic.LoadInt32(&l.min))
+}
+
+// close 監視を停止し、適用中の変更の出力を待つ
+func (l *liveConfig) close() {
+	l.once.Do(func() { close(l.stop) })
+	<-l.done
+}
+
+// configChange 適用した設定の変更
+type configChange struct {
+	Field  string      `json:"field"`
+	Old    interface{} `json:"old"`
+	New    interface{} `json:"new"`
+	Source string      `json:"source"`
+}
+
+// watch intervalごとに設定を取得して適用する
+func (l *liveConfig) watch(c context.Context, source string, fetch func(c context.Context) ([]byte, error), interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		fc, cancel := context.WithTimeout(c, interval)
+		data, err := fetch(fc)
+		cancel()
+		if err != nil {
+			l.failed(c, source, err)
+			continue
+		}
+		l.reload(c, source, data)
+	}
+}
+
+// failed 取得のエラーを出力する。同じエラーは続けて出力しない
+func (l *liveConfig) failed(c context.Context, source string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err.Error() == l.lastErr {
+		return
+	}
+	l.lastErr = err.Error()
+	l.report(c, logging.Error, map[string]interface{}{
+		"message":       fmt.Sprintf("logging config could not be read: %v", err),
+		"config_source": source,
+	})
+}
+
+// reload 内容が変わっていれば設定を検証して適用し、変更をエントリとして出力する
+func (l *liveConfig) reload(c context.Context, source string, data []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastErr = ""
+	if bytes.Equal(data, l.data) {
+		return
+	}
+	l.data = data
+	next, err := ParseConfig(data, l.unmarshal)
+	if err != nil {
+		l.report(c, logging.Error, map[string]interface{}{
+			"message":       fmt.Sprintf("logging config was not applied: %v", err),
+			"config_source": source,
+		})
+		return
+	}
+	changes, restart := l.apply(next)
+	for _, change := range changes {
+		change.Source = source
+		l.report(c, logging.Notice, map[string]interface{}{
+			"message":       fmt.Sprintf("logging config %s changed from %v to %v", change.Field, change.Old, change.New),
+			"config_change": change,
+		})
+	}
+	if 0 < len(restart) {
+		l.report(c, logging.Warning, map[string]interface{}{
+			"message":        fmt.Sprintf("logging config %v changed but requires a restart", restart),
+			"config_restart": restart,
+			"config_source":  source,
+		})
+	}
+}
+
+// report 設定の変更をmin_severityに関わらず出力する
+func (l *liveConfig) report(c context.Context, severity logging.Severity, payload map[string]interface{}) {
+	push(c, logging.Entry{
+		Payload:   normalizePayload(c, versioned(payload)),
+		Severity:  severity,
+		Timestamp: clockFrom(c).Now(),
+	})
+}
+
+// apply nextを適用する
+// 適用した変更と、再起動が必要な変更された項目を返す
+func (l *liveConfig) apply(next Config) (changes []configChange, restart []string) {
+	prev := l.config
+	l.config = next
+	changed := func(field string, old, new interface{}) {
+		if fmt.Sprint(old) != fmt.Sprint(new) {
+			changes = append(changes, configChange{Field: field, Old: old, New: new})
+		}
+	}
+	oldMin, newMin := l.minSeverity(prev), l.minSeverity(next)
+	changed("min_severity", oldMin.String(), newMin.String())
+	atomic.StoreInt32(&l.min, int32(newMin))
+
+	oldRates, newRates := l.rates(prev), l.rates(next)
+	for _, severity := range rateSeverities(oldRates, newRates) {
+		if oldRates[severity] != newRates[severity] {
+			changes = append(changes, configChange{Field: "rate_limit." + severity.String(), Old: rateValue(oldRates, severity), New: rateValue(newRates, severity)})
+		}
+	}
+	l.limiter.setRates(newRates)
+
+	oldRate, oldUnsampled := l.sampling(prev)
+	newRate, newUnsampled := l.sampling(next)
+	changed("sampling.rate", oldRate, newRate)
+	changed("sampling.unsampled_min_severity", oldUnsampled.String(), newUnsampled.String())
+	l.sampler.set(newRate, newUnsampled)
+
+	oldRules, newRules := l.redaction(prev), l.redaction(next)
+	changed("redaction.fields", oldRules.Fields, newRules.Fields)
+	changed("redaction.query_params", oldRules.QueryParams, newRules.QueryParams)
+	l.redactor.set(newRules)
+
+	if l.replay != nil {
+		old, new := l.replayOptions(prev), l.replayOptions(next)
+		changed("replay.min_severity", old.MinSeverity.String(), new.MinSeverity.String())
+		changed("replay.redact_headers", old.RedactHeaders, new.RedactHeaders)
+		changed("replay.redact_query", old.RedactQuery, new.RedactQuery)
+		l.replay.update(new.MinSeverity, new.RedactHeaders, new.RedactQuery)
+	}
+	return changes, restartFields(prev, next)
+}
+
+// minSeverity 設定のmin_severity。ない場合はコードで設定した値
+func (l *liveConfig) minSeverity(c Config) logging.Severity {
+	if c.MinSeverity == "" {
+		return l.base.minimum
+	}
+	severity, _ := parseSeverityName(c.MinSeverity)
+	return severity
+}
+
+// rates コードで設定した制限を設定のrate_limitで上書きした制限
+func (l *liveConfig) rates(c Config) map[logging.Severity]float64 {
+	rates := make(map[logging.Severity]float64, len(l.base.rates)+len(c.RateLimit))
+	for severity, rate := range l.base.rates {
+		rates[severity] = rate
+	}
+	for severity, rate := range c.rateLimits() {
+		if 0 < rate {
+			rates[severity] = rate
+		} else {
+			delete(rates, severity)
+		}
+	}
+	return rates
+}
+
+// sampling 設定のsampling。ない場合はコードで設定した値
+func (l *liveConfig) sampling(c Config) (float64, logging.Severity) {
+	if c.Sampling == nil {
+		return l.base.rate, l.base.unsampled
+	}
+	unsampled, _ := parseSeverityName(c.Sampling.UnsampledMinSeverity)
+	return c.Sampling.Rate, unsampled
+}
+
+// redaction 設定のredaction。ない場合はコードで設定した値
+func (l *liveConfig) redaction(c Config) RedactionRules {
+	if c.Redaction == nil {
+		return l.base.redaction
+	}
+	return RedactionRules{Fields: c.Redaction.Fields, QueryParams: c.Redaction.QueryParams}
+}
+
+// replayOptions 設定のreplay。ない項目はコードで設定した値
+func (l *liveConfig) replayOptions(c Config) ReplayOptions {
+	opts := l.base.replay
+	if c.Replay == nil {
+		return opts
+	}
+	if c.Replay.MinSeverity != "" {
+		opts.MinSeverity, _ = parseSeverityName(c.Replay.MinSeverity)
+	}
+	if c.Replay.RedactHeaders != nil {
+		opts.RedactHeaders = c.Replay.RedactHeaders
+	}
+	if c.Replay.RedactQuery != nil {
+		opts.RedactQuery = c.Replay.RedactQuery
+	}
+	return opts
+}
+
+// rateSeverities 両方の制限のseverity
+func rateSeverities(a, b map[logging.Severity]float64) []logging.Severity {
+	var severities []logging.Severity
+	for severity := range a {
+		severities = append(severities, severity)
+	}
+	for severity := range b {
+		if _, ok := a[severity]; !ok {
+			severities = append(severities, severity)
+		}
+	}
+	sort.Slice(severities, func(i, j int) bool { return severities[i] < severities[j] })
+	return severities
+}
+
+// rateValue 制限がない場合はnil
+func rateValue(rates map[logging.Severity]float64, severity logging.Severity) interface{} {
+	if rate, ok := rates[severity]; ok && 0 < rate {
+		return rate
+	}
+	return nil
+}
+
+// restartFields 再起動しないと反映されない、変更された項目
+func restartFields(prev, next Config) []string {
+	fixed := func(c Config) map[string]json.RawMessage {
+		c.MinSeverity, c.RateLimit, c.Sampling, c.Redaction = "", nil, nil, nil
+		if c.Replay != nil {
+			replay := *c.Replay
+			replay.MinSeverity, replay.RedactHeaders, replay.RedactQuery = "", nil, nil
+			c.Replay = &replay
+		}
+		b, _ := json.Marshal(c)
+		fields := map[string]json.RawMessage{}
+		json.Unmarshal(b, &fields)
+		return fields
+	}
+	a, b := fixed(prev), fixed(next)
+	var fields []string
+	for k, v := range a {
+		if !bytes.Equal(v, b[k]) {
+			fields = append(fields, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
@@ -0,0 +1,58 @@
+package glbr
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+func fetchConfig(data string) func(context.Context) ([]byte, error) {
+	return func(context.Context) ([]byte, error) { return []byte(data), nil }
+}
+
+// 設定ファイルにない項目はコードで設定した値のまま
+func TestWatchConfigBase(t *testing.T) {
+	s, err := NewLocal("app", ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = s.WithMinSeverity(logging.Warning).WithRateLimit(map[logging.Severity]float64{logging.Info: 5}).WithSampling(0.5, logging.Error)
+	s, err = s.watchConfig("test", fetchConfig(`{"log_id": "app", "output": "local", "rate_limit": {"Debug": 10}}`), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+	if Enabled(s.Context(), logging.Info) {
+		t.Error("Info is enabled, want WithMinSeverity to apply")
+	}
+	st, _ := getState(s.Context())
+	if rates := st.rateLimiter.rates(); rates[logging.Info] != 5 || rates[logging.Debug] != 10 {
+		t.Errorf("rates = %v", rates)
+	}
+	if rate, minimum := s.sampler.settings(); rate != 0.5 || minimum != logging.Error {
+		t.Errorf("sampling = %v, %v", rate, minimum)
+	}
+
+	changes, _ := st.live.apply(Config{LogID: "app", Output: "local", MinSeverity: "Debug", Sampling: &SamplingConfig{Rate: 1}, Redaction: &RedactionConfig{Fields: []string{"password"}}})
+	if len(changes) != 5 {
+		t.Errorf("changes = %+v", changes)
+	}
+	if !Enabled(s.Context(), logging.Debug) {
+		t.Error("Debug is not enabled after reload")
+	}
+	if rules := st.redactor.current(); len(rules.Fields) != 1 {
+		t.Errorf("redaction = %+v", rules)
+	}
+}
+
+func TestWatchConfigNoOp(t *testing.T) {
+	s, err := NewNoOp().watchConfig("test", fetchConfig(`{"log_id": "app", "output": "noop", "min_severity": "Debug"}`), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Enabled(s.Context(), logging.Emergency) {
+		t.Error("NoOp service is enabled after WatchConfig")
+	}
+}
@@ -0,0 +1,118 @@
+package glbr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+)
+
+// ConfigProvider 設定ファイルの内容を取得する
+// 複数のサービスのログの設定を1か所で管理する場合に、WatchRemoteConfigに渡す
+type ConfigProvider interface {
+	Name() string                            // 変更のエントリのconfig_sourceに出力する名前
+	Fetch(c context.Context) ([]byte, error) // 設定ファイルの内容
+}
+
+// LoadRemoteConfig providerの設定をParseConfigで読み込む
+func LoadRemoteConfig(c context.Context, provider ConfigProvider, unmarshal func(data []byte, v interface{}) error) (Config, error) {
+	data, err := provider.Fetch(c)
+	if err != nil {
+		return Config{}, err
+	}
+	return ParseConfig(data, unmarshal)
+}
+
+// WatchRemoteConfig providerの設定をintervalごとに取得し、WatchConfigと同じ項目を再起動せずに適用する
+// 取得に失敗している間は直前の設定を維持し、同じエラーは続けて出力しない interval Default: 10秒
+//
+//	log, err = log.WatchRemoteConfig(glbr.NewGCSConfig(client.Bucket("ops").Object("logging/app.json")), nil, time.Minute)
+func (s Service) WatchRemoteConfig(provider ConfigProvider, unmarshal func(data []byte, v interface{}) error, interval time.Duration) (Service, error) {
+	return s.watchConfig(provider.Name(), provider.Fetch, unmarshal, interval)
+}
+
+// gcsConfig Cloud Storageのオブジェクトの設定
+type gcsConfig struct {
+	object     *storage.ObjectHandle
+	mu         sync.Mutex
+	generation int64
+	data       []byte
+}
+
+// NewGCSConfig Cloud Storageのオブジェクトを設定ファイルとするConfigProvider
+// オブジェクトのgenerationが変わった場合のみ内容を取得する
+func NewGCSConfig(object *storage.ObjectHandle) ConfigProvider {
+	return &gcsConfig{object: object}
+}
+
+func (p *gcsConfig) Name() string {
+	return "gs://" + p.object.BucketName() + "/" + p.object.ObjectName()
+}
+
+func (p *gcsConfig) Fetch(c context.Context) ([]byte, error) {
+	attrs, err := p.object.Attrs(c)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if attrs.Generation == p.generation {
+		return p.data, nil
+	}
+	r, err := p.object.Generation(attrs.Generation).NewReader(c)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p.generation, p.data = attrs.Generation, data
+	return data, nil
+}
+
+// firestoreConfig Firestoreのドキュメントの設定
+type firestoreConfig struct {
+	doc   *firestore.DocumentRef
+	field string
+}
+
+// NewFirestoreConfig Firestoreのドキュメントを設定とするConfigProvider
+// fieldが空の場合はドキュメント全体をConfigのJSONとして扱う。
+// fieldを指定した場合、その値が文字列であれば設定ファイルの内容、mapであればConfigのJSONとして扱う
+func NewFirestoreConfig(doc *firestore.DocumentRef, field string) ConfigProvider {
+	return firestoreConfig{doc: doc, field: field}
+}
+
+func (p firestoreConfig) Name() string {
+	if p.field == "" {
+		return p.doc.Path
+	}
+	return p.doc.Path + "#" + p.field
+}
+
+func (p firestoreConfig) Fetch(c context.Context) ([]byte, error) {
+	snap, err := p.doc.Get(c)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{} = snap.Data()
+	if p.field != "" {
+		if v, err = snap.DataAt(p.field); err != nil {
+			return nil, err
+		}
+	}
+	switch v := v.(type) {
+	case string:
+		return []byte(v), nil
+	case map[string]interface{}:
+		return json.Marshal(v)
+	}
+	return nil, fmt.Errorf("glbr: firestore config %s is %T, want a string or a map", p.Name(), v)
+}
@@ -0,0 +1,272 @@
+package glbr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"cloud.google.com/go/logging"
+)
+
+// DefaultReplayRedactedHeaders 再現用の記録で値を伏せるリクエストヘッダー
+var DefaultReplayRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	DebugHeader,
+	"X-Api-Key",
+	"X-Goog-Iap-Jwt-Assertion",
+}
+
+// DefaultReplayRedactedQuery 再現用の記録で値を伏せるURLのクエリパラメータ
+// JSONとフォームのボディのフィールドにも使う
+var DefaultReplayRedactedQuery = []string{
+	"access_token",
+	"id_token",
+	"refresh_token",
+	"token",
+	"code",
+	"client_secret",
+	"password",
+	"api_key",
+	"key",
+	"sig",
+	"signature",
+	"X-Goog-Signature",
+	"X-Amz-Signature",
+}
+
+// replayRedacted 伏せたヘッダーの値
+const replayRedacted = "[REDACTED]"
+
+// ReplayOptions WithReplayBundlesの設定
+type ReplayOptions struct {
+	MinSeverity   logging.Severity // 記録する親エントリの最低severity Default: logging.Error
+	BodyLimit     int              // 記録するボディの最大バイト数 Default: 4KB
+	RedactHeaders []string         // 値を伏せるヘッダー Default: DefaultReplayRedactedHeaders
+	RedactQuery   []string         // 値を伏せるクエリパラメータとボディのフィールド。大文字小文字を区別しない Default: DefaultReplayRedactedQuery
+	// RedactBody 記録するボディの先頭を加工する。nilを返した場合はボディを記録しない
+	// Default: JSONとフォームのボディのRedactQueryのフィールドを伏せる。解析できないJSON(途中で切れたもの等)は記録しない
+	RedactBody func(contentType string, body []byte) []byte
+}
+
+// replayBundle 失敗したリクエストを再現するための記録
+type replayBundle struct {
+	Method        string              `json:"method"`
+	URL           string              `json:"url"`
+	Proto         string              `json:"proto"`
+	Header        map[string][]string `json:"header"`
+	Body          string              `json:"body,omitempty"`
+	BodyEncoding  string              `json:"body_encoding,omitempty"` // UTF-8でないボディは"base64"
+	BodyTruncated bool                `json:"body_truncated,omitempty"`
+	Status        int                 `json:"status"`
+	Trace         string              `json:"trace"`
+}
+
+// replayer WithReplayBundlesの送信先と設定
+type replayer struct {
+	mu   sync.RWMutex // WatchConfigによるoptsの変更
+	sink Sink
+	opts ReplayOptions
+}
+
+// WithReplayBundles 親エントリがMinSeverity以上で終わったリクエストのメソッド、URL、ヘッダー、ボディの先頭、TraceIDを
+// {"replay": {...}}としてsinkに送信する。logIDは{parentLogID}_replay
+// 失敗したリクエストを手元で再現する場合に使う。RedactHeadersのヘッダー、RedactQueryのクエリパラメータの値とURLのユーザー情報は伏せられ、
+// ボディはRedactBodyで加工される。sinkはShutdownで閉じられる
+//
+//	log = log.WithReplayBundles(glbr.NewGCSSink(bucket, "replay/", time.Minute), glbr.ReplayOptions{})
+func (s Service) WithReplayBundles(sink Sink, opts ReplayOptions) Service {
+	if opts.MinSeverity == logging.Default {
+		opts.MinSeverity = logging.Error
+	}
+	if opts.BodyLimit <= 0 {
+		opts.BodyLimit = 4 << 10
+	}
+	if opts.RedactHeaders == nil {
+		opts.RedactHeaders = DefaultReplayRedactedHeaders
+	}
+	if opts.RedactQuery == nil {
+		opts.RedactQuery = DefaultReplayRedactedQuery
+	}
+	s.replay = &replayer{sink: sink, opts: opts}
+	return s
+}
+
+// bodyLimit ボディの先頭を保持するバイト数
+func (rp *replayer) bodyLimit() int {
+	if rp == nil {
+		return 0
+	}
+	return rp.options().BodyLimit
+}
+
+// options 現在の設定
+func (rp *replayer) options() ReplayOptions {
+	rp.mu.RLock()
+	defer rp.mu.RUnlock()
+	return rp.opts
+}
+
+// update MinSeverity, RedactHeaders, RedactQueryを変更する
+func (rp *replayer) update(minimum logging.Severity, headers, query []string) {
+	if minimum == logging.Default {
+		minimum = logging.Error
+	}
+	if headers == nil {
+		headers = DefaultReplayRedactedHeaders
+	}
+	if query == nil {
+		query = DefaultReplayRedactedQuery
+	}
+	rp.mu.Lock()
+	rp.opts.MinSeverity, rp.opts.RedactHeaders, rp.opts.RedactQuery = minimum, headers, query
+	rp.mu.Unlock()
+}
+
+// redacted 値を伏せるヘッダーかどうか
+func (rp *replayer) redacted(key string) bool {
+	for _, h := range rp.options().RedactHeaders {
+		if http.CanonicalHeaderKey(h) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// redactedKey keysに含まれるキーかどうか。大文字小文字を区別しない
+func redactedKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactQuery クエリ文字列のkeysのパラメータの値を伏せる。パラメータの順序は変えない
+func redactQuery(raw string, keys []string) string {
+	if raw == "" || len(keys) == 0 {
+		return raw
+	}
+	params := strings.Split(raw, "&")
+	for i, param := range params {
+		k := param
+		if j := strings.IndexByte(param, '='); 0 <= j {
+			k = param[:j]
+		}
+		if key, err := url.QueryUnescape(k); err == nil && redactedKey(keys, key) {
+			params[i] = k + "=" + url.QueryEscape(replayRedacted)
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// redactBody JSONとフォームのボディのkeysのフィールドの値を伏せる
+// 解析できないJSONはnilを返す。それ以外の形式はそのまま返す
+func redactBody(contentType string, body []byte, keys []string) []byte {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		return []byte(redactQuery(string(body), keys))
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil
+		}
+		b, err := json.Marshal(redactFields(v, keys))
+		if err != nil {
+			return nil
+		}
+		return b
+	}
+	return body
+}
+
+// redactFields JSONの値のkeysのフィールドの値を伏せる
+func redactFields(v interface{}, keys []string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if redactedKey(keys, k) {
+				v[k] = replayRedacted
+			} else {
+				v[k] = redactFields(child, keys)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactFields(child, keys)
+		}
+	}
+	return v
+}
+
+// bodyText ボディの文字列。UTF-8でない場合はbase64で、encodingは"base64"
+func bodyText(sample []byte) (body, encoding string) {
+	if utf8.Valid(sample) {
+		return string(sample), ""
+	}
+	return base64.StdEncoding.EncodeToString(sample), "base64"
+}
+
+// send 親エントリがMinSeverity以上であれば記録を送信する
+func (rp *replayer) send(parentLogID string, parent logging.Entry, r *http.Request, body *countingBody) {
+	if rp == nil || parent.Severity < rp.options().MinSeverity {
+		return
+	}
+	bundle := replayBundle{
+		Method: r.Method,
+		Proto:  r.Proto,
+		Header: make(map[string][]string, len(r.Header)),
+		Trace:  parent.Trace,
+	}
+	if parent.HTTPRequest != nil {
+		bundle.Status = parent.HTTPRequest.Status
+	}
+	if r.URL != nil {
+		u := *r.URL
+		u.User = nil
+		u.RawQuery = redactQuery(u.RawQuery, rp.options().RedactQuery)
+		if u.Host == "" {
+			u.Host = r.Host
+		}
+		bundle.URL = u.String()
+	}
+	for k, vs := range r.Header {
+		if rp.redacted(k) {
+			vs = []string{replayRedacted}
+		}
+		bundle.Header[k] = vs
+	}
+	if sample := body.bodySample(); 0 < len(sample) {
+		if limit := rp.options().BodyLimit; limit < len(sample) {
+			sample = sample[:limit] // WithDebugHeaderのリクエストはより多く保持している
+		}
+		bundle.BodyTruncated = int64(len(sample)) < body.size()
+		opts := rp.options()
+		if opts.RedactBody != nil {
+			sample = opts.RedactBody(r.Header.Get("Content-Type"), sample)
+		} else {
+			sample = redactBody(r.Header.Get("Content-Type"), sample, opts.RedactQuery)
+		}
+		if sample != nil {
+			bundle.Body, bundle.BodyEncoding = bodyText(sample)
+		}
+	}
+	rp.sink.Send(parentLogID+"_replay", logging.Entry{
+		Payload:   versioned(map[string]interface{}{"replay": bundle}),
+		Severity:  parent.Severity,
+		Trace:     parent.Trace,
+		SpanID:    parent.SpanID,
+		Timestamp: parent.Timestamp,
+	})
+}
@@ -0,0 +1,36 @@
+package glbr
+
+import (
+	"testing"
+)
+
+func TestRedactQuery(t *testing.T) {
+	got := redactQuery("a=1&access_token=secret&Code=x&b", DefaultReplayRedactedQuery)
+	if want := "a=1&access_token=%5BREDACTED%5D&Code=%5BREDACTED%5D&b"; got != want {
+		t.Errorf("redactQuery = %q, want %q", got, want)
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		contentType, body, want string
+		omitted                 bool
+	}{
+		{"application/json", `{"user":"a","password":"p","nested":[{"token":"t","id":12345678901234567890}]}`, `{"nested":[{"id":12345678901234567890,"token":"[REDACTED]"}],"password":"[REDACTED]","user":"a"}`, false},
+		{"application/json; charset=utf-8", `{"password":"p"`, "", true},
+		{"application/x-www-form-urlencoded", "user=a&password=p", "user=a&password=%5BREDACTED%5D", false},
+		{"text/plain", "password=p", "password=p", false},
+	}
+	for _, tt := range tests {
+		got := redactBody(tt.contentType, []byte(tt.body), DefaultReplayRedactedQuery)
+		if tt.omitted {
+			if got != nil {
+				t.Errorf("%s: body = %q, want omitted", tt.contentType, got)
+			}
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: body = %q, want %q", tt.contentType, got, tt.want)
+		}
+	}
+}
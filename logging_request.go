@@ -0,0 +1,138 @@
+package glbr
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"cloud.google.com/go/logging"
+)
+
+// countingBody 読み込まれたリクエストボディのサイズを数える
+// sampleLimitが正の場合は先頭からsampleLimitバイトまでを保持する
+type countingBody struct {
+	io.ReadCloser
+	n int64
+
+	mu          sync.Mutex
+	sampleLimit int
+	sample      []byte
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(&b.n, int64(n))
+	if 0 < n && 0 < b.sampleLimit {
+		b.mu.Lock()
+		if rest := b.sampleLimit - len(b.sample); 0 < rest {
+			if n < rest {
+				rest = n
+			}
+			b.sample = append(b.sample, p[:rest]...)
+		}
+		b.mu.Unlock()
+	}
+	return n, err
+}
+
+// bodySample 保持したボディの先頭
+func (b *countingBody) bodySample() []byte {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.sample...)
+}
+
+func (b *countingBody) size() int64 {
+	return atomic.LoadInt64(&b.n)
+}
+
+// wrapBody リクエストボディを数えるためのラッパーに差し替えたリクエストを返す
+// ボディの先頭sampleLimitバイトを保持する。呼び出し元のリクエストは変更しない
+func wrapBody(r *http.Request, sampleLimit int) (*http.Request, *countingBody) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return r, nil
+	}
+	body := &countingBody{ReadCloser: r.Body, sampleLimit: sampleLimit}
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.Body = body
+	return r2, body
+}
+
+// requestSize リクエストラインとヘッダーの推定サイズにボディのサイズを加えたもの
+// ボディのサイズはContent-Lengthと読み込まれたサイズの大きい方
+func requestSize(r *http.Request, body *countingBody) int64 {
+	size := int64(len(r.Method) + len(r.URL.RequestURI()) + len(r.Proto) + 4)
+	for k, vs := range r.Header {
+		for _, v := range vs {
+			size += int64(len(k) + len(v) + 4)
+		}
+	}
+	n := r.ContentLength
+	if body != nil && n < body.size() {
+		n = body.size()
+	}
+	if 0 < n {
+		size += n
+	}
+	return size
+}
+
+// DefaultEmptyURLPlaceholder リクエストURLが空の場合に親エントリに出力するURL
+const DefaultEmptyURLPlaceholder = "Empty_RequestUrl"
+
+// WithEmptyURLPlaceholder リクエストURLが空の場合に親エントリに出力するURLを指定する
+// Default: DefaultEmptyURLPlaceholder
+func (s Service) WithEmptyURLPlaceholder(placeholder string) Service {
+	s.emptyURL = placeholder
+	return s
+}
+
+// loggedRequest 親エントリに出力するリクエスト
+// URLが空の場合は、呼び出し元のリクエストを変更せずにplaceholderのURLを持つコピーを返し、empty_url=trueを記録する
+func (s Service) loggedRequest(r *http.Request, labels map[string]string) *http.Request {
+	if r.URL != nil && r.URL.String() != "" {
+		return r
+	}
+	placeholder := s.emptyURL
+	if placeholder == "" {
+		placeholder = DefaultEmptyURLPlaceholder
+	}
+	lr := new(http.Request)
+	*lr = *r
+	lr.URL = &url.URL{Path: placeholder}
+	labels["empty_url"] = "true"
+	return lr
+}
+
+// ParentEntryHook 親エントリを出力する直前に呼び出される
+// HTTPRequestやLabelsの補完に使う
+type ParentEntryHook func(entry *logging.Entry)
+
+// WithParentEntryHook 親エントリを出力する直前に呼び出す処理を追加する
+// 追加した順に呼び出される
+func (s Service) WithParentEntryHook(hook ParentEntryHook) Service {
+	s.parentHooks = append(append([]ParentEntryHook{}, s.parentHooks...), hook)
+	return s
+}
+
+// protocolLabels logging.HTTPRequestにないプロトコルをラベルにする
+// Refererはlogging.HTTPRequest.Requestから出力される
+func protocolLabels(labels map[string]string, r *http.Request) {
+	labels["protocol"] = r.Proto
+}
+
+// contentTypeLabels リクエストとレスポンスのContent-Type
+func contentTypeLabels(labels map[string]string, r *http.Request, header http.Header) {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		labels["content_type"] = ct
+	}
+	if ct := header.Get("Content-Type"); ct != "" {
+		labels["response_content_type"] = ct
+	}
+}
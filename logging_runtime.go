@@ -0,0 +1,100 @@
+package glbr
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// runtimeStats ランタイムの統計のペイロード
+type runtimeStats struct {
+	Goroutines    int      `json:"goroutines"`
+	HeapAlloc     uint64   `json:"heap_alloc"`
+	HeapInuse     uint64   `json:"heap_inuse"`
+	HeapObjects   uint64   `json:"heap_objects"`
+	Sys           uint64   `json:"sys"`
+	NumGC         uint32   `json:"num_gc"`
+	GCPauseTotal  string   `json:"gc_pause_total"`
+	GCPauses      []string `json:"gc_pauses,omitempty"` // 前回の出力以降のGCの停止時間(最大256件)
+	GCCPUFraction float64  `json:"gc_cpu_fraction"`
+}
+
+// readRuntimeStats 現在のランタイムの統計を取得する
+// lastGCより後のGCの停止時間を含める
+func readRuntimeStats(lastGC uint32) runtimeStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	stats := runtimeStats{
+		Goroutines:    runtime.NumGoroutine(),
+		HeapAlloc:     m.HeapAlloc,
+		HeapInuse:     m.HeapInuse,
+		HeapObjects:   m.HeapObjects,
+		Sys:           m.Sys,
+		NumGC:         m.NumGC,
+		GCPauseTotal:  time.Duration(m.PauseTotalNs).String(),
+		GCCPUFraction: m.GCCPUFraction,
+	}
+	n := m.NumGC - lastGC
+	if uint32(len(m.PauseNs)) < n {
+		n = uint32(len(m.PauseNs))
+	}
+	for i := uint32(0); i < n; i++ {
+		pause := m.PauseNs[(m.NumGC-n+i)%uint32(len(m.PauseNs))]
+		stats.GCPauses = append(stats.GCPauses, time.Duration(pause).String())
+	}
+	return stats
+}
+
+// LogRuntimeStats メモリ、GC、goroutine数を{"runtime": {...}}としてInfoで出力する
+// GCの停止時間は直近のGCの分のみ出力する
+func LogRuntimeStats(c context.Context) {
+	if !Enabled(c, logging.Info) {
+		return
+	}
+	var lastGC uint32
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	if 0 < m.NumGC {
+		lastGC = m.NumGC - 1
+	}
+	logRuntimeStats(c, readRuntimeStats(lastGC))
+}
+
+func logRuntimeStats(c context.Context, stats runtimeStats) {
+	sendPayload(c, logging.Info, versioned(map[string]interface{}{"runtime": stats}), nil)
+}
+
+// LogRuntimeStatsEvery intervalごとにLogRuntimeStatsと同じエントリを出力する
+// GCの停止時間は前回の出力以降の分を出力する。stopを呼び出すかcが終了すると出力をやめる
+//
+//	stop := glbr.LogRuntimeStatsEvery(log.Context(), time.Minute)
+//	defer stop()
+func LogRuntimeStatsEvery(c context.Context, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var lastGC uint32
+		for {
+			select {
+			case <-ticker.C:
+				stats := readRuntimeStats(lastGC)
+				lastGC = stats.NumGC
+				if Enabled(c, logging.Info) {
+					logRuntimeStats(c, stats)
+				}
+			case <-c.Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
@@ -0,0 +1,59 @@
+package glbr
+
+import (
+	"hash/fnv"
+	"math"
+	"sync/atomic"
+
+	"cloud.google.com/go/logging"
+)
+
+// sampler WithSamplingのリクエストの選択
+// WatchConfigで変更されるため、値はatomicに読み書きする
+type sampler struct {
+	rate    uint64 // math.Float64bits
+	minimum int32  // logging.Severity
+}
+
+// WithSampling TraceIDからrateの割合(0から1)のリクエストを選び、選ばれなかったリクエストではunsampledMin未満の子エントリを出力しない
+// 同じtraceのリクエストはサービスをまたいで同じ判断になる。選ばれなかったリクエストの親エントリには sampled=false のラベルが付く
+// WithTraceHeadersで呼び出し元のサンプリングの判断を引き継いだリクエストには適用しない
+//
+//	log = log.WithSampling(0.1, logging.Warning)
+func (s Service) WithSampling(rate float64, unsampledMin logging.Severity) Service {
+	if math.IsNaN(rate) || rate < 0 || 1 < rate {
+		panic(ErrInvalidSamplingRate)
+	}
+	sp := &sampler{}
+	sp.set(rate, unsampledMin)
+	s.sampler = sp
+	return s
+}
+
+// set 割合と選ばれなかったリクエストの最低severityを変更する
+func (sp *sampler) set(rate float64, unsampledMin logging.Severity) {
+	atomic.StoreUint64(&sp.rate, math.Float64bits(rate))
+	atomic.StoreInt32(&sp.minimum, int32(unsampledMin))
+}
+
+// settings 現在の割合と最低severity
+func (sp *sampler) settings() (float64, logging.Severity) {
+	return math.Float64frombits(atomic.LoadUint64(&sp.rate)), logging.Severity(atomic.LoadInt32(&sp.minimum))
+}
+
+// apply グループが選ばれなかった場合はstの最低severityを上げてtrueを返す
+func (sp *sampler) apply(st *state, g *group) (dropped bool) {
+	if sp == nil || g.traced {
+		return false
+	}
+	rate, minimum := sp.settings()
+	h := fnv.New64a()
+	h.Write([]byte(g.id))
+	if float64(h.Sum64()>>11)/(1<<53) < rate {
+		return false
+	}
+	if st.minimum < minimum {
+		st.minimum = minimum
+	}
+	return true
+}
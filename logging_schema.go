@@ -0,0 +1,80 @@
+package glbr
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaVersion glbrが出力する構造化ペイロードのスキーマのバージョン
+// フィールドの追加や変更を行う場合は値を上げて、migrationsに前のバージョンからの変換を追加する
+//
+// 構造化ペイロードはトップレベルのキーで種類を表し、schema_versionを含む
+//
+//	{"schema_version": 1, "outcome": ..., "fields": {...}, "messages": [...], "debug_body": {...}, "message": "..."}  グループの親エントリ(Outcome, Set, 正規ログ行, WithDebugHeader, アクセスログ)
+//	{"schema_version": 1, "progress": {"done", "total", "percent", "elapsed"}}
+//	{"schema_version": 1, "http_client_trace": {"host", "reused", "dns", "connect", "tls_handshake", "ttfb", "error"}}
+//	{"schema_version": 1, "cloudevent": {"id", "source", "specversion", "type", "subject", "time", "datacontenttype", "data"}}
+//	{"schema_version": 1, "sequence", "action", "subject", "details", "timestamp", "prev_hash", "hash"}  監査ログ
+//	{"schema_version": 1, "runtime": {...}}, {"schema_version": 1, "slow_request": {...}}, {"schema_version": 1, "response_misuse": {...}}
+//	{"schema_version": 1, "replay": {...}}  WithReplayBundlesのsinkに送信する記録
+//	{"schema_version": 1, "config_change": {"field", "old", "new", "source"}}  WatchConfigで適用した変更
+//	{"schema_version": 1, "message", "repeat_count"}  WithDeduplicationでまとめたエントリ
+//
+// 既存のフィールドの削除や型の変更は行わない
+const SchemaVersion = 1
+
+// schemaVersionKey スキーマのバージョンを保持するキー
+const schemaVersionKey = "schema_version"
+
+// migrations バージョン毎の次のバージョンへの変換
+// migrations[v]はバージョンvのペイロードをv+1に変換する
+var migrations = []func(payload map[string]interface{}){
+	// 0: schema_version導入前。フィールドは1と同じ
+	func(payload map[string]interface{}) {},
+}
+
+// versioned ペイロードに現在のスキーマのバージョンを付加する
+func versioned(payload map[string]interface{}) map[string]interface{} {
+	payload[schemaVersionKey] = SchemaVersion
+	return payload
+}
+
+// PayloadVersion エクスポートされたペイロードのスキーマのバージョン
+// schema_versionを含まない場合は0を返す
+func PayloadVersion(payload map[string]interface{}) (int, error) {
+	v, ok := payload[schemaVersionKey]
+	if !ok {
+		return 0, nil
+	}
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case float64: // encoding/json
+		return int(v), nil
+	case json.Number:
+		n, err := v.Int64()
+		return int(n), err
+	case string: // BigQueryのエクスポート
+		var n int
+		_, err := fmt.Sscan(v, &n)
+		return n, err
+	default:
+		return 0, fmt.Errorf("%w: %v", ErrUnknownSchemaVersion, v)
+	}
+}
+
+// MigratePayload エクスポートされたペイロードを現在のSchemaVersionに変換する
+// 古いバージョンで出力されたログを読む処理で使う。payloadは変更される
+func MigratePayload(payload map[string]interface{}) (map[string]interface{}, error) {
+	v, err := PayloadVersion(payload)
+	if err != nil {
+		return nil, err
+	}
+	if v < 0 || SchemaVersion < v {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownSchemaVersion, v)
+	}
+	for ; v < SchemaVersion; v++ {
+		migrations[v](payload)
+	}
+	return versioned(payload), nil
+}
@@ -0,0 +1,45 @@
+package glbr
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// SignalFlushTimeout FlushOnSignalでバッファの送信を待つ最大時間
+var SignalFlushTimeout = 10 * time.Second
+
+// FlushOnSignal sigsを受け取った時にserviceのバッファを送信して閉じてから終了する
+// 終了コードは128+シグナル番号。stopを呼び出すとシグナルの監視をやめる
+//
+//	stop := glbr.FlushOnSignal(service, os.Interrupt, syscall.SIGTERM)
+//	defer stop()
+func FlushOnSignal(service Service, sigs ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		select {
+		case sig := <-ch:
+			c, cancel := context.WithTimeout(context.Background(), SignalFlushTimeout)
+			service.Shutdown(c)
+			cancel()
+			code := 1
+			if s, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(s)
+			}
+			os.Exit(code)
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package glbr
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// Sink Cloud Loggingに加えてエントリを送信する出力先
+// Sendはエントリを出力したgoroutineから呼ばれるため、送信はバッファしてブロックしないようにする
+type Sink interface {
+	Send(logID string, entry logging.Entry)
+	Close() error // Shutdownで呼ばれる。バッファに残ったエントリを送信してから閉じる
+}
+
+// SinkFilter Sinkに送信するエントリの条件
+// 0値の条件は評価しない
+type SinkFilter struct {
+	MinSeverity logging.Severity
+	Labels      map[string]string // 全てのラベルが一致するエントリ
+	LogIDs      []string          // いずれかのlogIDのエントリ
+}
+
+// match エントリが条件を満たすかどうか
+func (f SinkFilter) match(logID string, entry logging.Entry) bool {
+	if entry.Severity < f.MinSeverity {
+		return false
+	}
+	for k, v := range f.Labels {
+		if entry.Labels[k] != v {
+			return false
+		}
+	}
+	return len(f.LogIDs) == 0 || contains(f.LogIDs, logID)
+}
+
+// sinkRoute AddSinkで追加した出力先
+type sinkRoute struct {
+	sink   Sink
+	filter SinkFilter
+}
+
+// AddSink filterを満たすエントリをsinkにも送信する
+// グループの親エントリも送信される。sinkはShutdownで閉じられる
+//
+//	log = log.AddSink(glbr.NewPubSubSink(topic), glbr.SinkFilter{Labels: map[string]string{"security": "true"}})
+func (s Service) AddSink(sink Sink, filter SinkFilter) Service {
+	s.ctx = updateState(s.ctx, func(st *state) {
+		st.sinks = append(append(make([]sinkRoute, 0, len(st.sinks)+1), st.sinks...), sinkRoute{sink: sink, filter: filter})
+	})
+	return s
+}
+
+// forward 出力したエントリをwebhookとsinkに送る
+func (st state) forward(logID string, entry logging.Entry) {
+	if st.notifier != nil {
+		st.notifier.notify(entry)
+	}
+	for _, route := range st.sinks {
+		if route.filter.match(logID, entry) {
+			route.sink.Send(logID, entry)
+		}
+	}
+}
+
+// forwardEntry cの設定でエントリをwebhookとsinkに送る
+func forwardEntry(c context.Context, logID string, entry logging.Entry) {
+	st, _ := getState(c)
+	st.forward(logID, entry)
+}
+
+// SinkRecord Sinkで送信するエントリのJSON表現
+type SinkRecord struct {
+	LogID       string            `json:"log_id"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Severity    string            `json:"severity"`
+	Payload     interface{}       `json:"payload,omitempty"`
+	Trace       string            `json:"trace,omitempty"`
+	SpanID      string            `json:"span_id,omitempty"`
+	InsertID    string            `json:"insert_id,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	HTTPRequest *SinkHTTPRequest  `json:"http_request,omitempty"`
+}
+
+// SinkHTTPRequest グループの親エントリのリクエスト
+type SinkHTTPRequest struct {
+	Method       string  `json:"method"`
+	URL          string  `json:"url"`
+	Status       int     `json:"status"`
+	RequestSize  int64   `json:"request_size,omitempty"`
+	ResponseSize int64   `json:"response_size,omitempty"`
+	Latency      float64 `json:"latency_seconds"`
+	RemoteIP     string  `json:"remote_ip,omitempty"`
+	UserAgent    string  `json:"user_agent,omitempty"`
+}
+
+// NewSinkRecord logIDのエントリをSinkRecordにする
+// 独自のSinkでJSONとして送信する場合に使う
+func NewSinkRecord(logID string, entry logging.Entry) SinkRecord {
+	record := SinkRecord{
+		LogID:     logID,
+		Timestamp: entry.Timestamp.UTC(),
+		Severity:  entry.Severity.String(),
+		Payload:   entry.Payload,
+		Trace:     entry.Trace,
+		SpanID:    entry.SpanID,
+		InsertID:  entry.InsertID,
+		Labels:    entry.Labels,
+	}
+	if r := entry.HTTPRequest; r != nil && r.Request != nil {
+		record.HTTPRequest = &SinkHTTPRequest{
+			Method:       r.Request.Method,
+			URL:          r.Request.URL.String(),
+			Status:       r.Status,
+			RequestSize:  r.RequestSize,
+			ResponseSize: r.ResponseSize,
+			Latency:      r.Latency.Seconds(),
+			RemoteIP:     r.RemoteIP,
+			UserAgent:    r.Request.UserAgent(),
+		}
+	}
+	return record
+}
+
+// closeSinks AddSinkで追加したsinkを閉じる
+func closeSinks(routes []sinkRoute) (err error) {
+	for _, route := range routes {
+		if cerr := route.sink.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return
+}
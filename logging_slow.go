@@ -0,0 +1,110 @@
+package glbr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+const (
+	slowStackLimit   = 32 << 10         // 遅いリクエストのエントリに含めるスタックの最大バイト数
+	slowDumpInterval = 10 * time.Second // 全goroutineのスタックを取得する最短間隔。取得中は全goroutineが停止する
+)
+
+// slowRequest 遅いリクエストのペイロード
+type slowRequest struct {
+	Threshold string `json:"threshold"`
+	Elapsed   string `json:"elapsed"`
+	Stack     string `json:"stack,omitempty"` // handlerのgoroutineのスタック(先頭32KBまで)
+}
+
+// slowWatch WithSlowRequestの設定と、全goroutineのスタックを最後に取得した時刻
+type slowWatch struct {
+	threshold time.Duration
+	mu        sync.Mutex
+	last      time.Time
+}
+
+// WithSlowRequest リクエストの処理がthresholdを超えて続いている場合に、処理の完了を待たずに
+// 途中経過とhandlerのgoroutineのスタックをWarningで子エントリとして出力する
+// スタックの取得には全goroutineの停止を伴うため、取得はservice全体で10秒に1回までで、それ以外のエントリにはスタックを含めない
+// 親エントリには slow_request=true ラベルが付く。0以下で無効 Default: 0
+func (s Service) WithSlowRequest(threshold time.Duration) Service {
+	s.slow = &slowWatch{threshold: threshold}
+	return s
+}
+
+// dump 前回の取得からslowDumpInterval経過していれば、idのgoroutineのスタックを返す
+func (w *slowWatch) dump(now time.Time, id string) string {
+	w.mu.Lock()
+	if !w.last.IsZero() && now.Sub(w.last) < slowDumpInterval {
+		w.mu.Unlock()
+		return ""
+	}
+	w.last = now
+	w.mu.Unlock()
+	stack := goroutineStack(goroutines(goroutineDumpLimit), id)
+	if slowStackLimit < len(stack) {
+		stack = stack[:slowStackLimit]
+	}
+	return stack
+}
+
+// watchSlow 処理がthresholdを超えた時に一度だけ途中経過を出力する
+// handlerのgoroutineから呼び出す。stopは出力中であれば完了を待つ
+func (s Service) watchSlow(c context.Context, st time.Time) (stop func()) {
+	if s.slow == nil || s.slow.threshold <= 0 {
+		return func() {}
+	}
+	threshold := s.slow.threshold
+	id := goroutineID()
+	fired := make(chan struct{})
+	timer := time.AfterFunc(threshold, func() {
+		defer close(fired)
+		elapsed := clockFrom(c).Since(st)
+		Annotate(c, "slow_request", "true")
+		sendPayload(c, logging.Warning, versioned(map[string]interface{}{
+			"message": fmt.Sprintf("request still running after %s", elapsed),
+			"slow_request": slowRequest{
+				Threshold: threshold.String(),
+				Elapsed:   elapsed.String(),
+				Stack:     s.slow.dump(time.Now(), id),
+			},
+		}), nil)
+	})
+	return func() {
+		if !timer.Stop() {
+			<-fired // 出力中のエントリがグループを閉じる前に届くように待つ
+		}
+	}
+}
+
+// goroutineID 呼び出し元のgoroutineのID
+func goroutineID() string {
+	buf := make([]byte, 64)
+	buf = bytes.TrimPrefix(buf[:runtime.Stack(buf, false)], []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); 0 < i {
+		return string(buf[:i])
+	}
+	return ""
+}
+
+// goroutineStack 全goroutineのスタックからidのgoroutineのスタック
+func goroutineStack(dump, id string) string {
+	if id == "" {
+		return ""
+	}
+	prefix := "goroutine " + id + " ["
+	for _, stack := range strings.Split(dump, "\n\n") {
+		if strings.HasPrefix(stack, prefix) {
+			return stack
+		}
+	}
+	return ""
+}
@@ -0,0 +1,34 @@
+package glbr
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// スタックは呼び出したgoroutineのものだけで、取得は間隔をあける
+func TestSlowWatchDump(t *testing.T) {
+	id := goroutineID()
+	if id == "" {
+		t.Fatal("goroutineID is empty")
+	}
+	block := make(chan struct{})
+	defer close(block)
+	go func() { <-block }()
+
+	w := &slowWatch{}
+	now := time.Now()
+	stack := w.dump(now, id)
+	if !strings.HasPrefix(stack, "goroutine "+id+" [") || !strings.Contains(stack, "TestSlowWatchDump") {
+		t.Errorf("stack = %q", stack)
+	}
+	if strings.Contains(stack, "\n\ngoroutine ") {
+		t.Error("stack contains other goroutines")
+	}
+	if stack := w.dump(now.Add(time.Second), id); stack != "" {
+		t.Errorf("dump within interval = %q, want empty", stack)
+	}
+	if stack := w.dump(now.Add(slowDumpInterval), id); stack == "" {
+		t.Error("dump after interval is empty")
+	}
+}
@@ -0,0 +1,69 @@
+package glbr
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"cloud.google.com/go/logging"
+)
+
+// snapshot グループ内で出力された子エントリ
+type snapshot struct {
+	limit   int
+	records []SinkRecord
+	dropped int // limitを超えて記録しなかったエントリ数
+}
+
+// WithSnapshots グループ内で出力された子エントリを先頭からlimit件まで記録し、SnapshotGroupで書き出せるようにする
+// 0以下で無効 Default: 0
+func (s Service) WithSnapshots(limit int) Service {
+	s.snapshotLimit = limit
+	return s
+}
+
+// capture 子エントリを記録する
+func (g *group) capture(logID string, entry logging.Entry) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.snapshot == nil {
+		return
+	}
+	if g.snapshot.limit <= len(g.snapshot.records) {
+		g.snapshot.dropped++
+		return
+	}
+	g.snapshot.records = append(g.snapshot.records, NewSinkRecord(logID, entry))
+}
+
+// SnapshotGroup 現在のリクエストでこれまでに出力された子エントリをSinkRecordのNDJSONとしてwに書き込む
+// サポートの問い合わせにリクエストの全ログを添付する管理用のエンドポイント等で使う。
+// 記録の上限を超えた場合は最後の行に {"dropped": 件数} を書き込む。
+// グループ外、またはWithSnapshotsの指定がない場合はErrSnapshotUnavailableを返す
+//
+//	var buf bytes.Buffer
+//	err := glbr.SnapshotGroup(r.Context(), &buf)
+func SnapshotGroup(c context.Context, w io.Writer) error {
+	g, ok := getGroup(c)
+	if !ok {
+		return ErrSnapshotUnavailable
+	}
+	g.mu.Lock()
+	if g.snapshot == nil {
+		g.mu.Unlock()
+		return ErrSnapshotUnavailable
+	}
+	records := append([]SinkRecord(nil), g.snapshot.records...)
+	dropped := g.snapshot.dropped
+	g.mu.Unlock()
+	enc := json.NewEncoder(w)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	if 0 < dropped {
+		return enc.Encode(map[string]int{"dropped": dropped})
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package glbr
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"cloud.google.com/go/logging"
+)
+
+// serverLogWriter http.Serverのログをエントリとして出力する
+type serverLogWriter struct {
+	c context.Context
+}
+
+func (w serverLogWriter) Write(p []byte) (int, error) {
+	sendPayload(w.c, logging.Warning, strings.TrimRight(string(p), "\n"), map[string]string{"component": "http.Server"})
+	return len(p), nil
+}
+
+// ErrorLog http.Server.ErrorLogに指定するlogger
+// TLSハンドシェイクのエラーやpanic等、サーバーが出力するログをWarningでserviceのlogIDに出力する
+//
+//	server := &http.Server{Addr: ":8080", ErrorLog: service.ErrorLog()}
+func (s Service) ErrorLog() *log.Logger {
+	return log.New(serverLogWriter{c: s.Context()}, "", 0)
+}
@@ -0,0 +1,193 @@
+package glbr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/logging"
+)
+
+// TenantOptions ForTenantで作成するserviceの設定
+type TenantOptions struct {
+	LogIDSuffix bool    // logIDに _{tenantID} を付けて、テナント毎に別のログにする
+	SampleRate  float64 // Error未満のエントリを出力する割合。0以下または1以上で全て出力する
+	Quota       float64 // テナント毎の1秒あたりのエントリ数の上限。0以下で無制限
+}
+
+// tenant テナント毎の状態
+// 同じテナントのForTenantで作成されたserviceで共有する
+type tenant struct {
+	id         string
+	sampleRate float64
+
+	mu     sync.Mutex
+	quota  *bucket
+	policy *TenantPolicy
+}
+
+// tenants テナント毎の状態
+type tenants struct {
+	opts TenantOptions
+
+	mu      sync.Mutex
+	tenants map[string]*tenant
+}
+
+// WithTenantOptions ForTenantで作成するserviceの設定を指定する
+// クォータとポリシーはテナント毎に共有されるため、ForTenant, WithTenantPolicyより先に呼び出す
+func (s Service) WithTenantOptions(opts TenantOptions) Service {
+	s.tenants = &tenants{opts: opts, tenants: map[string]*tenant{}}
+	return s
+}
+
+// ForTenant tenantIDのテナントのエントリを出力するserviceを返す
+// エントリと親エントリにはtenantラベルが付く。WithTenantOptionsでlogIDの分離、サンプリング、クォータを指定できる
+//
+//	glbr.Infof(log.ForTenant("tenant-a").Context(), "message")
+func (s Service) ForTenant(tenantID string) Service {
+	opts := TenantOptions{}
+	if s.tenants != nil {
+		opts = s.tenants.opts
+	}
+	if opts.LogIDSuffix {
+		logID := s.logID + "_" + tenantID
+		if err := validateLogID(logID); err != nil {
+			panic(err)
+		}
+		s.logID = logID
+	}
+	s.ctx = updateState(s.ctx, func(st *state) { st.tenant = s.tenants.get(tenantID) })
+	return s
+}
+
+// get tenantIDの状態を返す
+func (ts *tenants) get(tenantID string) *tenant {
+	if ts == nil {
+		return &tenant{id: tenantID}
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	t, ok := ts.tenants[tenantID]
+	if !ok {
+		t = &tenant{id: tenantID, sampleRate: ts.opts.SampleRate}
+		if 0 < ts.opts.Quota {
+			t.quota = newBucket(ts.opts.Quota)
+		}
+		ts.tenants[tenantID] = t
+	}
+	return t
+}
+
+// allow テナントのラベルを付け、サンプリングとクォータを適用する
+// 出力しない場合はfalseを返す
+func (t *tenant) allow(c context.Context, entry *logging.Entry) bool {
+	if !t.apply(entry) {
+		return false
+	}
+	if entry.Severity < logging.Error && 0 < t.sampleRate && t.sampleRate < 1 && t.sampleRate <= rand.Float64() {
+		return false
+	}
+	if t.quota == nil {
+		return true
+	}
+	t.mu.Lock()
+	ok, dropped := t.quota.take(clockFrom(c).Now())
+	t.mu.Unlock()
+	if 0 < dropped {
+		push(c, logging.Entry{
+			Payload: fmt.Sprintf("%d entries of tenant %s dropped by quota", dropped, t.id),
+			Labels: map[string]string{
+				"tenant":        t.id,
+				"dropped_count": strconv.Itoa(dropped),
+			},
+			Severity:  logging.Warning,
+			Trace:     entry.Trace,
+			Timestamp: entry.Timestamp,
+		})
+	}
+	return ok
+}
+
+// TenantPolicy テナント毎のデータ処理の取り決め
+type TenantPolicy struct {
+	MinSeverity logging.Severity // これより低いseverityのエントリは出力しない
+	DropFields  []string         // ペイロードのフィールドとラベルから除くキー。ペイロードは user.email のように.区切りで指定できる
+}
+
+// WithTenantPolicy tenantIDのテナントのエントリと親エントリにpolicyを適用する
+// 顧客毎に異なるデータ処理の取り決めに合わせて、出力するseverityや除くフィールドを指定する
+//
+//	log = log.WithTenantOptions(opts).WithTenantPolicy("tenant-a", glbr.TenantPolicy{DropFields: []string{"user.email"}})
+func (s Service) WithTenantPolicy(tenantID string, policy TenantPolicy) Service {
+	if s.tenants == nil {
+		s.tenants = &tenants{tenants: map[string]*tenant{}}
+	}
+	t := s.tenants.get(tenantID)
+	t.mu.Lock()
+	t.policy = &policy
+	t.mu.Unlock()
+	return s
+}
+
+// apply テナントのラベルを付け、ポリシーを適用する
+// ポリシーにより出力しない場合はfalseを返す
+func (t *tenant) apply(entry *logging.Entry) bool {
+	t.mu.Lock()
+	policy := t.policy
+	t.mu.Unlock()
+	if entry.Labels == nil {
+		entry.Labels = map[string]string{}
+	}
+	entry.Labels["tenant"] = t.id
+	if policy == nil {
+		return true
+	}
+	if entry.Severity < policy.MinSeverity {
+		return false
+	}
+	if len(policy.DropFields) == 0 {
+		return true
+	}
+	for _, field := range policy.DropFields {
+		delete(entry.Labels, field)
+	}
+	entry.Payload = dropFields(entry.Payload, policy.DropFields)
+	return true
+}
+
+// dropFields ペイロードからfieldsを除く
+// 文字列のペイロードはそのまま返す
+func dropFields(payload interface{}, fields []string) interface{} {
+	if _, ok := payload.(string); ok || payload == nil {
+		return payload
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return payload
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return payload
+	}
+	for _, field := range fields {
+		path := strings.Split(field, ".")
+		parent := m
+		for _, key := range path[:len(path)-1] {
+			child, ok := parent[key].(map[string]interface{})
+			if !ok {
+				parent = nil
+				break
+			}
+			parent = child
+		}
+		if parent != nil {
+			delete(parent, path[len(path)-1])
+		}
+	}
+	return m
+}
@@ -0,0 +1,112 @@
+package glbr
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestTenantPolicy(t *testing.T) {
+	s, rec, err := NewRecorder("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = s.WithTenantOptions(TenantOptions{LogIDSuffix: true}).
+		WithTenantPolicy("a", TenantPolicy{MinSeverity: logging.Warning})
+	a, b := s.ForTenant("a"), s.ForTenant("b")
+	Infof(a.Context(), "dropped by policy")
+	Warningf(a.Context(), "kept")
+	Infof(b.Context(), "no policy")
+
+	if got := rec.Entries("app_a"); len(got) != 1 || got[0].Payload != "kept" || got[0].Labels["tenant"] != "a" {
+		t.Errorf("tenant a entries = %v", got)
+	}
+	if got := rec.Entries("app_b"); len(got) != 1 || got[0].Labels["tenant"] != "b" {
+		t.Errorf("tenant b entries = %v", got)
+	}
+	if got := rec.Entries("app"); len(got) != 0 {
+		t.Errorf("entries without the tenant suffix = %v", got)
+	}
+
+	// 親エントリにもポリシーが適用される
+	a.GroupedBy("parent")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got := rec.Entries("parent"); len(got) != 0 {
+		t.Errorf("Info parent of tenant a = %v, want dropped", got)
+	}
+	a.GroupedBy("parent")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Errorf(r.Context(), "failed")
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got := rec.Entries("parent"); len(got) != 1 || got[0].Labels["tenant"] != "a" {
+		t.Errorf("Error parent of tenant a = %v", got)
+	}
+}
+
+func TestTenantPolicyDropFields(t *testing.T) {
+	tn := &tenant{id: "a", policy: &TenantPolicy{DropFields: []string{"user.email", "token", "ip"}}}
+	entry := logging.Entry{
+		Payload: map[string]interface{}{
+			"user":  map[string]interface{}{"id": "u1", "email": "a@example.com"},
+			"token": "secret",
+			"count": 1,
+		},
+		Labels: map[string]string{"ip": "198.51.100.7", "route": "/"},
+	}
+	if !tn.apply(&entry) {
+		t.Fatal("entry is dropped")
+	}
+	want := map[string]interface{}{"user": map[string]interface{}{"id": "u1"}, "count": float64(1)}
+	if !reflect.DeepEqual(entry.Payload, want) {
+		t.Errorf("payload = %v, want %v", entry.Payload, want)
+	}
+	if !reflect.DeepEqual(entry.Labels, map[string]string{"route": "/", "tenant": "a"}) {
+		t.Errorf("labels = %v", entry.Labels)
+	}
+
+	text := logging.Entry{Payload: "user.email a@example.com"}
+	tn.apply(&text)
+	if text.Payload != "user.email a@example.com" {
+		t.Errorf("string payload = %v, want unchanged", text.Payload)
+	}
+}
+
+func TestForTenantInvalidLogID(t *testing.T) {
+	s, _, err := NewRecorder("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrInvalidLogID) {
+			t.Errorf("recovered = %v, want ErrInvalidLogID", err)
+		}
+	}()
+	s.WithTenantOptions(TenantOptions{LogIDSuffix: true}).ForTenant("a b")
+}
+
+// テナントのクォータはWithClockのClockで補充される
+func TestTenantQuotaClock(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}
+	s, rec, err := NewRecorder("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := s.WithClock(clock).WithTenantOptions(TenantOptions{Quota: 1}).ForTenant("a").Context()
+	Infof(c, "first")
+	Infof(c, "over quota")
+	if got := len(rec.Entries("app")); got != 1 {
+		t.Fatalf("entries before advance = %d, want 1", got)
+	}
+	clock.advance(time.Second)
+	Infof(c, "second")
+	entries := rec.Entries("app")
+	if len(entries) != 3 {
+		t.Fatalf("entries after advance = %d, want the entry and the dropped report", len(entries))
+	}
+	if report := entries[1]; report.Labels["dropped_count"] != "1" || report.Labels["tenant"] != "a" {
+		t.Errorf("report labels = %v", report.Labels)
+	}
+}
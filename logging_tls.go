@@ -0,0 +1,62 @@
+package glbr
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// WithConnInfo 親エントリにTLSとコネクションの情報をラベルとして付加する
+// tls_version, tls_cipher, tls_sni, tls_alpn, tls_resumed
+// http.Server.ConnContextにConnContextを指定した場合は conn_requests, conn_reused も付加する
+func (s Service) WithConnInfo() Service {
+	s.connInfo = true
+	return s
+}
+
+// connState コネクション単位の状態
+type connState struct {
+	requests int64
+}
+
+// ConnContext http.Server.ConnContextに指定し、コネクションの再利用を記録する
+//
+//	server := &http.Server{Addr: ":8080", ConnContext: glbr.ConnContext}
+func ConnContext(c context.Context, conn net.Conn) context.Context {
+	return context.WithValue(c, &connKey, &connState{})
+}
+
+// tlsVersions tls.ConnectionState.Versionの名前
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS1.0",
+	tls.VersionTLS11: "TLS1.1",
+	tls.VersionTLS12: "TLS1.2",
+	tls.VersionTLS13: "TLS1.3",
+}
+
+// connLabels TLSとコネクションの情報をラベルにする
+func (s Service) connLabels(labels map[string]string, r *http.Request) {
+	if !s.connInfo {
+		return
+	}
+	if state := r.TLS; state != nil {
+		version, ok := tlsVersions[state.Version]
+		if !ok {
+			version = fmt.Sprintf("0x%04x", state.Version)
+		}
+		labels["tls_version"] = version
+		labels["tls_cipher"] = tls.CipherSuiteName(state.CipherSuite)
+		labels["tls_sni"] = state.ServerName
+		labels["tls_alpn"] = state.NegotiatedProtocol
+		labels["tls_resumed"] = strconv.FormatBool(state.DidResume)
+	}
+	if conn, ok := r.Context().Value(&connKey).(*connState); ok {
+		n := atomic.AddInt64(&conn.requests, 1)
+		labels["conn_requests"] = strconv.FormatInt(n, 10)
+		labels["conn_reused"] = strconv.FormatBool(1 < n)
+	}
+}
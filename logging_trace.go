@@ -0,0 +1,68 @@
+package glbr
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+
+	"cloud.google.com/go/logging"
+)
+
+// span 他のシステムから引き継いだtraceのspan
+type span struct {
+	id      string
+	sampled bool
+}
+
+// WithTrace 既存のtraceにエントリを関連付けたcontextを返す
+// キューのコンシューマーやCLI等、HTTP以外の入口で他のシステムから受け取ったtraceを引き継ぐ場合に使う
+// logging.EntryにTraceSampledがないため、sampledはtrace_sampledラベルとして出力される
+//
+//	c = glbr.WithTrace(log.Context(), msg.Attributes["trace"], msg.Attributes["span"], true)
+func WithTrace(c context.Context, traceID, spanID string, sampled bool) context.Context {
+	if c == nil {
+		panic(ErrNilContext)
+	}
+	return updateState(c, func(st *state) {
+		st.traceID = &traceID
+		st.span = &span{id: spanID, sampled: sampled}
+	})
+}
+
+// WithEntrySpans グループの親エントリと子エントリ毎に異なるSpanIDを付ける
+// Traceの画面でエントリが1つのspanに重ならず、別々のspanとして表示される。WithTraceで指定されたspanが優先される
+func (s Service) WithEntrySpans() Service {
+	s.ctx = updateState(s.ctx, func(st *state) { st.entrySpans = true })
+	return s
+}
+
+// newSpanID 新しいSpanID(16桁の16進数)
+func newSpanID() string {
+	return fmt.Sprintf("%016x", newSpanIDValue())
+}
+
+// newSpanIDValue 0以外の乱数
+func newSpanIDValue() uint64 {
+	for {
+		if v := rand.Uint64(); v != 0 {
+			return v
+		}
+	}
+}
+
+// applySpan WithTraceで指定されたspan、またはWithEntrySpansで新しいSpanIDをエントリに設定する
+func applySpan(c context.Context, entry *logging.Entry) {
+	st, _ := getState(c)
+	if st.span == nil {
+		if st.entrySpans {
+			entry.SpanID = newSpanID()
+		}
+		return
+	}
+	entry.SpanID = st.span.id
+	if entry.Labels == nil {
+		entry.Labels = map[string]string{}
+	}
+	entry.Labels["trace_sampled"] = strconv.FormatBool(st.span.sampled)
+}
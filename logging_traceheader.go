@@ -0,0 +1,193 @@
+package glbr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/logging"
+)
+
+// UnsampledPolicy 呼び出し元でサンプリングされなかったリクエストの扱い
+type UnsampledPolicy struct {
+	MinSeverity logging.Severity // 子エントリの最低severity。WithMinSeverityより低い場合は無視される
+	SkipLinking bool             // spanを送信せず、エントリにSpanIDを付けない
+}
+
+// WithTraceHeaders リクエストのX-Cloud-Trace-ContextまたはtraceparentヘッダーのtraceをグループのTraceIDとして引き継ぐ
+// サンプリングされていないtraceのリクエストにはunsampledを適用する。親エントリにはtrace_sampledラベルが付く
+// 同じサンプリングの判断はInjectTrace, Transportで呼び出し先に伝える
+func (s Service) WithTraceHeaders(unsampled UnsampledPolicy) Service {
+	s.traceHeaders = &unsampled
+	return s
+}
+
+// incomingTrace リクエストヘッダーのtrace
+type incomingTrace struct {
+	traceID string
+	spanID  string // 16桁の16進数
+	sampled bool
+}
+
+// parseTraceHeaders traceparent, X-Cloud-Trace-Contextの順にtraceを取り出す
+// IDが16進数でない、長さが違う、全て0の場合はそのヘッダーを無視する。どちらも無効な場合はfalse
+//
+//	traceparent: 00-{trace-id}-{parent-id}-{flags}
+//	X-Cloud-Trace-Context: {TRACE_ID}/{SPAN_ID(10進数)};o={TRACE_TRUE}
+func parseTraceHeaders(h http.Header) (incomingTrace, bool) {
+	if v := h.Get("traceparent"); v != "" {
+		parts := strings.Split(v, "-")
+		if len(parts) == 4 && validTraceHex(parts[0], 2) && parts[0] != "ff" && validTraceID(parts[1], 32) && validTraceID(parts[2], 16) && validTraceHex(parts[3], 2) {
+			flags, _ := strconv.ParseUint(parts[3], 16, 8)
+			return incomingTrace{traceID: parts[1], spanID: parts[2], sampled: flags&1 == 1}, true
+		}
+	}
+	if v := h.Get("X-Cloud-Trace-Context"); v != "" {
+		in := incomingTrace{sampled: true}
+		if i := strings.Index(v, ";"); 0 <= i {
+			in.sampled = !strings.Contains(v[i:], "o=0")
+			v = v[:i]
+		}
+		if i := strings.Index(v, "/"); 0 <= i {
+			if n, err := strconv.ParseUint(v[i+1:], 10, 64); err == nil && n != 0 {
+				in.spanID = fmt.Sprintf("%016x", n)
+			}
+			v = v[:i]
+		}
+		if v = strings.ToLower(v); validTraceID(v, 32) {
+			in.traceID = v
+			return in, true
+		}
+	}
+	return incomingTrace{}, false
+}
+
+// validTraceHex sがn桁の小文字の16進数かどうか
+func validTraceHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// validTraceID sがn桁の小文字の16進数で、全て0ではないかどうか
+func validTraceID(s string, n int) bool {
+	return validTraceHex(s, n) && strings.Trim(s, "0") != ""
+}
+
+// newRequestGroup リクエストのグループを作成する
+// WithTraceHeadersの指定があればリクエストヘッダーのtraceを引き継ぐ
+func (s Service) newRequestGroup(r *http.Request) (*group, *tracer) {
+	traceID := traceIDFrom(s.ctx)
+	in, traced := incomingTrace{}, false
+	if s.traceHeaders != nil {
+		if in, traced = parseTraceHeaders(r.Header); traced {
+			traceID = in.traceID
+		}
+	}
+	tr := getTracer(s.ctx)
+	if tr != nil {
+		traceID = tr.traceName(traceID)
+	}
+	g := newGroup(traceID)
+	if traced {
+		g.traced, g.sampled, g.remoteSpanID = true, in.sampled, in.spanID
+	}
+	if s.debugBuffer != nil {
+		g.debug = &debugBuffer{size: s.debugBuffer.size}
+	}
+	if s.canonical {
+		g.canonical = &canonicalLine{}
+	}
+	g.fieldPolicy = s.fieldPolicy
+	if 0 < s.snapshotLimit {
+		g.snapshot = &snapshot{limit: s.snapshotLimit}
+	}
+	if s.escalation != nil {
+		g.escalation, g.escalated = s.escalation, newEscalationState(s.escalation)
+	}
+	skip := !g.sampled && s.traceHeaders.SkipLinking
+	if st, _ := getState(s.ctx); (st.entrySpans || tr != nil) && !skip {
+		g.spanID = newSpanID()
+	}
+	return g, tr
+}
+
+// applySampling サンプリングされていないtraceのグループにUnsampledPolicyを適用する
+func (s Service) applySampling(st *state, g *group) {
+	if g.sampled || s.traceHeaders == nil {
+		return
+	}
+	if st.minimum < s.traceHeaders.MinSeverity {
+		st.minimum = s.traceHeaders.MinSeverity
+	}
+	if s.traceHeaders.SkipLinking {
+		st.entrySpans = false
+	}
+}
+
+// InjectTrace cのtraceとサンプリングの判断を呼び出し先へのリクエストヘッダーに設定する
+// traceparentとX-Cloud-Trace-Contextの両方を設定する。traceがない場合は何もしない
+func InjectTrace(c context.Context, h http.Header) {
+	st, _ := getState(c)
+	if st.traceID == nil {
+		return
+	}
+	traceID := spanTraceID(*st.traceID)
+	if len(traceID) != 32 {
+		return
+	}
+	sampled := true
+	var spanID string
+	switch {
+	case st.span != nil:
+		spanID, sampled = st.span.id, st.span.sampled
+	case st.group != nil:
+		spanID, sampled = st.group.spanID, st.group.sampled
+		if spanID == "" {
+			spanID = st.group.remoteSpanID
+		}
+	}
+	if spanID == "" {
+		spanID = newSpanID()
+	}
+	flags, o := "00", "0"
+	if sampled {
+		flags, o = "01", "1"
+	}
+	h.Set("traceparent", "00-"+traceID+"-"+spanID+"-"+flags)
+	if n, err := strconv.ParseUint(spanID, 16, 64); err == nil {
+		h.Set("X-Cloud-Trace-Context", traceID+"/"+strconv.FormatUint(n, 10)+";o="+o)
+	}
+}
+
+// traceTransport 呼び出し先へのリクエストにtraceとbaggageを設定する
+type traceTransport struct {
+	base http.RoundTripper
+}
+
+func (t traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	InjectTrace(req.Context(), req.Header)
+	InjectBaggage(req.Context(), req.Header)
+	return t.base.RoundTrip(req)
+}
+
+// Transport リクエストのcontextのtraceとbaggageを呼び出し先に伝えるhttp.RoundTripper
+// baseがnilの場合はhttp.DefaultTransportを使う
+//
+//	client := &http.Client{Transport: glbr.Transport(nil)}
+//	req, _ := http.NewRequestWithContext(r.Context(), "GET", url, nil)
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return traceTransport{base: base}
+}
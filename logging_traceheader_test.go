@@ -0,0 +1,60 @@
+package glbr
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseTraceHeaders(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   incomingTrace
+		ok     bool
+	}{
+		{"traceparent", map[string]string{"traceparent": "00-" + traceID + "-" + spanID + "-01"}, incomingTrace{traceID: traceID, spanID: spanID, sampled: true}, true},
+		{"traceparent unsampled", map[string]string{"traceparent": "00-" + traceID + "-" + spanID + "-00"}, incomingTrace{traceID: traceID, spanID: spanID}, true},
+		{"traceparent zero trace id", map[string]string{"traceparent": "00-00000000000000000000000000000000-" + spanID + "-01"}, incomingTrace{}, false},
+		{"traceparent zero parent id", map[string]string{"traceparent": "00-" + traceID + "-0000000000000000-01"}, incomingTrace{}, false},
+		{"traceparent not hex", map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e473z-" + spanID + "-01"}, incomingTrace{}, false},
+		{"traceparent uppercase", map[string]string{"traceparent": "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + spanID + "-01"}, incomingTrace{}, false},
+		{"traceparent short", map[string]string{"traceparent": "00-" + traceID[:31] + "-" + spanID + "-01"}, incomingTrace{}, false},
+		{"traceparent invalid version", map[string]string{"traceparent": "ff-" + traceID + "-" + spanID + "-01"}, incomingTrace{}, false},
+		{"traceparent invalid flags", map[string]string{"traceparent": "00-" + traceID + "-" + spanID + "-x1"}, incomingTrace{}, false},
+		{"invalid traceparent falls back", map[string]string{"traceparent": "00-zz-" + spanID + "-01", "X-Cloud-Trace-Context": traceID + "/1;o=1"}, incomingTrace{traceID: traceID, spanID: "0000000000000001", sampled: true}, true},
+		{"cloud trace", map[string]string{"X-Cloud-Trace-Context": traceID + "/1234;o=0"}, incomingTrace{traceID: traceID, spanID: "00000000000004d2"}, true},
+		{"cloud trace without span", map[string]string{"X-Cloud-Trace-Context": traceID}, incomingTrace{traceID: traceID, sampled: true}, true},
+		{"cloud trace uppercase", map[string]string{"X-Cloud-Trace-Context": "4BF92F3577B34DA6A3CE929D0E0E4736/1"}, incomingTrace{traceID: traceID, spanID: "0000000000000001", sampled: true}, true},
+		{"cloud trace zero", map[string]string{"X-Cloud-Trace-Context": "00000000000000000000000000000000/1;o=1"}, incomingTrace{}, false},
+		{"cloud trace not hex", map[string]string{"X-Cloud-Trace-Context": "not-a-trace/1;o=1"}, incomingTrace{}, false},
+		{"cloud trace too long", map[string]string{"X-Cloud-Trace-Context": traceID + "00/1"}, incomingTrace{}, false},
+		{"none", nil, incomingTrace{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.header {
+				h.Set(k, v)
+			}
+			got, ok := parseTraceHeaders(h)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("parseTraceHeaders = %+v, %v, want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// 無効なtraceのヘッダーは引き継がず、新しいTraceIDを生成する
+func TestNewRequestGroupInvalidTrace(t *testing.T) {
+	s := NewNoOp().WithTraceHeaders(UnsampledPolicy{})
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Cloud-Trace-Context", "00000000000000000000000000000000/1;o=1")
+	g, _ := s.newRequestGroup(r)
+	if g.traced || g.id == "" || g.id == "00000000000000000000000000000000" {
+		t.Errorf("group traced = %v, id = %q, want a new trace ID", g.traced, g.id)
+	}
+}
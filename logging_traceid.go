@@ -0,0 +1,53 @@
+package glbr
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+)
+
+// TraceIDGenerator 新しいTraceIDを返す
+// 複数のgoroutineから呼ばれる
+type TraceIDGenerator func() string
+
+// WithTraceIDGenerator グループやグループ外のエントリに付けるTraceIDの生成方法を指定する
+// golden fileを使うテストやサンプルの出力を固定する場合に使う Default: ランダムな値
+//
+//	log = log.WithTraceIDGenerator(glbr.SequentialTraceIDs(1))
+func (s Service) WithTraceIDGenerator(gen TraceIDGenerator) Service {
+	s.ctx = setTraceIDGenerator(s.ctx, gen)
+	return s
+}
+
+// SequentialTraceIDs start, start+1, ...の順にTraceIDを返す
+func SequentialTraceIDs(start uint64) TraceIDGenerator {
+	next := start - 1
+	return func() string {
+		return strconv.FormatUint(atomic.AddUint64(&next, 1), 10)
+	}
+}
+
+// FixedTraceIDs idsを順に返し、最後の値を返し続ける
+// idsが空の場合はErrEmptyTraceIDsでpanicする
+func FixedTraceIDs(ids ...string) TraceIDGenerator {
+	if len(ids) == 0 {
+		panic(ErrEmptyTraceIDs)
+	}
+	var n uint64
+	return func() string {
+		i := atomic.AddUint64(&n, 1) - 1
+		if uint64(len(ids)) <= i {
+			i = uint64(len(ids) - 1)
+		}
+		return ids[i]
+	}
+}
+
+// traceIDFrom cに設定された生成方法で新しいTraceIDを返す
+func traceIDFrom(c context.Context) string {
+	st, _ := getState(c)
+	if st.traceIDs == nil {
+		return newTraceID()
+	}
+	return st.traceIDs()
+}
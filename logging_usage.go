@@ -0,0 +1,160 @@
+package glbr
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// entryOverhead タイムスタンプやlogName等、ペイロード以外の推定サイズ
+const entryOverhead = 128
+
+// usage logID毎の本日(UTC)の推定取り込みバイト数
+type usage struct {
+	mu       sync.Mutex
+	day      string
+	bytes    map[string]int64
+	budget   int64
+	notify   func(usage map[string]int64)
+	notified bool
+	metered  bool            // WithUsageMeter, WithBudgetで推定サイズを集計する
+	pending  map[string]bool // Flushされていないエントリがある可能性のあるlogID
+}
+
+func newUsage() *usage {
+	return &usage{bytes: map[string]int64{}, pending: map[string]bool{}}
+}
+
+// usageMeter logIDの取り込みバイト数を集計する
+type usageMeter struct {
+	usage *usage
+	logID string
+}
+
+func (m usageMeter) add(entry logging.Entry) {
+	m.usage.add(m.logID, entry)
+}
+
+// add エントリの推定サイズを集計し、予算を超えた場合は1日1回だけ通知する
+// 推定サイズはペイロードをJSONに変換して求めるため、集計が有効な場合だけ計算する
+func (u *usage) add(logID string, entry logging.Entry) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	u.pending[logID] = true
+	metered := u.metered
+	u.mu.Unlock()
+	if !metered {
+		return
+	}
+	size := entrySize(entry)
+	u.mu.Lock()
+	u.rotate(time.Now())
+	u.bytes[logID] += size
+	var snapshot map[string]int64
+	if 0 < u.budget && u.notify != nil && !u.notified && u.budget < u.totalLocked() {
+		u.notified = true
+		snapshot = u.snapshotLocked()
+	}
+	notify := u.notify
+	u.mu.Unlock()
+	if snapshot != nil {
+		notify(snapshot)
+	}
+}
+
+// flushed logIDのFlushが完了した
+func (u *usage) flushed(logID string) {
+	u.mu.Lock()
+	delete(u.pending, logID)
+	u.mu.Unlock()
+}
+
+// pendingLogIDs Flushされていないエントリがある可能性のあるlogID
+// バッファ内のエントリ数はloggingパッケージから取得できないため、logIDだけを返す
+func (u *usage) pendingLogIDs() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	logIDs := make([]string, 0, len(u.pending))
+	for logID := range u.pending {
+		logIDs = append(logIDs, logID)
+	}
+	sort.Strings(logIDs)
+	return logIDs
+}
+
+// rotate 日付が変わった場合は集計をリセットする
+func (u *usage) rotate(now time.Time) {
+	if day := now.UTC().Format("2006-01-02"); u.day != day {
+		u.day = day
+		u.bytes = map[string]int64{}
+		u.notified = false
+	}
+}
+
+func (u *usage) totalLocked() (total int64) {
+	for _, b := range u.bytes {
+		total += b
+	}
+	return
+}
+
+func (u *usage) snapshotLocked() map[string]int64 {
+	snapshot := make(map[string]int64, len(u.bytes))
+	for k, v := range u.bytes {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+// entrySize エントリの推定サイズ
+func entrySize(entry logging.Entry) int64 {
+	size := int64(entryOverhead + len(entry.Trace) + len(entry.InsertID))
+	switch p := entry.Payload.(type) {
+	case nil:
+	case string:
+		size += int64(len(p))
+	default:
+		b, _ := json.Marshal(p)
+		size += int64(len(b))
+	}
+	for k, v := range entry.Labels {
+		size += int64(len(k) + len(v))
+	}
+	if r := entry.HTTPRequest; r != nil && r.Request != nil {
+		size += int64(len(r.Request.Method) + len(r.Request.URL.String()) + len(r.Request.UserAgent()) + len(r.Request.Referer()))
+	}
+	return size
+}
+
+// Usage logID毎の本日(UTC)の推定取り込みバイト数
+// WithUsageMeterまたはWithBudgetを設定していない場合は空
+func (s Service) Usage() map[string]int64 {
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+	s.usage.rotate(time.Now())
+	return s.usage.snapshotLocked()
+}
+
+// WithUsageMeter logID毎の推定取り込みバイト数を集計し、Usageで取得できるようにする
+func (s Service) WithUsageMeter() Service {
+	s.usage.mu.Lock()
+	s.usage.metered = true
+	s.usage.mu.Unlock()
+	return s
+}
+
+// WithBudget 1日(UTC)あたりの推定取り込みバイト数の合計がdailyBytesを超えた時にnotifyを呼び出す
+// notifyは1日に1回だけ呼び出される。WithUsageMeterも有効になる
+func (s Service) WithBudget(dailyBytes int64, notify func(usage map[string]int64)) Service {
+	s.usage.mu.Lock()
+	s.usage.budget = dailyBytes
+	s.usage.notify = notify
+	s.usage.metered = true
+	s.usage.mu.Unlock()
+	return s
+}
@@ -0,0 +1,21 @@
+package glbr
+
+import (
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+// 集計が有効でない場合はサイズを計算しない
+func TestUsageMetered(t *testing.T) {
+	u := newUsage()
+	u.add("app", logging.Entry{Payload: "entry"})
+	if len(u.bytes) != 0 || !u.pending["app"] {
+		t.Errorf("unmetered usage = %v, pending = %v", u.bytes, u.pending)
+	}
+	s := Service{usage: u}.WithUsageMeter()
+	u.add("app", logging.Entry{Payload: "entry"})
+	if got := s.Usage()["app"]; got != entryOverhead+5 {
+		t.Errorf("usage = %d, want %d", got, entryOverhead+5)
+	}
+}
@@ -0,0 +1,84 @@
+package glbr
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#FIELDS.log_name
+	logIDPattern = regexp.MustCompile(`^[A-Za-z0-9/_\-.]+$`)
+	// https://cloud.google.com/resource-manager/docs/creating-managing-projects
+	projectIDPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+	// folders/{数字}, organizations/{数字}, billingAccounts/{XXXXXX-XXXXXX-XXXXXX}
+	parentPattern = regexp.MustCompile(`^((folders|organizations)/[0-9]+|billingAccounts/[0-9A-F]{6}-[0-9A-F]{6}-[0-9A-F]{6})$`)
+)
+
+// validateLogID logIDに使用できない文字が含まれていないか確認する
+// 英数字、スラッシュ、アンダースコア、ハイフン、ピリオドのみ使用できる
+func validateLogID(logID string) error {
+	if logID == "" {
+		return ErrEmptyLogID
+	}
+	if 512 <= len(logID) {
+		return ErrLogIDTooLong
+	}
+	if !logIDPattern.MatchString(logID) {
+		return fmt.Errorf("%w: %q may only contain alphanumerics, '/', '_', '-' and '.'", ErrInvalidLogID, logID)
+	}
+	return nil
+}
+
+// validateProjectID projectID、またはFolder, Organization, BillingAccountの書き込み先の形式を確認する
+func validateProjectID(projectID string) error {
+	if id, ok := parentProject(projectID); ok && !projectIDPattern.MatchString(id) {
+		return fmt.Errorf("%w: %q must be 6 to 30 lowercase letters, digits, or hyphens, starting with a letter", ErrInvalidProjectID, projectID)
+	} else if !ok && !parentPattern.MatchString(projectID) {
+		return fmt.Errorf("%w: %q must be a projectID or folders/{id}, organizations/{id}, billingAccounts/{id}", ErrInvalidProjectID, projectID)
+	}
+	return nil
+}
+
+// Validate projectID(またはFolder, Organization, BillingAccountの書き込み先)の形式、認証情報、書き込み権限を確認する
+// WithCMEKの指定がある場合はバケットの暗号鍵も確認する
+func (s Service) Validate(c context.Context) error {
+	if s.client == nil {
+		return nil // NewLocal
+	}
+	projectID := s.proto.projectID
+	if err := validateProjectID(projectID); err != nil {
+		return err
+	}
+	if err := s.client.Ping(c); err != nil {
+		switch status.Code(err) {
+		case codes.Unauthenticated:
+			return fmt.Errorf("credentials are invalid: %w", err)
+		case codes.PermissionDenied:
+			return fmt.Errorf("credentials lack logging.logEntries.create on project %q: %w", projectID, err)
+		case codes.NotFound:
+			return fmt.Errorf("project %q not found: %w", projectID, err)
+		default:
+			return fmt.Errorf("logging ping failed: %w", err)
+		}
+	}
+	return s.validateCMEK(c)
+}
+
+// NewValidatedLogging NewLoggingで取得したserviceをValidateで確認してから返す
+// 確認に失敗した場合はserviceを閉じる
+func NewValidatedLogging(c context.Context, projectID, logID string, opts ...option.ClientOption) (Service, error) {
+	service, err := NewLogging(projectID, logID, opts...)
+	if err != nil {
+		return Service{}, err
+	}
+	if err := service.Validate(c); err != nil {
+		service.Close()
+		return Service{}, err
+	}
+	return service, nil
+}
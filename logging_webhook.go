@@ -0,0 +1,220 @@
+package glbr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// Notification WithWebhookで通知するエントリ
+type Notification struct {
+	Severity   logging.Severity
+	Message    string // 文字列のペイロード、またはペイロードのmessage。親エントリの場合は先頭に"{method} {url} {status}"が付く
+	Trace      string
+	Timestamp  time.Time
+	Suppressed int // 前回の通知以降、送信間隔の制限により通知しなかったエントリ数
+}
+
+// WebhookFormat 通知をwebhookにPOSTするJSONのボディにする
+type WebhookFormat func(n Notification) interface{}
+
+// SlackWebhook SlackのIncoming Webhookの形式 {"text": "..."}
+func SlackWebhook(n Notification) interface{} {
+	text := fmt.Sprintf("*%s* %s", n.Severity, n.Message)
+	if n.Trace != "" {
+		text += "\ntrace: " + n.Trace
+	}
+	if 0 < n.Suppressed {
+		text += fmt.Sprintf("\n(%d more suppressed)", n.Suppressed)
+	}
+	return map[string]string{"text": text}
+}
+
+// PagerDutyWebhook PagerDuty Events API v2の形式
+// routingKeyはインテグレーションキー、sourceはイベントの発生元(サービス名等)
+func PagerDutyWebhook(routingKey, source string) WebhookFormat {
+	return func(n Notification) interface{} {
+		severity := "error"
+		switch {
+		case logging.Critical <= n.Severity:
+			severity = "critical"
+		case n.Severity < logging.Warning:
+			severity = "info"
+		case n.Severity < logging.Error:
+			severity = "warning"
+		}
+		summary := n.Message
+		if 1024 < len(summary) {
+			summary = summary[:1024]
+		}
+		return map[string]interface{}{
+			"routing_key":  routingKey,
+			"event_action": "trigger",
+			"payload": map[string]interface{}{
+				"summary":   summary,
+				"source":    source,
+				"severity":  severity,
+				"timestamp": n.Timestamp.Format(time.RFC3339Nano),
+				"custom_details": map[string]interface{}{
+					"trace":      n.Trace,
+					"suppressed": n.Suppressed,
+				},
+			},
+		}
+	}
+}
+
+// WebhookOptions WithWebhookの設定
+type WebhookOptions struct {
+	MinSeverity logging.Severity // 通知するエントリの最低severity Default: logging.Critical
+	Interval    time.Duration    // 通知の最小間隔 Default: 1分
+	DedupWindow time.Duration    // 同じseverity、同じメッセージを再び通知しない期間 Default: 1時間
+	Format      WebhookFormat    // Default: SlackWebhook
+	Client      *http.Client     // Default: http.DefaultClient
+	Timeout     time.Duration    // 1回の送信の制限時間 Default: 10秒
+}
+
+// WithWebhook MinSeverity以上のエントリが出力された時にurlへ通知をPOSTする
+// 専用のアラートの仕組みを持たない小さなチーム向け。通知は非同期に送信し、失敗した場合は標準のloggerに出力する
+// Intervalより短い間隔の通知は送信せずに数え、次の通知のSuppressedとして報告する。Shutdownは送信中の通知を待つ
+//
+//	log = log.WithWebhook(slackURL, glbr.WebhookOptions{})
+//	log = log.WithWebhook("https://events.pagerduty.com/v2/enqueue", glbr.WebhookOptions{Format: glbr.PagerDutyWebhook(key, "api")})
+func (s Service) WithWebhook(url string, opts WebhookOptions) Service {
+	if opts.MinSeverity == logging.Default {
+		opts.MinSeverity = logging.Critical
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.DedupWindow <= 0 {
+		opts.DedupWindow = time.Hour
+	}
+	if opts.Format == nil {
+		opts.Format = SlackWebhook
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	s.ctx = updateState(s.ctx, func(st *state) {
+		st.notifier = &notifier{url: url, opts: opts, sent: map[repeatKey]time.Time{}}
+	})
+	return s
+}
+
+// notifier webhookへの通知
+type notifier struct {
+	url  string
+	opts WebhookOptions
+
+	mu         sync.Mutex
+	last       time.Time               // 最後に通知した時刻
+	sent       map[repeatKey]time.Time // DedupWindow内に通知したメッセージ
+	suppressed int
+	closed     bool           // Shutdown後は通知しない
+	wg         sync.WaitGroup // 送信中の通知
+}
+
+// notify エントリを通知する
+// DedupWindow内に通知済みのメッセージは数えずに捨てる
+func (n *notifier) notify(entry logging.Entry) {
+	if entry.Severity < n.opts.MinSeverity {
+		return
+	}
+	message := entryMessage(entry)
+	key := repeatKey{severity: entry.Severity, message: message}
+	now := entry.Timestamp
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return
+	}
+	for k, at := range n.sent {
+		if n.opts.DedupWindow <= now.Sub(at) {
+			delete(n.sent, k)
+		}
+	}
+	if _, ok := n.sent[key]; ok {
+		n.mu.Unlock()
+		return
+	}
+	if !n.last.IsZero() && now.Sub(n.last) < n.opts.Interval {
+		n.suppressed++
+		n.mu.Unlock()
+		return
+	}
+	n.last = now
+	n.sent[key] = now
+	suppressed := n.suppressed
+	n.suppressed = 0
+	n.wg.Add(1)
+	n.mu.Unlock()
+	go n.post(Notification{
+		Severity:   entry.Severity,
+		Message:    message,
+		Trace:      entry.Trace,
+		Timestamp:  now,
+		Suppressed: suppressed,
+	})
+}
+
+// close 以降の通知を止め、送信中の通知を待つ
+func (n *notifier) close() {
+	n.mu.Lock()
+	n.closed = true
+	n.mu.Unlock()
+	n.wg.Wait()
+}
+
+func (n *notifier) post(notification Notification) {
+	defer n.wg.Done()
+	body, err := json.Marshal(n.opts.Format(notification))
+	if err != nil {
+		log.Printf("glbr: webhook: %v", err)
+		return
+	}
+	c, cancel := context.WithTimeout(context.Background(), n.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(c, "POST", n.url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("glbr: webhook: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := n.opts.Client.Do(req)
+	if err != nil {
+		log.Printf("glbr: webhook: %v", err)
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || 300 <= res.StatusCode {
+		log.Printf("glbr: webhook: %s", res.Status)
+	}
+}
+
+// entryMessage 通知に使うエントリのメッセージ
+func entryMessage(entry logging.Entry) string {
+	message, ok := payloadMessage(entry.Payload)
+	if !ok && entry.Payload != nil {
+		b, _ := json.Marshal(entry.Payload)
+		message = string(b)
+	}
+	if r := entry.HTTPRequest; r != nil && r.Request != nil {
+		prefix := fmt.Sprintf("%s %s %d", r.Request.Method, r.Request.URL, r.Status)
+		if message == "" {
+			return prefix
+		}
+		return prefix + " " + message
+	}
+	return message
+}
@@ -0,0 +1,52 @@
+package glbr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// closeは送信中の通知を待ち、制限時間を超えた送信は打ち切られる
+func TestNotifierClose(t *testing.T) {
+	var received int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hang" {
+			<-release
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&received, 1)
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	n := &notifier{url: srv.URL, opts: WebhookOptions{MinSeverity: logging.Critical, Interval: time.Nanosecond, DedupWindow: time.Nanosecond, Format: SlackWebhook, Client: http.DefaultClient, Timeout: time.Second}, sent: map[repeatKey]time.Time{}}
+	n.notify(logging.Entry{Severity: logging.Critical, Payload: "down", Timestamp: time.Now()})
+	n.close()
+	if atomic.LoadInt32(&received) != 1 {
+		t.Error("close did not wait for the notification")
+	}
+	n.notify(logging.Entry{Severity: logging.Critical, Payload: "after close", Timestamp: time.Now().Add(time.Second)})
+	n.wg.Wait()
+	if atomic.LoadInt32(&received) != 1 {
+		t.Error("notified after close")
+	}
+
+	hang := &notifier{url: srv.URL + "/hang", opts: WebhookOptions{MinSeverity: logging.Critical, Interval: time.Nanosecond, DedupWindow: time.Nanosecond, Format: SlackWebhook, Client: http.DefaultClient, Timeout: 10 * time.Millisecond}, sent: map[repeatKey]time.Time{}}
+	hang.notify(logging.Entry{Severity: logging.Critical, Payload: "down", Timestamp: time.Now()})
+	done := make(chan struct{})
+	go func() {
+		hang.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close did not return after the timeout")
+	}
+}